@@ -0,0 +1,65 @@
+// Package auth exposes the roles of the caller to API handlers. Tokens are verified by
+// the huemie-lib middleware, which keeps their claims to itself.
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Kaese72/adapter-attendant/internal/config"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// rolesKey is the context key of the roles of the caller
+type rolesKey struct{}
+
+// Middleware reads the roles of the caller from their bearer token into the request context.
+// Requests without a valid token get no roles.
+func Middleware(publicKey *rsa.PublicKey) func(ctx huma.Context, next func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		tokenString, found := strings.CutPrefix(ctx.Header("Authorization"), "Bearer ")
+		if !found {
+			next(ctx)
+			return
+		}
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(strings.TrimSpace(tokenString), claims, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return publicKey, nil
+		})
+		if err != nil {
+			next(ctx)
+			return
+		}
+		next(huma.WithValue(ctx, rolesKey{}, roles(claims[config.Loaded().Auth.RolesClaim])))
+	}
+}
+
+// roles reads a roles claim, which is either a list of roles or a space separated string
+func roles(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		roles := []string{}
+		for _, role := range value {
+			if role, ok := role.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+		return roles
+	}
+	return nil
+}
+
+// IsAdmin reports whether the caller has the admin role
+func IsAdmin(ctx context.Context) bool {
+	roles, _ := ctx.Value(rolesKey{}).([]string)
+	return slices.Contains(roles, config.Loaded().Auth.AdminRole)
+}
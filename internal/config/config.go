@@ -1,111 +1,425 @@
+// Package config loads the attendant configuration.
+//
+// Every setting has a single dotted key, e.g. "database.host". Settings are read from an
+// optional YAML or TOML file, and environment variables override the file. The environment
+// variable of a key is the key in upper case with dots and dashes replaced by underscores,
+// e.g. DATABASE_HOST. Secrets may instead be read from the file named by "<key>-file",
+// e.g. database.password-file. config.example.yaml documents every key.
 package config
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
 type Database struct {
+	// Driver is the database in use, mysql, postgres or sqlite
+	Driver string `json:"driver" mapstructure:"driver"`
+	// Path is the database file of the sqlite driver
+	Path     string `json:"path" mapstructure:"path"`
 	Host     string `json:"host" mapstructure:"host" `
 	Port     int    `json:"port" mapstructure:"port"`
 	User     string `json:"user" mapstructure:"user"`
 	Password string `json:"password" mapstructure:"password"`
-	Database string `json:"database" mapstructure:"database"`
+	// PasswordFile names a file holding Password, which takes precedence over Password
+	PasswordFile string `json:"password-file" mapstructure:"password-file"`
+	Database     string `json:"database" mapstructure:"database"`
+	// DSN replaces the connection settings above for the mysql and postgres drivers
+	DSN string `json:"dsn" mapstructure:"dsn"`
+	// DSNFile names a file holding DSN, which takes precedence over DSN
+	DSNFile string `json:"dsn-file" mapstructure:"dsn-file"`
+	// EncryptionKey is the base64 encoded 32 byte AES key encrypting registry credentials at rest
+	EncryptionKey string `json:"encryption-key" mapstructure:"encryption-key"`
+	// EncryptionKeyFile names a file holding EncryptionKey, which takes precedence over EncryptionKey
+	EncryptionKeyFile string `json:"encryption-key-file" mapstructure:"encryption-key-file"`
+	// MigrateOnStartup applies pending schema migrations before serving
+	MigrateOnStartup bool `json:"migrate-on-startup" mapstructure:"migrate-on-startup"`
 }
 
 type Kubernetes struct {
 	KubeConfigPath string `json:"kubeconfig-path" mapstructure:"kubeconfig-path"`
 	InCluster      bool   `json:"in-cluster" mapstructure:"in-cluster"`
-	NameSpace      string `json:"namespace" mapstructure:"namespace"`
+	NameSpace      string `json:"adapter-namespace" mapstructure:"adapter-namespace"`
+}
+
+// Resources are Kubernetes resource quantities applied to adapter containers
+type Resources struct {
+	CPURequest    string `json:"cpu-request" mapstructure:"cpu-request"`
+	CPULimit      string `json:"cpu-limit" mapstructure:"cpu-limit"`
+	MemoryRequest string `json:"memory-request" mapstructure:"memory-request"`
+	MemoryLimit   string `json:"memory-limit" mapstructure:"memory-limit"`
+}
+
+// CredentialKey decodes EncryptionKey, returning nil if it is not set
+func (database Database) CredentialKey() ([]byte, error) {
+	if database.EncryptionKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(database.EncryptionKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "encryption key is not base64")
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key is %d bytes, not 32", len(key))
+	}
+	return key, nil
+}
+
+// Probe is the health probe applied to adapter containers that do not define their own
+type Probe struct {
+	Type string `json:"type" mapstructure:"type"`
+	Path string `json:"path" mapstructure:"path"`
+}
+
+// ImagePolicy restricts the images adapters may run
+type ImagePolicy struct {
+	// AllowedRepositories are glob patterns of the repositories adapters may use, eg. "ghcr.io/kaese72/*".
+	// * matches within a path segment and ** across segments. Empty allows any repository.
+	AllowedRepositories []string `json:"allowed-repositories" mapstructure:"allowed-repositories"`
+	// VerificationHooks must all accept the signature of an image before it is run
+	VerificationHooks []VerificationHook `json:"verification-hooks" mapstructure:"verification-hooks"`
+}
+
+// VerificationHook is an HTTP endpoint verifying image signatures, eg. with cosign.
+// It receives a POST of the image pinned to its digest and accepts it by responding with a 2xx status.
+type VerificationHook struct {
+	URL string `json:"url" mapstructure:"url"`
+	// Repositories limits the hook to repositories matching these glob patterns, empty meaning all
+	Repositories []string      `json:"repositories" mapstructure:"repositories"`
+	Timeout      time.Duration `json:"timeout" mapstructure:"timeout"`
 }
 
 type Adapters struct {
 	DeviceStoreURL       string `json:"device-store-url" mapstructure:"device-store-url"`
 	DeviceStoreJWTSecret string `json:"device-store-jwt-secret" mapstructure:"device-store-jwt-secret"`
+	// DeviceStoreJWTSecretFile names a file holding DeviceStoreJWTSecret, which takes precedence over DeviceStoreJWTSecret
+	DeviceStoreJWTSecretFile string    `json:"device-store-jwt-secret-file" mapstructure:"device-store-jwt-secret-file"`
+	DefaultResources         Resources `json:"default-resources" mapstructure:"default-resources"`
+	MaxResources             Resources `json:"max-resources" mapstructure:"max-resources"`
+	DefaultProbe             Probe     `json:"default-probe" mapstructure:"default-probe"`
+	// ResyncOnChange resyncs all adapters when a reload changes settings that end up in their workloads
+	ResyncOnChange bool `json:"resync-on-change" mapstructure:"resync-on-change"`
+	// UpdatePollInterval is how often registries are polled for newer adapter images, 0 disables polling
+	UpdatePollInterval time.Duration `json:"update-poll-interval" mapstructure:"update-poll-interval"`
+	// ResolveDigests pins adapters to the digest their tag points to when they are synced
+	ResolveDigests bool        `json:"resolve-digests" mapstructure:"resolve-digests"`
+	ImagePolicy    ImagePolicy `json:"image-policy" mapstructure:"image-policy"`
+	// DefaultPullSecret names an existing Secret in the adapter namespace every adapter pulls its image with
+	DefaultPullSecret string `json:"default-pull-secret" mapstructure:"default-pull-secret"`
+	// ServiceAccount is the service account adapters run as, created by the attendant
+	ServiceAccount string `json:"service-account" mapstructure:"service-account"`
+	// RunAsUser is the user Id adapters not allowed to run as root run as, 0 leaving it to the image
+	RunAsUser int64 `json:"run-as-user" mapstructure:"run-as-user"`
+}
+
+// Webhooks controls delivery of outbound webhooks
+type Webhooks struct {
+	MaxAttempts    int           `json:"max-attempts" mapstructure:"max-attempts"`
+	InitialBackoff time.Duration `json:"initial-backoff" mapstructure:"initial-backoff"`
+	MaxBackoff     time.Duration `json:"max-backoff" mapstructure:"max-backoff"`
+	Timeout        time.Duration `json:"timeout" mapstructure:"timeout"`
+	// Workers is the number of deliveries attempted at the same time by each replica
+	Workers int `json:"workers" mapstructure:"workers"`
+	// AllowPrivateTargets allows subscriptions to deliver to cluster and other private addresses.
+	// Loopback, link-local and metadata addresses are never allowed.
+	AllowPrivateTargets bool `json:"allow-private-targets" mapstructure:"allow-private-targets"`
+}
+
+// Server holds the timeouts of the public and internal HTTP servers
+type Server struct {
+	ReadTimeout       time.Duration `json:"read-timeout" mapstructure:"read-timeout"`
+	ReadHeaderTimeout time.Duration `json:"read-header-timeout" mapstructure:"read-header-timeout"`
+	WriteTimeout      time.Duration `json:"write-timeout" mapstructure:"write-timeout"`
+	IdleTimeout       time.Duration `json:"idle-timeout" mapstructure:"idle-timeout"`
+	// ShutdownTimeout is how long in-flight requests and syncs get to finish on SIGTERM
+	ShutdownTimeout time.Duration `json:"shutdown-timeout" mapstructure:"shutdown-timeout"`
+	// StartupTimeout is how long the Kubernetes caches get to sync on startup
+	StartupTimeout time.Duration `json:"startup-timeout" mapstructure:"startup-timeout"`
+}
+
+type Logging struct {
+	Debug bool `json:"debug" mapstructure:"debug"`
 }
 
 type Auth struct {
 	RSAPublicKeyPath string `json:"rsa-public-key-path" mapstructure:"rsa-public-key-path"`
+	// RolesClaim is the token claim listing the roles of the caller
+	RolesClaim string `json:"roles-claim" mapstructure:"roles-claim"`
+	// AdminRole is the role allowed to relax the security settings of adapters
+	AdminRole string `json:"admin-role" mapstructure:"admin-role"`
 }
 
 type Config struct {
-	ClusterConfig Kubernetes `json:"cluster-config" mapstructure:"cluster-config"`
+	ClusterConfig Kubernetes `json:"kubernetes" mapstructure:"kubernetes"`
+	Logging       Logging    `json:"logging" mapstructure:"logging"`
 	Adapters      Adapters   `json:"adapters" mapstructure:"adapters"`
 	Auth          Auth       `json:"auth" mapstructure:"auth"`
+	Webhooks      Webhooks   `json:"webhooks" mapstructure:"webhooks"`
 	Database      Database   `json:"database" mapstructure:"database"`
+	Server        Server     `json:"server" mapstructure:"server"`
 	PublicPort    int        `json:"public-port" mapstructure:"public-port"`
 	InternalPort  int        `json:"internal-port" mapstructure:"internal-port"`
 }
 
-// Loaded contains all configuration which was loaded in when the application started
-var Loaded Config
+// loadedState is the loaded configuration together with the raw settings it was decoded from
+type loadedState struct {
+	conf     Config
+	settings *viper.Viper
+}
+
+var loaded atomic.Pointer[loadedState]
 
-func init() {
+// Loaded returns the configuration the application is running with.
+// Settings which are safe to change at runtime are replaced when the configuration
+// is reloaded, so it should be called whenever a setting is needed rather than kept.
+func Loaded() Config {
+	state := loaded.Load()
+	if state == nil {
+		return Config{}
+	}
+	return state.conf
+}
+
+// secretMask replaces secrets in dumped configuration
+const secretMask = "********"
+
+// newSettings binds every configuration key to its environment variable and sets defaults
+func newSettings() *viper.Viper {
+	settings := viper.New()
 	// We have elected to no use AutomaticEnv() because of https://github.com/spf13/viper/issues/584
 	// myVip.AutomaticEnv()
 	// Set replaces to allow keys like "database.mongodb.connection-string"
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	settings.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
 
 	// # Default values where appropriate
 	// Kubernetes access configuration
-	viper.BindEnv("kubernetes.kubeconfig-path")
-	viper.BindEnv("kubernetes.adapter-namespace")
+	settings.BindEnv("kubernetes.kubeconfig-path")
+	settings.BindEnv("kubernetes.adapter-namespace")
 	// kubernetes.in-cluster is treated as a fallback when no config is provided and
 	// thus defaults to true
-	viper.BindEnv("kubernetes.in-cluster")
-	viper.SetDefault("kubernetes.in-cluster", true)
+	settings.BindEnv("kubernetes.in-cluster")
+	settings.SetDefault("kubernetes.in-cluster", true)
 
 	// # Logging
-	viper.BindEnv("logging.stdout")
-	viper.SetDefault("logging.stdout", true)
-	viper.BindEnv("logging.http.url")
+	settings.BindEnv("logging.debug")
+	settings.SetDefault("logging.debug", false)
 
 	// # Device Store
-	viper.BindEnv("adapters.device-store-url")
-	viper.BindEnv("adapters.device-store-jwt-secret")
+	settings.BindEnv("adapters.device-store-url")
+	settings.BindEnv("adapters.device-store-jwt-secret")
+	settings.BindEnv("adapters.device-store-jwt-secret-file")
+
+	// # Adapter container resources
+	// Defaults are used when an adapter does not specify its own values,
+	// maximums cap what an adapter may request.
+	settings.BindEnv("adapters.default-resources.cpu-request")
+	settings.SetDefault("adapters.default-resources.cpu-request", "50m")
+	settings.BindEnv("adapters.default-resources.cpu-limit")
+	settings.SetDefault("adapters.default-resources.cpu-limit", "500m")
+	settings.BindEnv("adapters.default-resources.memory-request")
+	settings.SetDefault("adapters.default-resources.memory-request", "64Mi")
+	settings.BindEnv("adapters.default-resources.memory-limit")
+	settings.SetDefault("adapters.default-resources.memory-limit", "256Mi")
+	settings.BindEnv("adapters.max-resources.cpu-request")
+	settings.SetDefault("adapters.max-resources.cpu-request", "1")
+	settings.BindEnv("adapters.max-resources.cpu-limit")
+	settings.SetDefault("adapters.max-resources.cpu-limit", "2")
+	settings.BindEnv("adapters.max-resources.memory-request")
+	settings.SetDefault("adapters.max-resources.memory-request", "512Mi")
+	settings.BindEnv("adapters.max-resources.memory-limit")
+	settings.SetDefault("adapters.max-resources.memory-limit", "1Gi")
+
+	// # Adapter container health probes
+	settings.BindEnv("adapters.default-probe.type")
+	settings.SetDefault("adapters.default-probe.type", "http")
+	settings.BindEnv("adapters.default-probe.path")
+	settings.SetDefault("adapters.default-probe.path", "/healthz")
+
+	// # Reloading
+	settings.BindEnv("adapters.resync-on-change")
+	settings.SetDefault("adapters.resync-on-change", false)
+
+	// # Image updates
+	settings.BindEnv("adapters.update-poll-interval")
+	settings.SetDefault("adapters.update-poll-interval", "1h")
+	settings.BindEnv("adapters.resolve-digests")
+	settings.SetDefault("adapters.resolve-digests", false)
+
+	// # Image policy
+	settings.BindEnv("adapters.image-policy.allowed-repositories")
+	settings.SetDefault("adapters.image-policy.allowed-repositories", []string{})
+	settings.BindEnv("adapters.default-pull-secret")
+	settings.BindEnv("adapters.service-account")
+	settings.SetDefault("adapters.service-account", "huemie-adapter")
+	settings.BindEnv("adapters.run-as-user")
+	settings.SetDefault("adapters.run-as-user", 0)
+
+	// # Outbound webhooks
+	settings.BindEnv("webhooks.max-attempts")
+	settings.SetDefault("webhooks.max-attempts", 8)
+	settings.BindEnv("webhooks.initial-backoff")
+	settings.SetDefault("webhooks.initial-backoff", "1s")
+	settings.BindEnv("webhooks.max-backoff")
+	settings.SetDefault("webhooks.max-backoff", "5m")
+	settings.BindEnv("webhooks.timeout")
+	settings.SetDefault("webhooks.timeout", "10s")
+	settings.BindEnv("webhooks.workers")
+	settings.SetDefault("webhooks.workers", 4)
+	settings.BindEnv("webhooks.allow-private-targets")
+	settings.SetDefault("webhooks.allow-private-targets", true)
 
 	// # Authentication service public key (RS256 use-token verification)
-	viper.BindEnv("auth.rsa-public-key-path")
+	settings.BindEnv("auth.rsa-public-key-path")
+	settings.BindEnv("auth.roles-claim")
+	settings.SetDefault("auth.roles-claim", "roles")
+	settings.BindEnv("auth.admin-role")
+	settings.SetDefault("auth.admin-role", "admin")
+
+	// # HTTP servers
+	settings.BindEnv("server.read-timeout")
+	settings.SetDefault("server.read-timeout", "30s")
+	settings.BindEnv("server.read-header-timeout")
+	settings.SetDefault("server.read-header-timeout", "10s")
+	settings.BindEnv("server.write-timeout")
+	settings.SetDefault("server.write-timeout", "2m")
+	settings.BindEnv("server.idle-timeout")
+	settings.SetDefault("server.idle-timeout", "2m")
+	settings.BindEnv("server.shutdown-timeout")
+	settings.SetDefault("server.shutdown-timeout", "30s")
+	settings.BindEnv("server.startup-timeout")
+	settings.SetDefault("server.startup-timeout", "2m")
 
 	// # Ports
-	viper.BindEnv("public-port")
-	viper.SetDefault("public-port", 8080)
-	viper.BindEnv("internal-port")
-	viper.SetDefault("internal-port", 8081)
+	settings.BindEnv("public-port")
+	settings.SetDefault("public-port", 8080)
+	settings.BindEnv("internal-port")
+	settings.SetDefault("internal-port", 8081)
 
 	// # Database configuration, if left out.
-	viper.BindEnv("database.host")
-	viper.BindEnv("database.port")
-	viper.BindEnv("database.user")
-	viper.BindEnv("database.password")
-	viper.BindEnv("database.database")
-	viper.SetDefault("database.port", 3306)
-	viper.SetDefault("database.database", "adapterattendant")
-
-	// FIXME check that the required config options are set
-
-	Loaded = Config{
-		ClusterConfig: Kubernetes{
-			KubeConfigPath: viper.GetString("kubernetes.kubeconfig-path"),
-			NameSpace:      viper.GetString("kubernetes.adapter-namespace"),
-			InCluster:      viper.GetBool("kubernetes.in-cluster"),
-		},
-		Adapters: Adapters{
-			DeviceStoreURL:       viper.GetString("adapters.device-store-url"),
-			DeviceStoreJWTSecret: viper.GetString("adapters.device-store-jwt-secret"),
-		},
-		Auth: Auth{
-			RSAPublicKeyPath: viper.GetString("auth.rsa-public-key-path"),
-		},
-		Database: Database{
-			Host:     viper.GetString("database.host"),
-			Port:     viper.GetInt("database.port"),
-			User:     viper.GetString("database.user"),
-			Password: viper.GetString("database.password"),
-			Database: viper.GetString("database.database"),
-		},
-		PublicPort:   viper.GetInt("public-port"),
-		InternalPort: viper.GetInt("internal-port"),
+	settings.BindEnv("database.driver")
+	settings.SetDefault("database.driver", "mysql")
+	settings.BindEnv("database.path")
+	settings.BindEnv("database.host")
+	settings.BindEnv("database.port")
+	settings.BindEnv("database.user")
+	settings.BindEnv("database.password")
+	settings.BindEnv("database.password-file")
+	settings.BindEnv("database.database")
+	settings.BindEnv("database.dsn")
+	settings.BindEnv("database.dsn-file")
+	settings.BindEnv("database.encryption-key")
+	settings.BindEnv("database.encryption-key-file")
+	settings.SetDefault("database.database", "adapterattendant")
+	settings.BindEnv("database.migrate-on-startup")
+	settings.SetDefault("database.migrate-on-startup", true)
+
+	return settings
+}
+
+// secrets lists the secret values of a configuration along with their keys and the files they may be read from
+func (conf *Config) secrets() []struct {
+	key   string
+	file  string
+	value *string
+} {
+	return []struct {
+		key   string
+		file  string
+		value *string
+	}{
+		{"database.password", conf.Database.PasswordFile, &conf.Database.Password},
+		{"database.dsn", conf.Database.DSNFile, &conf.Database.DSN},
+		{"database.encryption-key", conf.Database.EncryptionKeyFile, &conf.Database.EncryptionKey},
+		{"adapters.device-store-jwt-secret", conf.Adapters.DeviceStoreJWTSecretFile, &conf.Adapters.DeviceStoreJWTSecret},
+	}
+}
+
+// readSecretFiles replaces secrets with the content of their files, where configured
+func (conf *Config) readSecretFiles() error {
+	for _, secret := range conf.secrets() {
+		if secret.file == "" {
+			continue
+		}
+		content, err := os.ReadFile(secret.file)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s-file", secret.key)
+		}
+		// Files written by editors and Kubernetes secret tooling commonly end in a newline
+		*secret.value = strings.TrimRight(string(content), "\r\n")
+	}
+	return nil
+}
+
+// read reads configuration from the file at path, if not empty, and the environment
+func read(path string) (Config, *viper.Viper, error) {
+	settings := newSettings()
+	if path != "" {
+		settings.SetConfigFile(path)
+		if err := settings.ReadInConfig(); err != nil {
+			return Config{}, nil, errors.Wrapf(err, "failed to read config file %s", path)
+		}
+	}
+	conf := Config{}
+	if err := settings.Unmarshal(&conf); err != nil {
+		return Config{}, nil, errors.Wrap(err, "failed to decode configuration")
+	}
+	if err := conf.readSecretFiles(); err != nil {
+		return Config{}, nil, err
+	}
+	return conf, settings, nil
+}
+
+// Load reads configuration from the file at path, if not empty, and the environment, and makes it the Loaded configuration.
+// Required options are checked by Config.Validate once the application starts.
+func Load(path string) error {
+	conf, settings, err := read(path)
+	if err != nil {
+		return err
+	}
+	loaded.Store(&loadedState{conf: conf, settings: settings})
+	return nil
+}
+
+// Dump writes the effective configuration as YAML, with secrets masked
+func Dump(writer io.Writer) error {
+	// The decoded configuration contains keys which are unset, the raw settings keep durations readable
+	state := loaded.Load()
+	decoded, err := json.Marshal(state.conf)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode configuration")
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(decoded, &values); err != nil {
+		return errors.Wrap(err, "failed to encode configuration")
+	}
+	dump := viper.New()
+	if err := dump.MergeConfigMap(values); err != nil {
+		return errors.Wrap(err, "failed to encode configuration")
+	}
+	for _, key := range state.settings.AllKeys() {
+		dump.Set(key, state.settings.Get(key))
+	}
+	for _, secret := range state.conf.secrets() {
+		masked := ""
+		if *secret.value != "" {
+			masked = secretMask
+		}
+		dump.Set(secret.key, masked)
+	}
+	encoder := yaml.NewEncoder(writer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(dump.AllSettings()); err != nil {
+		return errors.Wrap(err, "failed to encode configuration")
 	}
+	return encoder.Close()
 }
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		secret  string
+		check   func(conf Config) bool
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			check: func(conf Config) bool {
+				return conf.Database.Driver == "mysql" && conf.ClusterConfig.InCluster && conf.PublicPort == 8080 &&
+					conf.Adapters.DefaultProbe == Probe{Type: "http", Path: "/healthz"} && conf.Adapters.RunAsUser == 0
+			},
+		},
+		{
+			name: "file",
+			file: "database:\n  host: mariadb\nadapters:\n  default-resources:\n    cpu-limit: 1\n",
+			check: func(conf Config) bool {
+				return conf.Database.Host == "mariadb" && conf.Adapters.DefaultResources.CPULimit == "1"
+			},
+		},
+		{
+			name: "environment overrides file",
+			file: "database:\n  host: mariadb\n",
+			env:  map[string]string{"DATABASE_HOST": "postgres", "SERVER_SHUTDOWN_TIMEOUT": "1m"},
+			check: func(conf Config) bool {
+				return conf.Database.Host == "postgres" && conf.Server.ShutdownTimeout.Minutes() == 1
+			},
+		},
+		{
+			name:   "secret file",
+			secret: "hunter2\n",
+			env:    map[string]string{"DATABASE_PASSWORD": "ignored"},
+			check:  func(conf Config) bool { return conf.Database.Password == "hunter2" },
+		},
+		{
+			name:    "missing secret file",
+			env:     map[string]string{"DATABASE_PASSWORD_FILE": "/nonexistent/password"},
+			wantErr: true,
+		},
+		{
+			name:    "malformed file",
+			file:    "database: [",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory := t.TempDir()
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			if test.secret != "" {
+				secretPath := filepath.Join(directory, "password")
+				if err := os.WriteFile(secretPath, []byte(test.secret), 0o600); err != nil {
+					t.Fatalf("failed to write secret: %v", err)
+				}
+				t.Setenv("DATABASE_PASSWORD_FILE", secretPath)
+			}
+			path := ""
+			if test.file != "" {
+				path = filepath.Join(directory, "config.yaml")
+				if err := os.WriteFile(path, []byte(test.file), 0o600); err != nil {
+					t.Fatalf("failed to write config file: %v", err)
+				}
+			}
+			err := Load(path)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !test.check(Loaded()) {
+				t.Errorf("Load() = %+v", Loaded())
+			}
+		})
+	}
+}
+
+func TestDumpMasksSecrets(t *testing.T) {
+	t.Setenv("DATABASE_PASSWORD", "hunter2")
+	t.Setenv("DATABASE_HOST", "mariadb")
+	if err := Load(""); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var dump bytes.Buffer
+	if err := Dump(&dump); err != nil {
+		t.Fatalf("Dump() error = %v", err)
+	}
+	if strings.Contains(dump.String(), "hunter2") || !strings.Contains(dump.String(), secretMask) {
+		t.Errorf("Dump() does not mask the database password:\n%s", dump.String())
+	}
+	if !strings.Contains(dump.String(), "host: mariadb") {
+		t.Errorf("Dump() is missing the database host:\n%s", dump.String())
+	}
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// reloadDelay collects the bursts of file events caused by a single change, such as
+// Kubernetes swapping the symlinks of a mounted Secret, into a single reload
+const reloadDelay = 500 * time.Millisecond
+
+// ReloadListener is called after a reload changed the Loaded configuration
+type ReloadListener func(previous Config, current Config)
+
+// AdapterSettingsChanged reports whether settings that end up in adapter workloads differ
+func AdapterSettingsChanged(previous Config, current Config) bool {
+	return previous.Adapters.DeviceStoreURL != current.Adapters.DeviceStoreURL ||
+		previous.Adapters.DeviceStoreJWTSecret != current.Adapters.DeviceStoreJWTSecret ||
+		previous.Adapters.DefaultResources != current.Adapters.DefaultResources ||
+		previous.Adapters.DefaultProbe != current.Adapters.DefaultProbe ||
+		previous.Adapters.DefaultPullSecret != current.Adapters.DefaultPullSecret ||
+		previous.Adapters.ServiceAccount != current.Adapters.ServiceAccount ||
+		previous.Adapters.RunAsUser != current.Adapters.RunAsUser
+}
+
+// unsafeChanges returns the keys of changed settings that are only read on startup
+func unsafeChanges(previous Config, current Config) []string {
+	changed := []string{}
+	for _, section := range []struct {
+		key     string
+		changed bool
+	}{
+		{"kubernetes", previous.ClusterConfig != current.ClusterConfig},
+		{"auth", previous.Auth != current.Auth},
+		{"webhooks", previous.Webhooks != current.Webhooks},
+		{"database", previous.Database != current.Database},
+		{"server", previous.Server != current.Server},
+		{"public-port", previous.PublicPort != current.PublicPort},
+		{"internal-port", previous.InternalPort != current.InternalPort},
+	} {
+		if section.changed {
+			changed = append(changed, section.key)
+		}
+	}
+	return changed
+}
+
+// watchedDirectories returns the directories holding the config file and secret files.
+// Directories rather than files are watched, since files replaced by renaming or
+// symlink swaps would otherwise be lost by the watch.
+func watchedDirectories(path string, conf Config) []string {
+	directories := []string{}
+	if path != "" {
+		directories = append(directories, filepath.Dir(path))
+	}
+	for _, secret := range conf.secrets() {
+		if secret.file != "" {
+			directories = append(directories, filepath.Dir(secret.file))
+		}
+	}
+	return directories
+}
+
+// reload reads the configuration again and applies the settings that are safe to change at runtime
+func reload(ctx context.Context, path string, listener ReloadListener) {
+	conf, settings, err := read(path)
+	if err != nil {
+		logging.Error("Failed to reload configuration, keeping the current one", ctx, map[string]any{"ERROR": err.Error()})
+		return
+	}
+	if err := conf.Validate(); err != nil {
+		logging.Error("Reloaded configuration is invalid, keeping the current one", ctx, map[string]any{"ERROR": err.Error()})
+		return
+	}
+	previous := Loaded()
+	for _, key := range unsafeChanges(previous, conf) {
+		logging.Error("Ignoring change that requires a restart", ctx, map[string]any{"KEY": key})
+	}
+	current := previous
+	current.Adapters = conf.Adapters
+	current.Logging = conf.Logging
+	if reflect.DeepEqual(current, previous) {
+		return
+	}
+	loaded.Store(&loadedState{conf: current, settings: settings})
+	logging.SetDebug(current.Logging.Debug)
+	logging.Info("Configuration reloaded", ctx)
+	if listener != nil {
+		listener(previous, current)
+	}
+}
+
+// Watch reloads the configuration whenever the config file at path, if not empty, or
+// a secret file changes, until ctx is cancelled. Only the adapters and logging settings
+// are applied, changes to other settings are logged and ignored until the next restart.
+func Watch(ctx context.Context, path string, listener ReloadListener) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "failed to create file watcher")
+	}
+	defer watcher.Close()
+	watched := map[string]bool{}
+	watch := func() {
+		for _, directory := range watchedDirectories(path, Loaded()) {
+			if watched[directory] {
+				continue
+			}
+			if err := watcher.Add(directory); err != nil {
+				logging.Error("Failed to watch configuration directory", ctx, map[string]any{"ERROR": err.Error(), "DIRECTORY": directory})
+				continue
+			}
+			watched[directory] = true
+		}
+	}
+	watch()
+
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			timer.Reset(reloadDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logging.Error("Error watching configuration", ctx, map[string]any{"ERROR": err.Error()})
+		case <-timer.C:
+			reload(ctx, path, listener)
+			// Secret files may have been moved to new directories
+			watch()
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUnsafeChanges(t *testing.T) {
+	tests := []struct {
+		name            string
+		change          func(conf *Config)
+		adapterSettings bool
+		unsafe          []string
+	}{
+		{name: "nothing", change: func(conf *Config) {}, unsafe: []string{}},
+		{name: "device store URL", change: func(conf *Config) { conf.Adapters.DeviceStoreURL = "http://other:8080" }, adapterSettings: true, unsafe: []string{}},
+		{name: "default probe", change: func(conf *Config) { conf.Adapters.DefaultProbe.Type = "tcp" }, adapterSettings: true, unsafe: []string{}},
+		{name: "maximum resources", change: func(conf *Config) { conf.Adapters.MaxResources.CPULimit = "4" }, unsafe: []string{}},
+		{name: "database host", change: func(conf *Config) { conf.Database.Host = "postgres" }, unsafe: []string{"database"}},
+		{
+			name: "ports",
+			change: func(conf *Config) {
+				conf.PublicPort = 9080
+				conf.InternalPort = 9081
+			},
+			unsafe: []string{"public-port", "internal-port"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous := validConfig("public.pem")
+			current := previous
+			test.change(&current)
+			if got := AdapterSettingsChanged(previous, current); got != test.adapterSettings {
+				t.Errorf("AdapterSettingsChanged() = %v, want %v", got, test.adapterSettings)
+			}
+			if got := unsafeChanges(previous, current); !reflect.DeepEqual(got, test.unsafe) {
+				t.Errorf("unsafeChanges() = %v, want %v", got, test.unsafe)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	directory := t.TempDir()
+	keyPath := filepath.Join(directory, "public.pem")
+	if err := os.WriteFile(keyPath, []byte("key"), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	path := filepath.Join(directory, "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write config file: %v", err)
+		}
+	}
+	base := "kubernetes:\n  adapter-namespace: huemie\n" +
+		"auth:\n  rsa-public-key-path: " + keyPath + "\n" +
+		"database:\n  host: mariadb\n  user: attendant\n" +
+		"adapters:\n  device-store-jwt-secret: secret\n"
+	write(base + "  device-store-url: http://device-store:8080\n")
+	if err := Load(path); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	tests := []struct {
+		name         string
+		content      string
+		wantURL      string
+		wantHost     string
+		wantNotified bool
+	}{
+		{name: "adapter setting applied", content: base + "  device-store-url: http://other:8080\n", wantURL: "http://other:8080", wantHost: "mariadb", wantNotified: true},
+		{name: "database change ignored", content: base + "  device-store-url: http://other:8080\ndatabase:\n  host: postgres\n", wantURL: "http://other:8080", wantHost: "mariadb"},
+		{name: "invalid configuration kept out", content: base + "  device-store-url: other\n", wantURL: "http://other:8080", wantHost: "mariadb"},
+		{name: "malformed file kept out", content: "adapters: [", wantURL: "http://other:8080", wantHost: "mariadb"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			write(test.content)
+			notified := false
+			reload(context.Background(), path, func(previous Config, current Config) { notified = true })
+			if got := Loaded(); got.Adapters.DeviceStoreURL != test.wantURL || got.Database.Host != test.wantHost {
+				t.Errorf("Loaded() has device store %q and database %q, want %q and %q", got.Adapters.DeviceStoreURL, got.Database.Host, test.wantURL, test.wantHost)
+			}
+			if notified != test.wantNotified {
+				t.Errorf("listener notified = %v, want %v", notified, test.wantNotified)
+			}
+		})
+	}
+}
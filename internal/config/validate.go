@@ -0,0 +1,212 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (validationError ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(validationError.Problems, "\n  - ")
+}
+
+// envName returns the environment variable a configuration key is read from
+func envName(key string) string {
+	return strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+type validator struct {
+	problems []string
+}
+
+// fail records a problem with a configuration key, pointing out how to set it
+func (v *validator) fail(key string, format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf("%s: %s (set %s)", key, fmt.Sprintf(format, args...), envName(key)))
+}
+
+func (v *validator) required(key string, value string) {
+	if value == "" {
+		v.fail(key, "must be set")
+	}
+}
+
+func (v *validator) readableFile(key string, path string) {
+	if path == "" {
+		v.fail(key, "must be set")
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		v.fail(key, "can not read %q: %s", path, err.Error())
+		return
+	}
+	file.Close()
+}
+
+func (v *validator) port(key string, port int) {
+	if port < 1 || port > 65535 {
+		v.fail(key, "port %d is out of range 1-65535", port)
+	}
+}
+
+func (v *validator) quantity(key string, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := resource.ParseQuantity(value); err != nil {
+		v.fail(key, "%q is not a valid Kubernetes quantity", value)
+	}
+}
+
+// Validate checks the configuration and reports all problems at once
+func (conf Config) Validate() error {
+	v := &validator{}
+
+	// Kubernetes
+	v.required("kubernetes.adapter-namespace", conf.ClusterConfig.NameSpace)
+	if conf.ClusterConfig.KubeConfigPath != "" {
+		v.readableFile("kubernetes.kubeconfig-path", conf.ClusterConfig.KubeConfigPath)
+	} else if !conf.ClusterConfig.InCluster {
+		v.fail("kubernetes.kubeconfig-path", "must be set when not running in-cluster")
+	}
+
+	// Database
+	switch conf.Database.Driver {
+	case "mysql", "postgres":
+		if conf.Database.DSN != "" {
+			break
+		}
+		v.required("database.host", conf.Database.Host)
+		v.required("database.user", conf.Database.User)
+		v.required("database.database", conf.Database.Database)
+		// Zero picks the default port of the driver
+		if conf.Database.Port != 0 {
+			v.port("database.port", conf.Database.Port)
+		}
+	case "sqlite":
+		v.required("database.path", conf.Database.Path)
+	default:
+		v.fail("database.driver", "%q is not one of mysql, postgres or sqlite", conf.Database.Driver)
+	}
+
+	if _, err := conf.Database.CredentialKey(); err != nil {
+		v.fail("database.encryption-key", "%s, generate one with openssl rand -base64 32", err.Error())
+	}
+
+	// Authentication
+	v.readableFile("auth.rsa-public-key-path", conf.Auth.RSAPublicKeyPath)
+	v.required("auth.roles-claim", conf.Auth.RolesClaim)
+	v.required("auth.admin-role", conf.Auth.AdminRole)
+
+	// Adapters
+	v.required("adapters.device-store-jwt-secret", conf.Adapters.DeviceStoreJWTSecret)
+	if conf.Adapters.DeviceStoreURL == "" {
+		v.fail("adapters.device-store-url", "must be set")
+	} else if parsed, err := url.Parse(conf.Adapters.DeviceStoreURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		v.fail("adapters.device-store-url", "%q is not an absolute URL", conf.Adapters.DeviceStoreURL)
+	}
+	for _, entry := range []struct {
+		prefix    string
+		resources Resources
+	}{
+		{"adapters.default-resources", conf.Adapters.DefaultResources},
+		{"adapters.max-resources", conf.Adapters.MaxResources},
+	} {
+		v.quantity(entry.prefix+".cpu-request", entry.resources.CPURequest)
+		v.quantity(entry.prefix+".cpu-limit", entry.resources.CPULimit)
+		v.quantity(entry.prefix+".memory-request", entry.resources.MemoryRequest)
+		v.quantity(entry.prefix+".memory-limit", entry.resources.MemoryLimit)
+	}
+	switch conf.Adapters.DefaultProbe.Type {
+	case "http", "tcp", "none":
+	default:
+		v.fail("adapters.default-probe.type", "%q is not one of http, tcp or none", conf.Adapters.DefaultProbe.Type)
+	}
+	if conf.Adapters.DefaultProbe.Type == "http" && !strings.HasPrefix(conf.Adapters.DefaultProbe.Path, "/") {
+		v.fail("adapters.default-probe.path", "%q must start with /", conf.Adapters.DefaultProbe.Path)
+	}
+	if conf.Adapters.DefaultPullSecret != "" && len(validation.IsDNS1123Subdomain(conf.Adapters.DefaultPullSecret)) > 0 {
+		v.fail("adapters.default-pull-secret", "%q is not a valid Secret name", conf.Adapters.DefaultPullSecret)
+	}
+	if len(validation.IsDNS1123Subdomain(conf.Adapters.ServiceAccount)) > 0 {
+		v.fail("adapters.service-account", "%q is not a valid service account name", conf.Adapters.ServiceAccount)
+	}
+	if conf.Adapters.RunAsUser < 0 {
+		v.fail("adapters.run-as-user", "must not be negative")
+	}
+	if conf.Adapters.UpdatePollInterval < 0 {
+		v.fail("adapters.update-poll-interval", "must not be negative")
+	}
+	for _, pattern := range conf.Adapters.ImagePolicy.AllowedRepositories {
+		if pattern == "" {
+			v.fail("adapters.image-policy.allowed-repositories", "patterns must not be empty")
+		}
+	}
+	for i, hook := range conf.Adapters.ImagePolicy.VerificationHooks {
+		key := fmt.Sprintf("adapters.image-policy.verification-hooks.%d", i)
+		if parsed, err := url.Parse(hook.URL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			v.fail(key+".url", "%q is not an absolute URL", hook.URL)
+		}
+		if hook.Timeout < 0 {
+			v.fail(key+".timeout", "must not be negative")
+		}
+	}
+
+	// Webhooks
+	if conf.Webhooks.MaxAttempts < 1 {
+		v.fail("webhooks.max-attempts", "must be at least 1")
+	}
+	if conf.Webhooks.InitialBackoff <= 0 {
+		v.fail("webhooks.initial-backoff", "must be positive")
+	}
+	if conf.Webhooks.MaxBackoff < conf.Webhooks.InitialBackoff {
+		v.fail("webhooks.max-backoff", "must not be shorter than webhooks.initial-backoff")
+	}
+	if conf.Webhooks.Timeout <= 0 {
+		v.fail("webhooks.timeout", "must be positive")
+	}
+	if conf.Webhooks.Workers < 1 {
+		v.fail("webhooks.workers", "must be at least 1")
+	}
+
+	// HTTP servers
+	for _, entry := range []struct {
+		key     string
+		timeout time.Duration
+	}{
+		{"server.read-timeout", conf.Server.ReadTimeout},
+		{"server.read-header-timeout", conf.Server.ReadHeaderTimeout},
+		{"server.write-timeout", conf.Server.WriteTimeout},
+		{"server.idle-timeout", conf.Server.IdleTimeout},
+	} {
+		if entry.timeout < 0 {
+			v.fail(entry.key, "must not be negative")
+		}
+	}
+	if conf.Server.ShutdownTimeout <= 0 {
+		v.fail("server.shutdown-timeout", "must be positive")
+	}
+	if conf.Server.StartupTimeout <= 0 {
+		v.fail("server.startup-timeout", "must be positive")
+	}
+	v.port("public-port", conf.PublicPort)
+	v.port("internal-port", conf.InternalPort)
+	if conf.PublicPort == conf.InternalPort {
+		v.fail("internal-port", "collides with public-port %d", conf.PublicPort)
+	}
+
+	if len(v.problems) > 0 {
+		return ValidationError{Problems: v.problems}
+	}
+	return nil
+}
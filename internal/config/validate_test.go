@@ -0,0 +1,153 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig returns a configuration that passes validation, reading its key from keyPath
+func validConfig(keyPath string) Config {
+	return Config{
+		ClusterConfig: Kubernetes{InCluster: true, NameSpace: "huemie"},
+		Adapters: Adapters{
+			DeviceStoreURL:       "http://device-store.huemie:8080",
+			DeviceStoreJWTSecret: "secret",
+			DefaultResources:     Resources{CPURequest: "50m", MemoryLimit: "256Mi"},
+			DefaultProbe:         Probe{Type: "http", Path: "/"},
+			ServiceAccount:       "huemie-adapter",
+		},
+		Auth:         Auth{RSAPublicKeyPath: keyPath, RolesClaim: "roles", AdminRole: "admin"},
+		Webhooks:     Webhooks{MaxAttempts: 8, InitialBackoff: time.Second, MaxBackoff: 5 * time.Minute, Timeout: 10 * time.Second, Workers: 4},
+		Database:     Database{Driver: "mysql", Host: "mariadb", Port: 3306, User: "attendant", Database: "attendant"},
+		Server:       Server{ShutdownTimeout: 30 * time.Second, StartupTimeout: 2 * time.Minute},
+		PublicPort:   8080,
+		InternalPort: 8081,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "public.pem")
+	if err := os.WriteFile(keyPath, []byte("key"), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	tests := []struct {
+		name     string
+		change   func(conf *Config)
+		problems []string
+	}{
+		{name: "valid", change: func(conf *Config) {}},
+		{
+			name:     "missing namespace",
+			change:   func(conf *Config) { conf.ClusterConfig.NameSpace = "" },
+			problems: []string{"kubernetes.adapter-namespace: must be set (set KUBERNETES_ADAPTER_NAMESPACE)"},
+		},
+		{
+			name:     "out of cluster without kubeconfig",
+			change:   func(conf *Config) { conf.ClusterConfig.InCluster = false },
+			problems: []string{"kubernetes.kubeconfig-path: must be set when not running in-cluster"},
+		},
+		{
+			name: "postgres by DSN",
+			change: func(conf *Config) {
+				conf.Database = Database{Driver: "postgres", DSN: "postgres://attendant@postgres/attendant"}
+			},
+		},
+		{
+			name:     "sqlite without path",
+			change:   func(conf *Config) { conf.Database = Database{Driver: "sqlite"} },
+			problems: []string{"database.path: must be set (set DATABASE_PATH)"},
+		},
+		{
+			name:     "unknown driver",
+			change:   func(conf *Config) { conf.Database.Driver = "oracle" },
+			problems: []string{`database.driver: "oracle" is not one of mysql, postgres or sqlite`},
+		},
+		{
+			name:     "unreadable public key",
+			change:   func(conf *Config) { conf.Auth.RSAPublicKeyPath = keyPath + ".missing" },
+			problems: []string{"auth.rsa-public-key-path: can not read"},
+		},
+		{
+			name:     "missing admin role",
+			change:   func(conf *Config) { conf.Auth.AdminRole = "" },
+			problems: []string{"auth.admin-role: must be set"},
+		},
+		{
+			name:     "invalid service account",
+			change:   func(conf *Config) { conf.Adapters.ServiceAccount = "Adapter_Account" },
+			problems: []string{`adapters.service-account: "Adapter_Account" is not a valid service account name`},
+		},
+		{
+			name:     "negative run as user",
+			change:   func(conf *Config) { conf.Adapters.RunAsUser = -1 },
+			problems: []string{"adapters.run-as-user: must not be negative"},
+		},
+		{
+			name:     "relative device store URL",
+			change:   func(conf *Config) { conf.Adapters.DeviceStoreURL = "device-store" },
+			problems: []string{`adapters.device-store-url: "device-store" is not an absolute URL`},
+		},
+		{
+			name:     "invalid quantity",
+			change:   func(conf *Config) { conf.Adapters.MaxResources.CPULimit = "two" },
+			problems: []string{`adapters.max-resources.cpu-limit: "two" is not a valid Kubernetes quantity`},
+		},
+		{
+			name:     "relative probe path",
+			change:   func(conf *Config) { conf.Adapters.DefaultProbe.Path = "healthz" },
+			problems: []string{`adapters.default-probe.path: "healthz" must start with /`},
+		},
+		{
+			name: "webhook backoff",
+			change: func(conf *Config) {
+				conf.Webhooks.MaxAttempts = 0
+				conf.Webhooks.MaxBackoff = time.Millisecond
+			},
+			problems: []string{"webhooks.max-attempts: must be at least 1", "webhooks.max-backoff: must not be shorter than webhooks.initial-backoff"},
+		},
+		{
+			name:     "no webhook workers",
+			change:   func(conf *Config) { conf.Webhooks.Workers = 0 },
+			problems: []string{"webhooks.workers: must be at least 1"},
+		},
+		{
+			name:     "no startup timeout",
+			change:   func(conf *Config) { conf.Server.StartupTimeout = 0 },
+			problems: []string{"server.startup-timeout: must be positive"},
+		},
+		{
+			name:     "colliding ports",
+			change:   func(conf *Config) { conf.InternalPort = conf.PublicPort },
+			problems: []string{"internal-port: collides with public-port 8080 (set INTERNAL_PORT)"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := validConfig(keyPath)
+			test.change(&conf)
+			err := conf.Validate()
+			if len(test.problems) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			var validationError ValidationError
+			if !errors.As(err, &validationError) {
+				t.Fatalf("Validate() error = %v, want a ValidationError", err)
+			}
+			if len(validationError.Problems) != len(test.problems) {
+				t.Fatalf("Validate() problems = %q, want %d", validationError.Problems, len(test.problems))
+			}
+			for index, problem := range test.problems {
+				if !strings.HasPrefix(validationError.Problems[index], problem) {
+					t.Errorf("problem %d = %q, want prefix %q", index, validationError.Problems[index], problem)
+				}
+			}
+		})
+	}
+}
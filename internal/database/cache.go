@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// cacheResync is how often the watch caches replay their content to event handlers
+	cacheResync = 10 * time.Minute
+	// endpointSliceServiceIndex indexes EndpointSlices by the Service they belong to
+	endpointSliceServiceIndex = "service"
+)
+
+// kubeCache keeps watched copies of adapter resources so that lookups
+// do not have to go to the Kubernetes API
+type kubeCache struct {
+	adapterFactory  informers.SharedInformerFactory
+	serviceFactory  informers.SharedInformerFactory
+	endpointFactory informers.SharedInformerFactory
+	services        corelisters.ServiceLister
+	deployments     appslisters.DeploymentLister
+	pods            corelisters.PodLister
+	endpointSlices  cache.SharedIndexInformer
+	hasSynced       []cache.InformerSynced
+	nameSpace       string
+
+	healthMu        sync.Mutex
+	health          map[int]adapterHealthState
+	healthListeners []HealthListener
+}
+
+func newKubeCache(handle KubeHandle) *kubeCache {
+	// Adapter resources are recognized by their labels, while EndpointSlices are
+	// labelled by the EndpointSlice controller and are matched on their Service name
+	adapterFactory := informers.NewSharedInformerFactoryWithOptions(handle.clientSet, cacheResync,
+		informers.WithNamespace(handle.nameSpace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labels.SelectorFromSet(labels.Set{"huemie-purpose": "device-adapter"}).String()
+		}),
+	)
+	// Services of adapters synced by older versions carry no labels, so they are matched on their name
+	serviceFactory := informers.NewSharedInformerFactoryWithOptions(handle.clientSet, cacheResync,
+		informers.WithNamespace(handle.nameSpace),
+	)
+	endpointFactory := informers.NewSharedInformerFactoryWithOptions(handle.clientSet, cacheResync,
+		informers.WithNamespace(handle.nameSpace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = discoveryv1.LabelServiceName
+		}),
+	)
+	serviceInformer := serviceFactory.Core().V1().Services()
+	endpointSliceInformer := endpointFactory.Discovery().V1().EndpointSlices().Informer()
+	endpointSliceInformer.AddIndexers(cache.Indexers{
+		endpointSliceServiceIndex: func(obj interface{}) ([]string, error) {
+			slice, ok := obj.(*discoveryv1.EndpointSlice)
+			if !ok {
+				return nil, nil
+			}
+			return []string{slice.Labels[discoveryv1.LabelServiceName]}, nil
+		},
+	})
+	deploymentInformer := adapterFactory.Apps().V1().Deployments()
+	podInformer := adapterFactory.Core().V1().Pods()
+	kc := &kubeCache{
+		adapterFactory:  adapterFactory,
+		serviceFactory:  serviceFactory,
+		endpointFactory: endpointFactory,
+		services:        serviceInformer.Lister(),
+		deployments:     deploymentInformer.Lister(),
+		pods:            podInformer.Lister(),
+		endpointSlices:  endpointSliceInformer,
+		hasSynced: []cache.InformerSynced{
+			serviceInformer.Informer().HasSynced,
+			deploymentInformer.Informer().HasSynced,
+			podInformer.Informer().HasSynced,
+			endpointSliceInformer.HasSynced,
+		},
+		nameSpace: handle.nameSpace,
+		health:    map[int]adapterHealthState{},
+	}
+	// Any change to a Deployment or Pod may change the health of the adapter it belongs to
+	healthHandler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    kc.onAdapterObject,
+		UpdateFunc: func(_, obj interface{}) { kc.onAdapterObject(obj) },
+		DeleteFunc: kc.onAdapterObject,
+	}
+	deploymentInformer.Informer().AddEventHandler(healthHandler)
+	podInformer.Informer().AddEventHandler(healthHandler)
+	return kc
+}
+
+// onAdapterObject recomputes the health of the adapter owning a watched object
+func (kc *kubeCache) onAdapterObject(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	object, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+	adapterId, ok := adapterIdFromResourceName(object.GetLabels()["huemie-adapter"])
+	if !ok {
+		return
+	}
+	kc.updateHealth(adapterId)
+}
+
+// updateHealth recomputes the health of an adapter and notifies listeners if it changed.
+// Listeners are not notified before the initial listing has completed, since that
+// would report every adapter as changed on startup.
+func (kc *kubeCache) updateHealth(adapterId int) {
+	resourceName := adapterResourceName(adapterId)
+	deployment, err := kc.deployments.Deployments(kc.nameSpace).Get(resourceName)
+	if err != nil {
+		deployment = nil
+	}
+	pods, err := kc.pods.Pods(kc.nameSpace).List(labels.SelectorFromSet(labels.Set{"huemie-adapter": resourceName}))
+	if err != nil {
+		pods = nil
+	}
+	health, reason := adapterHealth(deployment, pods)
+
+	kc.healthMu.Lock()
+	previous, known := kc.health[adapterId]
+	current := adapterHealthState{health: health, reason: reason}
+	if health == HealthMissing {
+		delete(kc.health, adapterId)
+	} else {
+		kc.health[adapterId] = current
+	}
+	listeners := kc.healthListeners
+	kc.healthMu.Unlock()
+
+	if (known && previous == current) || (!known && health == HealthMissing) || !kc.synced() {
+		return
+	}
+	for _, listener := range listeners {
+		listener(adapterId, health, reason)
+	}
+}
+
+func (kc *kubeCache) synced() bool {
+	for _, hasSynced := range kc.hasSynced {
+		if !hasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// HealthCounts returns the number of adapter workloads in each health state
+func (handle KubeHandle) HealthCounts() map[string]int {
+	handle.cache.healthMu.Lock()
+	defer handle.cache.healthMu.Unlock()
+	counts := map[string]int{}
+	for _, state := range handle.cache.health {
+		counts[state.health]++
+	}
+	return counts
+}
+
+// OnHealthChanged registers a listener for adapter health changes
+func (handle KubeHandle) OnHealthChanged(listener HealthListener) {
+	handle.cache.healthMu.Lock()
+	defer handle.cache.healthMu.Unlock()
+	handle.cache.healthListeners = append(handle.cache.healthListeners, listener)
+}
+
+// start runs the watches until ctx is cancelled and waits up to syncTimeout for the initial listing
+func (kc *kubeCache) start(ctx context.Context, syncTimeout time.Duration) error {
+	kc.adapterFactory.Start(ctx.Done())
+	kc.serviceFactory.Start(ctx.Done())
+	kc.endpointFactory.Start(ctx.Done())
+	syncCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), kc.hasSynced...) {
+		if ctx.Err() != nil {
+			return errors.Wrap(ctx.Err(), "stopped waiting for Kubernetes caches to sync")
+		}
+		return fmt.Errorf("timed out waiting %s for Kubernetes caches to sync", syncTimeout)
+	}
+	return nil
+}
+
+// Start runs the Kubernetes watches backing the handle until ctx is cancelled.
+// It returns once the caches have been populated, or with an error after syncTimeout.
+func (handle KubeHandle) Start(ctx context.Context, syncTimeout time.Duration) error {
+	return handle.cache.start(ctx, syncTimeout)
+}
+
+// countEndpoints counts ready and total endpoints of a Service
+func (kc *kubeCache) countEndpoints(serviceName string) (ready int, total int, err error) {
+	slices, err := kc.endpointSlices.GetIndexer().ByIndex(endpointSliceServiceIndex, serviceName)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, obj := range slices {
+		slice, ok := obj.(*discoveryv1.EndpointSlice)
+		if !ok {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			total++
+			// A nil ready condition is to be interpreted as ready
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				ready++
+			}
+		}
+	}
+	return ready, total, nil
+}
+
+// cachedService returns the watched Service with the given name, or nil if it does not exist
+func (kc *kubeCache) cachedService(name string, namespace string) (*corev1.Service, error) {
+	service, err := kc.services.Services(namespace).Get(name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to get service from cache")
+	}
+	return service, nil
+}
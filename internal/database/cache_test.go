@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestCountEndpoints(t *testing.T) {
+	// The watches are never started, the cache is filled in by hand
+	kc := newKubeCache(KubeHandle{clientSet: kubernetes.NewForConfigOrDie(&rest.Config{Host: "http://127.0.0.1:1"}), nameSpace: "huemie"})
+	ready, notReady := true, false
+	slice := func(name string, serviceName string, conditions ...*bool) *discoveryv1.EndpointSlice {
+		endpoints := []discoveryv1.Endpoint{}
+		for _, condition := range conditions {
+			endpoints = append(endpoints, discoveryv1.Endpoint{Conditions: discoveryv1.EndpointConditions{Ready: condition}})
+		}
+		return &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "huemie", Labels: map[string]string{discoveryv1.LabelServiceName: serviceName}},
+			Endpoints:  endpoints,
+		}
+	}
+	for _, endpointSlice := range []*discoveryv1.EndpointSlice{
+		slice("adapter-1-a", "adapter-1", &ready, &notReady),
+		slice("adapter-1-b", "adapter-1", nil),
+		slice("adapter-2-a", "adapter-2", &notReady),
+	} {
+		if err := kc.endpointSlices.GetIndexer().Add(endpointSlice); err != nil {
+			t.Fatalf("failed to add endpoint slice: %v", err)
+		}
+	}
+	tests := []struct {
+		serviceName string
+		ready       int
+		total       int
+	}{
+		{serviceName: "adapter-1", ready: 2, total: 3},
+		{serviceName: "adapter-2", ready: 0, total: 1},
+		{serviceName: "adapter-3", ready: 0, total: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.serviceName, func(t *testing.T) {
+			ready, total, err := kc.countEndpoints(test.serviceName)
+			if err != nil {
+				t.Fatalf("countEndpoints() error = %v", err)
+			}
+			if ready != test.ready || total != test.total {
+				t.Errorf("countEndpoints() = %d, %d, want %d, %d", ready, total, test.ready, test.total)
+			}
+		})
+	}
+}
+
+func TestStartUnreachable(t *testing.T) {
+	tests := []struct {
+		name    string
+		cancel  bool
+		wantErr string
+	}{
+		{name: "sync timeout", wantErr: "timed out waiting"},
+		{name: "stopped", cancel: true, wantErr: "stopped waiting"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kc := newKubeCache(KubeHandle{clientSet: kubernetes.NewForConfigOrDie(&rest.Config{Host: "http://127.0.0.1:1"}), nameSpace: "huemie"})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancel {
+				cancel()
+			}
+			err := kc.start(ctx, 100*time.Millisecond)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("start() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
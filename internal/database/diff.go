@@ -0,0 +1,103 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ignoredDiffPaths are fields that change on every apply, or are maintained by Kubernetes,
+// and would drown out the changes that matter
+var ignoredDiffPaths = map[string]bool{
+	"status":                     true,
+	"metadata.managedFields":     true,
+	"metadata.resourceVersion":   true,
+	"metadata.uid":               true,
+	"metadata.creationTimestamp": true,
+	"metadata.generation":        true,
+	"metadata.annotations.deployment.kubernetes.io/revision": true,
+	// The enrollment token is regenerated on every sync and is a credential
+	"data." + enrollTokenKey: true,
+}
+
+// diffObjects compares the live state of an object with the state after applying it.
+// live is nil when the object does not exist yet.
+func diffObjects(kind string, name string, live runtime.Object, desired runtime.Object) (models.ObjectDiff, error) {
+	diff := models.ObjectDiff{Kind: kind, Name: name, Action: "create"}
+	if live == nil || reflect.ValueOf(live).IsNil() {
+		return diff, nil
+	}
+	liveContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(live)
+	if err != nil {
+		return diff, errors.Wrapf(err, "failed to convert live %s", kind)
+	}
+	desiredContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return diff, errors.Wrapf(err, "failed to convert desired %s", kind)
+	}
+	diff.Changes = diffValues("", liveContent, desiredContent, []models.FieldChange{})
+	sort.Slice(diff.Changes, func(i, j int) bool { return diff.Changes[i].Path < diff.Changes[j].Path })
+	diff.Action = "update"
+	if len(diff.Changes) == 0 {
+		diff.Action = "unchanged"
+	}
+	return diff, nil
+}
+
+// diffValues appends the differences between two unstructured values to changes
+func diffValues(path string, before any, after any, changes []models.FieldChange) []models.FieldChange {
+	if ignoredDiffPaths[path] {
+		return changes
+	}
+	beforeMap, beforeIsMap := before.(map[string]any)
+	afterMap, afterIsMap := after.(map[string]any)
+	if beforeIsMap && afterIsMap {
+		keys := map[string]bool{}
+		for key := range beforeMap {
+			keys[key] = true
+		}
+		for key := range afterMap {
+			keys[key] = true
+		}
+		for key := range keys {
+			changes = diffValues(joinPath(path, key), beforeMap[key], afterMap[key], changes)
+		}
+		return changes
+	}
+	beforeList, beforeIsList := before.([]any)
+	afterList, afterIsList := after.([]any)
+	if beforeIsList && afterIsList && len(beforeList) == len(afterList) {
+		for i := range beforeList {
+			changes = diffValues(fmt.Sprintf("%s[%d]", path, i), beforeList[i], afterList[i], changes)
+		}
+		return changes
+	}
+	if reflect.DeepEqual(before, after) || (isEmpty(before) && isEmpty(after)) {
+		return changes
+	}
+	return append(changes, models.FieldChange{Path: path, Before: before, After: after})
+}
+
+// isEmpty reports whether a value is unset, Kubernetes drops empty maps and lists on the way
+func isEmpty(value any) bool {
+	switch typed := value.(type) {
+	case nil:
+		return true
+	case map[string]any:
+		return len(typed) == 0
+	case []any:
+		return len(typed) == 0
+	}
+	return false
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
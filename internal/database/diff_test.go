@@ -0,0 +1,80 @@
+package database
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+)
+
+func TestDiffValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		before any
+		after  any
+		want   []models.FieldChange
+	}{
+		{
+			name:   "equal",
+			before: map[string]any{"spec": map[string]any{"replicas": int64(1)}},
+			after:  map[string]any{"spec": map[string]any{"replicas": int64(1)}},
+			want:   []models.FieldChange{},
+		},
+		{
+			name:   "changed field",
+			before: map[string]any{"spec": map[string]any{"replicas": int64(1)}},
+			after:  map[string]any{"spec": map[string]any{"replicas": int64(2)}},
+			want:   []models.FieldChange{{Path: "spec.replicas", Before: int64(1), After: int64(2)}},
+		},
+		{
+			name:   "added and removed fields",
+			before: map[string]any{"data": map[string]any{"A": "1"}},
+			after:  map[string]any{"data": map[string]any{"B": "2"}},
+			want: []models.FieldChange{
+				{Path: "data.A", Before: "1", After: nil},
+				{Path: "data.B", Before: nil, After: "2"},
+			},
+		},
+		{
+			name:   "list elements",
+			before: map[string]any{"ports": []any{map[string]any{"port": int64(80)}}},
+			after:  map[string]any{"ports": []any{map[string]any{"port": int64(8080)}}},
+			want:   []models.FieldChange{{Path: "ports[0].port", Before: int64(80), After: int64(8080)}},
+		},
+		{
+			name:   "lists of different length",
+			before: map[string]any{"args": []any{"a"}},
+			after:  map[string]any{"args": []any{"a", "b"}},
+			want:   []models.FieldChange{{Path: "args", Before: []any{"a"}, After: []any{"a", "b"}}},
+		},
+		{
+			name:   "empty and missing",
+			before: map[string]any{"labels": map[string]any{}, "args": []any{}},
+			after:  map[string]any{},
+			want:   []models.FieldChange{},
+		},
+		{
+			name: "ignored paths",
+			before: map[string]any{
+				"status":   map[string]any{"replicas": int64(1)},
+				"metadata": map[string]any{"resourceVersion": "1", "generation": int64(1)},
+				"data":     map[string]any{enrollTokenKey: "old"},
+			},
+			after: map[string]any{
+				"metadata": map[string]any{"resourceVersion": "2", "generation": int64(2)},
+				"data":     map[string]any{enrollTokenKey: "new"},
+			},
+			want: []models.FieldChange{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := diffValues("", test.before, test.after, []models.FieldChange{})
+			sort.Slice(got, func(i, j int) bool { return got[i].Path < got[j].Path })
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("diffValues() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
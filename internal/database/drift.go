@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// DesiredAdapter is an adapter along with its configuration, as stored in the database
+type DesiredAdapter struct {
+	Adapter       models.Adapter
+	Configuration map[string]string
+}
+
+// DriftReport compares adapters with their live objects and finds adapter objects
+// belonging to no adapter. Deployments are read from the watch cache, Services and
+// ConfigMaps from the API, as those applied by older versions carry no labels.
+func (handle KubeHandle) DriftReport(ctx context.Context, adapters []DesiredAdapter) (models.DriftReport, error) {
+	configMapList, err := handle.clientSet.CoreV1().ConfigMaps(handle.nameSpace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return models.DriftReport{}, errors.Wrap(err, "failed to list config maps")
+	}
+	configMaps := map[string]*corev1.ConfigMap{}
+	for i := range configMapList.Items {
+		configMaps[configMapList.Items[i].Name] = &configMapList.Items[i]
+	}
+	serviceList, err := handle.clientSet.CoreV1().Services(handle.nameSpace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return models.DriftReport{}, errors.Wrap(err, "failed to list services")
+	}
+	services := map[string]*corev1.Service{}
+	for i := range serviceList.Items {
+		services[serviceList.Items[i].Name] = &serviceList.Items[i]
+	}
+	report := models.DriftReport{Adapters: []models.AdapterDrift{}, Orphans: []models.DriftObject{}}
+	known := map[int]bool{}
+	for _, desired := range adapters {
+		known[desired.Adapter.ID] = true
+		report.Adapters = append(report.Adapters, handle.adapterDrift(desired, services, configMaps))
+	}
+	orphans, err := handle.orphans(known, services, configMaps)
+	if err != nil {
+		return models.DriftReport{}, err
+	}
+	report.Orphans = orphans
+	return report, nil
+}
+
+// adapterDrift compares a single adapter with its live objects
+func (handle KubeHandle) adapterDrift(desired DesiredAdapter, services map[string]*corev1.Service, configMaps map[string]*corev1.ConfigMap) models.AdapterDrift {
+	adapter := desired.Adapter
+	resourceName := adapterResourceName(adapter.ID)
+	drift := models.AdapterDrift{AdapterID: adapter.ID, Name: adapter.Name}
+	if adapter.Synced == nil || adapter.Updated.After(*adapter.Synced) {
+		drift.Unsynced = &models.UnsyncedDrift{Updated: adapter.Updated, Synced: adapter.Synced}
+	}
+
+	deployment, err := handle.cache.deployments.Deployments(handle.nameSpace).Get(resourceName)
+	if err != nil {
+		drift.Missing = append(drift.Missing, "Deployment")
+		deployment = nil
+	}
+	service := services[resourceName]
+	if service == nil {
+		drift.Missing = append(drift.Missing, "Service")
+	}
+	configName := resourceName
+	if deployment != nil && configMapReference(deployment.Spec.Template.Spec) != "" {
+		configName = configMapReference(deployment.Spec.Template.Spec)
+	}
+	configMap := configMaps[configName]
+	if configMap == nil {
+		drift.Missing = append(drift.Missing, "ConfigMap")
+	}
+
+	if deployment != nil {
+		desiredImage := adapter.SyncedImage()
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			if container.Name == resourceName && container.Image != desiredImage {
+				drift.Image = &models.ImageDrift{Desired: desiredImage, Live: container.Image}
+			}
+		}
+		drift.ModifiedBy = append(drift.ModifiedBy, foreignManagers("Deployment", deployment.ObjectMeta)...)
+	}
+	if service != nil {
+		drift.ModifiedBy = append(drift.ModifiedBy, foreignManagers("Service", service.ObjectMeta)...)
+	}
+	if configMap != nil {
+		drift.EnvKeys = envKeyDrift(adapterEnvironment(desired.Configuration), configMap.Data)
+		drift.ModifiedBy = append(drift.ModifiedBy, foreignManagers("ConfigMap", configMap.ObjectMeta)...)
+	}
+	drift.Drifted = drift.Unsynced != nil || len(drift.Missing) > 0 || drift.Image != nil || drift.EnvKeys != nil || len(drift.ModifiedBy) > 0
+	return drift
+}
+
+// envKeyDrift compares the desired environment of an adapter with a live ConfigMap,
+// returning nil if they match
+func envKeyDrift(desired map[string]string, live map[string]string) *models.EnvKeyDrift {
+	drift := models.EnvKeyDrift{}
+	for key, value := range desired {
+		liveValue, ok := live[key]
+		if !ok {
+			drift.Added = append(drift.Added, key)
+		} else if liveValue != value {
+			drift.Changed = append(drift.Changed, key)
+		}
+	}
+	for key := range live {
+		if _, ok := desired[key]; !ok && key != enrollTokenKey {
+			drift.Removed = append(drift.Removed, key)
+		}
+	}
+	if len(drift.Added) == 0 && len(drift.Removed) == 0 && len(drift.Changed) == 0 {
+		return nil
+	}
+	sort.Strings(drift.Added)
+	sort.Strings(drift.Removed)
+	sort.Strings(drift.Changed)
+	return &drift
+}
+
+// foreignManagers lists the field managers other than the attendant that changed an object.
+// Status updates by controllers are not changes to what the attendant applied.
+func foreignManagers(kind string, object metav1.ObjectMeta) []models.FieldManagerDrift {
+	managers := []models.FieldManagerDrift{}
+	for _, entry := range object.ManagedFields {
+		if entry.Manager == fieldManager || entry.Subresource != "" || !ownsUserFields(entry) {
+			continue
+		}
+		manager := models.FieldManagerDrift{Kind: kind, Name: object.Name, Manager: entry.Manager, Operation: string(entry.Operation)}
+		if entry.Time != nil {
+			manager.Time = &entry.Time.Time
+		}
+		managers = append(managers, manager)
+	}
+	return managers
+}
+
+// systemFields are owned by controllers outside of the status subresource
+var systemFields = map[string]bool{
+	"f:metadata.f:annotations.f:deployment.kubernetes.io/revision": true,
+}
+
+// ownsUserFields reports whether a managed fields entry owns anything besides system fields
+func ownsUserFields(entry metav1.ManagedFieldsEntry) bool {
+	if entry.FieldsV1 == nil {
+		return false
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+		// Unknown formats are reported rather than hidden
+		return true
+	}
+	return hasUserFields("", fields)
+}
+
+func hasUserFields(path string, fields map[string]any) bool {
+	for key, value := range fields {
+		// "." marks the field itself, its children are listed next to it
+		if key == "." {
+			continue
+		}
+		fieldPath := joinPath(path, key)
+		if systemFields[fieldPath] {
+			continue
+		}
+		children, _ := value.(map[string]any)
+		if len(children) == 0 || hasUserFields(fieldPath, children) {
+			return true
+		}
+	}
+	return false
+}
+
+// orphans lists adapter objects whose adapter does not exist
+func (handle KubeHandle) orphans(known map[int]bool, services map[string]*corev1.Service, configMaps map[string]*corev1.ConfigMap) ([]models.DriftObject, error) {
+	orphans := []models.DriftObject{}
+	deployments, err := handle.cache.deployments.Deployments(handle.nameSpace).List(labels.Everything())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list deployments from cache")
+	}
+	for _, deployment := range deployments {
+		if adapterId, ok := adapterIdFromResourceName(deployment.Name); ok && !known[adapterId] {
+			orphans = append(orphans, models.DriftObject{Kind: "Deployment", Name: deployment.Name})
+		}
+	}
+	for name := range services {
+		if adapterId, ok := adapterIdFromResourceName(name); ok && !known[adapterId] {
+			orphans = append(orphans, models.DriftObject{Kind: "Service", Name: name})
+		}
+	}
+	for name, configMap := range configMaps {
+		// ConfigMaps named after their content carry the name of the adapter in a label
+		owner := configMap.Labels["huemie-adapter"]
+		if owner == "" {
+			owner = name
+		}
+		if adapterId, ok := adapterIdFromResourceName(owner); ok && !known[adapterId] {
+			orphans = append(orphans, models.DriftObject{Kind: "ConfigMap", Name: name})
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Kind != orphans[j].Kind {
+			return orphans[i].Kind < orphans[j].Kind
+		}
+		return orphans[i].Name < orphans[j].Name
+	})
+	return orphans, nil
+}
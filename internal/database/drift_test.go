@@ -0,0 +1,49 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+)
+
+func TestEnvKeyDrift(t *testing.T) {
+	tests := []struct {
+		name    string
+		desired map[string]string
+		live    map[string]string
+		want    *models.EnvKeyDrift
+	}{
+		{
+			name:    "in sync",
+			desired: map[string]string{"A": "1", "B": "2"},
+			live:    map[string]string{"A": "1", "B": "2"},
+			want:    nil,
+		},
+		{
+			name:    "enrollment token is not drift",
+			desired: map[string]string{"A": "1"},
+			live:    map[string]string{"A": "1", enrollTokenKey: "token"},
+			want:    nil,
+		},
+		{
+			name:    "added, removed and changed",
+			desired: map[string]string{"A": "1", "C": "3", "D": "4", "E": "5"},
+			live:    map[string]string{"A": "0", "B": "2", "E": "5", "F": "6"},
+			want:    &models.EnvKeyDrift{Added: []string{"C", "D"}, Removed: []string{"B", "F"}, Changed: []string{"A"}},
+		},
+		{
+			name:    "missing ConfigMap",
+			desired: map[string]string{"A": "1"},
+			live:    nil,
+			want:    &models.EnvKeyDrift{Added: []string{"A"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := envKeyDrift(test.desired, test.live); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("envKeyDrift() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
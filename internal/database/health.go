@@ -0,0 +1,81 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Health states of an adapter workload
+const (
+	HealthHealthy     = "healthy"
+	HealthProgressing = "progressing"
+	HealthDegraded    = "degraded"
+	HealthFailed      = "failed"
+	HealthMissing     = "missing"
+)
+
+// HealthListener is called whenever the health of an adapter workload changes
+type HealthListener func(adapterId int, health string, reason string)
+
+type adapterHealthState struct {
+	health string
+	reason string
+}
+
+// adapterIdFromResourceName parses the adapter Id out of a name produced by adapterResourceName
+func adapterIdFromResourceName(name string) (int, bool) {
+	idString, found := strings.CutPrefix(name, "adapter-")
+	if !found {
+		return 0, false
+	}
+	adapterId, err := strconv.Atoi(idString)
+	if err != nil {
+		return 0, false
+	}
+	return adapterId, true
+}
+
+// podProblem returns the reason a pod is failing, or an empty string
+func podProblem(pod *corev1.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil {
+			switch status.State.Waiting.Reason {
+			case "CrashLoopBackOff", "ImagePullBackOff", "ErrImagePull", "CreateContainerConfigError", "InvalidImageName":
+				return fmt.Sprintf("pod %s: %s", pod.Name, status.State.Waiting.Reason)
+			}
+		}
+	}
+	return ""
+}
+
+// adapterHealth derives the health of an adapter from its Deployment and Pods
+func adapterHealth(deployment *appsv1.Deployment, pods []*corev1.Pod) (string, string) {
+	if deployment == nil {
+		return HealthMissing, "deployment does not exist"
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse && condition.Reason == "ProgressDeadlineExceeded" {
+			return HealthFailed, condition.Message
+		}
+	}
+	for _, pod := range pods {
+		if problem := podProblem(pod); problem != "" {
+			return HealthDegraded, problem
+		}
+	}
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	if deployment.Status.ObservedGeneration < deployment.Generation || deployment.Status.UpdatedReplicas < desired {
+		return HealthProgressing, "rollout in progress"
+	}
+	if deployment.Status.AvailableReplicas < desired {
+		return HealthProgressing, fmt.Sprintf("%d of %d replicas available", deployment.Status.AvailableReplicas, desired)
+	}
+	return HealthHealthy, ""
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAdapterHealth(t *testing.T) {
+	deployment := func(generation int64, observed int64, updated int32, available int32, conditions ...appsv1.DeploymentCondition) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "adapter-1", Generation: generation},
+			Status:     appsv1.DeploymentStatus{ObservedGeneration: observed, UpdatedReplicas: updated, AvailableReplicas: available, Conditions: conditions},
+		}
+	}
+	waitingPod := func(reason string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "adapter-1-abc"},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}}},
+			}},
+		}
+	}
+	tests := []struct {
+		name       string
+		deployment *appsv1.Deployment
+		pods       []*corev1.Pod
+		want       string
+	}{
+		{name: "missing", want: HealthMissing},
+		{name: "healthy", deployment: deployment(2, 2, 1, 1), want: HealthHealthy},
+		{name: "generation not observed", deployment: deployment(3, 2, 1, 1), want: HealthProgressing},
+		{name: "replica not available", deployment: deployment(2, 2, 1, 0), want: HealthProgressing},
+		{name: "pod still creating", deployment: deployment(2, 2, 1, 0), pods: []*corev1.Pod{waitingPod("ContainerCreating")}, want: HealthProgressing},
+		{name: "crash looping pod", deployment: deployment(2, 2, 1, 0), pods: []*corev1.Pod{waitingPod("CrashLoopBackOff")}, want: HealthDegraded},
+		{
+			name: "progress deadline exceeded",
+			deployment: deployment(2, 2, 0, 0, appsv1.DeploymentCondition{
+				Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded",
+			}),
+			pods: []*corev1.Pod{waitingPod("ImagePullBackOff")},
+			want: HealthFailed,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, reason := adapterHealth(test.deployment, test.pods); got != test.want {
+				t.Errorf("adapterHealth() = %q (%s), want %q", got, reason, test.want)
+			}
+		})
+	}
+}
+
+func TestAdapterIdFromResourceName(t *testing.T) {
+	tests := []struct {
+		name   string
+		wantId int
+		wantOk bool
+	}{
+		{name: "adapter-12", wantId: 12, wantOk: true},
+		{name: "adapter-", wantOk: false},
+		{name: "adapter-12-abc", wantOk: false},
+		{name: "device-store", wantOk: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			adapterId, ok := adapterIdFromResourceName(test.name)
+			if adapterId != test.wantId || ok != test.wantOk {
+				t.Errorf("adapterIdFromResourceName() = %d, %v, want %d, %v", adapterId, ok, test.wantId, test.wantOk)
+			}
+		})
+	}
+}
@@ -2,16 +2,27 @@ package database
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"sort"
 	"time"
 
 	"github.com/Kaese72/adapter-attendant/internal/config"
 	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/internal/registry"
 	"github.com/Kaese72/adapter-attendant/internal/utility"
+	"github.com/Kaese72/adapter-attendant/rest/models"
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	appsapplyv1 "k8s.io/client-go/applyconfigurations/apps/v1"
 	coreapplyv1 "k8s.io/client-go/applyconfigurations/core/v1"
@@ -21,9 +32,26 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+const (
+	// applyTimeout bounds how long applying an adapter may take
+	applyTimeout = 2 * time.Minute
+	// enrollTokenKey is the configuration key holding the enrollment token of an adapter
+	enrollTokenKey = "HUEMIE_ENROLL_TOKEN"
+	// configMapHashLength is the number of hex digits of the content hash in ConfigMap names
+	configMapHashLength = 10
+	// fieldManager owns the fields applied by the attendant
+	fieldManager = "adapter-attendant"
+)
+
 type KubeHandle struct {
 	clientSet *kubernetes.Clientset
 	nameSpace string
+	cache     *kubeCache
+}
+
+// adapterResourceName is the name shared by all Kubernetes resources of an adapter
+func adapterResourceName(adapterId int) string {
+	return fmt.Sprintf("adapter-%d", adapterId)
 }
 
 func adapterLabels(adapterName string) map[string]string {
@@ -34,79 +62,437 @@ func adapterLabels(adapterName string) map[string]string {
 	}
 }
 
-func (handle KubeHandle) applyConfig(ctx context.Context, resourceName string, configuration map[string]string) (*corev1.ConfigMap, error) {
+// configMapName names the ConfigMap of an adapter after its content, so that a configuration
+// change is a new ConfigMap referenced by a new pod template, which rolls the Deployment.
+// The enrollment token is left out as it is regenerated on every sync, the secret signing
+// it is included since rotating it invalidates the tokens of running pods.
+func configMapName(resourceName string, configuration map[string]string, tokenSecret string) string {
+	keys := make([]string, 0, len(configuration))
+	for key := range configuration {
+		if key != enrollTokenKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	hash := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%s\x00", key, configuration[key])
+	}
+	fmt.Fprintf(hash, "%s\x00", tokenSecret)
+	return fmt.Sprintf("%s-%s", resourceName, hex.EncodeToString(hash.Sum(nil))[:configMapHashLength])
+}
+
+// applyOptions returns the options of server-side apply, dry runs are validated and
+// defaulted by the API server without being persisted
+func applyOptions(dryRun bool) metav1.ApplyOptions {
+	options := metav1.ApplyOptions{FieldManager: fieldManager}
+	if dryRun {
+		options.DryRun = []string{metav1.DryRunAll}
+	}
+	return options
+}
+
+func (handle KubeHandle) applyConfig(ctx context.Context, resourceName string, configMapName string, configuration map[string]string, options metav1.ApplyOptions) (*corev1.ConfigMap, error) {
 	// FIXME Define builtin non-overridable configuration
 	// FIXME Deep copy
-	adapterConfig := coreapplyv1.ConfigMapApplyConfiguration{
-		TypeMetaApplyConfiguration:   *metaapplyv1.TypeMeta().WithKind("ConfigMap").WithAPIVersion("v1"),
-		ObjectMetaApplyConfiguration: metaapplyv1.ObjectMeta().WithName(resourceName).WithNamespace(handle.nameSpace),
-		Data:                         configuration,
-	}
-	configMap, err := handle.clientSet.CoreV1().ConfigMaps(handle.nameSpace).Apply(ctx, &adapterConfig, metav1.ApplyOptions{FieldManager: "adapter-attendant"})
+	adapterConfig := coreapplyv1.ConfigMap(configMapName, handle.nameSpace).WithLabels(adapterLabels(resourceName)).WithData(configuration)
+	configMap, err := handle.clientSet.CoreV1().ConfigMaps(handle.nameSpace).Apply(ctx, adapterConfig, options)
 	return configMap, errors.Wrap(err, "failed to apply config map")
 }
 
-func (handle KubeHandle) applyDeployment(resourceName string, image string, ctx context.Context) (*appsv1.Deployment, *corev1.Service, error) {
+// referencedConfigMap returns the ConfigMap the Deployment of an adapter refers to, if any.
+// It is read from the API, as the cache may not have seen the last sync yet.
+func (handle KubeHandle) referencedConfigMap(ctx context.Context, resourceName string) string {
+	deployment, err := handle.clientSet.AppsV1().Deployments(handle.nameSpace).Get(ctx, resourceName, metav1.GetOptions{})
+	if err != nil {
+		return ""
+	}
+	return configMapReference(deployment.Spec.Template.Spec)
+}
+
+// configMapReference returns the ConfigMap the containers of a pod take their environment from
+func configMapReference(podSpec corev1.PodSpec) string {
+	for _, container := range podSpec.Containers {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				return envFrom.ConfigMapRef.Name
+			}
+		}
+	}
+	return ""
+}
+
+// collectConfigMaps deletes the ConfigMaps of an adapter other than those to keep and those
+// referred to by its ReplicaSets, which the Deployment keeps around to be rolled back to.
+// Failing to do so does not fail the sync, leftovers are collected by the next one.
+func (handle KubeHandle) collectConfigMaps(ctx context.Context, resourceName string, keep ...string) {
+	selector := labels.SelectorFromSet(labels.Set{"huemie-adapter": resourceName}).String()
+	replicaSets, err := handle.clientSet.AppsV1().ReplicaSets(handle.nameSpace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		logging.Error("Error listing replica sets to collect config maps", ctx, map[string]interface{}{"ERROR": err.Error(), "RESOURCE_NAME": resourceName})
+		return
+	}
+	for _, replicaSet := range replicaSets.Items {
+		if reference := configMapReference(replicaSet.Spec.Template.Spec); reference != "" {
+			keep = append(keep, reference)
+		}
+	}
+	configMaps, err := handle.clientSet.CoreV1().ConfigMaps(handle.nameSpace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		logging.Error("Error listing config maps to collect", ctx, map[string]interface{}{"ERROR": err.Error(), "RESOURCE_NAME": resourceName})
+		return
+	}
+	names := []string{}
+	for _, configMap := range configMaps.Items {
+		names = append(names, configMap.Name)
+	}
+	// ConfigMaps applied before they were named after their content carry no labels
+	names = append(names, resourceName)
+	for _, name := range names {
+		if slices.Contains(keep, name) {
+			continue
+		}
+		err := handle.clientSet.CoreV1().ConfigMaps(handle.nameSpace).Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			logging.Error("Error collecting config map", ctx, map[string]interface{}{"ERROR": err.Error(), "CONFIG_MAP": name})
+		}
+	}
+}
+
+// adapterContainer builds the container spec for an adapter.
+// The returned error is suitable for showing to the user.
+func adapterContainer(configMapName string, resourceName string, adapter models.Adapter) (*coreapplyv1.ContainerApplyConfiguration, error) {
+	resources, err := AdapterResourceRequirements(adapter.Resources)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateAdapterNetwork(adapter.Network); err != nil {
+		return nil, err
+	}
+	if err := ValidateAdapterSecurity(adapter.Security); err != nil {
+		return nil, err
+	}
+	network := AdapterNetworkWithDefaults(adapter.Network)
+	liveness, readiness, startup, err := adapterContainerProbes(adapter.Probes, network.ContainerPort)
+	if err != nil {
+		return nil, err
+	}
+	privateEnvs := coreapplyv1.EnvFromSource().WithConfigMapRef(coreapplyv1.ConfigMapEnvSource().WithName(configMapName))
+	resourceSpec := coreapplyv1.ResourceRequirements().WithRequests(resources.Requests).WithLimits(resources.Limits)
+	portSpec := coreapplyv1.ContainerPort().WithName(adapterPortName).WithContainerPort(int32(network.ContainerPort)).WithProtocol(corev1.ProtocolTCP)
+	containerSpec := coreapplyv1.Container().WithName(resourceName).WithImage(adapter.Image()).WithEnvFrom(privateEnvs).WithResources(resourceSpec).WithPorts(portSpec)
+	if liveness != nil {
+		containerSpec = containerSpec.WithLivenessProbe(liveness)
+	}
+	if readiness != nil {
+		containerSpec = containerSpec.WithReadinessProbe(readiness)
+	}
+	if startup != nil {
+		containerSpec = containerSpec.WithStartupProbe(startup)
+	}
+	return containerSpec, nil
+}
+
+// PullCredential is a decrypted registry credential an adapter pulls its image with
+type PullCredential struct {
+	Registry string
+	Username string
+	Password string
+}
+
+// pullSecretName is the name of the Secret holding the pull credential of an adapter
+func pullSecretName(resourceName string) string {
+	return resourceName + "-registry"
+}
+
+// dockerConfigJSON renders a pull credential in the format of kubernetes.io/dockerconfigjson Secrets
+func dockerConfigJSON(credential PullCredential) ([]byte, error) {
+	// The kubelet knows Docker Hub by its legacy index address
+	server := credential.Registry
+	if registry.NormalizeHost(server) == registry.NormalizeHost("docker.io") {
+		server = "https://index.docker.io/v1/"
+	}
+	type auth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	}
+	encoded, err := json.Marshal(map[string]map[string]auth{
+		"auths": {server: {
+			Username: credential.Username,
+			Password: credential.Password,
+			Auth:     base64.StdEncoding.EncodeToString([]byte(credential.Username + ":" + credential.Password)),
+		}},
+	})
+	return encoded, errors.Wrap(err, "failed to encode docker config")
+}
+
+// applyPullSecret applies the Secret holding the pull credential of an adapter
+func (handle KubeHandle) applyPullSecret(ctx context.Context, resourceName string, credential PullCredential, options metav1.ApplyOptions) error {
+	dockerConfig, err := dockerConfigJSON(credential)
+	if err != nil {
+		return err
+	}
+	secret := coreapplyv1.Secret(pullSecretName(resourceName), handle.nameSpace).
+		WithLabels(adapterLabels(resourceName)).
+		WithType(corev1.SecretTypeDockerConfigJson).
+		WithData(map[string][]byte{corev1.DockerConfigJsonKey: dockerConfig})
+	_, err = handle.clientSet.CoreV1().Secrets(handle.nameSpace).Apply(ctx, secret, options)
+	return errors.Wrap(err, "failed to apply pull secret")
+}
+
+// collectPullSecret deletes the pull Secret of an adapter that no longer has a pull credential.
+// Failing to do so does not fail the sync, it is retried by the next one.
+func (handle KubeHandle) collectPullSecret(ctx context.Context, resourceName string) {
+	err := handle.clientSet.CoreV1().Secrets(handle.nameSpace).Delete(ctx, pullSecretName(resourceName), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		logging.Error("Error collecting pull secret", ctx, map[string]interface{}{"ERROR": err.Error(), "RESOURCE_NAME": resourceName})
+	}
+}
+
+// adapterPullSecrets returns the names of the Secrets an adapter pulls its image with
+func adapterPullSecrets(resourceName string, credential *PullCredential) []string {
+	secrets := []string{}
+	if credential != nil {
+		secrets = append(secrets, pullSecretName(resourceName))
+	}
+	if defaultSecret := config.Loaded().Adapters.DefaultPullSecret; defaultSecret != "" {
+		secrets = append(secrets, defaultSecret)
+	}
+	return secrets
+}
+
+func (handle KubeHandle) applyDeployment(resourceName string, podSpec *coreapplyv1.PodSpecApplyConfiguration, network models.AdapterNetwork, ctx context.Context, options metav1.ApplyOptions) (*appsv1.Deployment, *corev1.Service, error) {
 	// FIXME we assume names of sub-resources based on adapter name
 	podLabels := adapterLabels(resourceName)
 	selector := metaapplyv1.LabelSelector().WithMatchLabels(podLabels)
-	privateEnvs := coreapplyv1.EnvFromSource().WithConfigMapRef(coreapplyv1.ConfigMapEnvSource().WithName(resourceName))
-	containerSpec := coreapplyv1.Container().WithName(resourceName).WithImage(image).WithEnvFrom(privateEnvs)
-	podSpec := coreapplyv1.PodSpec().WithContainers(containerSpec)
 	templateSpec := coreapplyv1.PodTemplateSpec().WithLabels(podLabels).WithSpec(podSpec)
 	deploymentSpec := appsapplyv1.DeploymentSpec().WithReplicas(1).WithSelector(selector).WithTemplate(templateSpec)
 	deployment := appsapplyv1.Deployment(resourceName, handle.nameSpace).WithSpec(deploymentSpec).WithLabels(podLabels)
-	appliedDeployment, err := handle.clientSet.AppsV1().Deployments(handle.nameSpace).Apply(ctx, deployment, metav1.ApplyOptions{FieldManager: "adapter-attendant"})
+	appliedDeployment, err := handle.clientSet.AppsV1().Deployments(handle.nameSpace).Apply(ctx, deployment, options)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "failed to apply deployment")
 	}
-	servicePortSpec := coreapplyv1.ServicePort().WithAppProtocol("TCP").WithPort(8080).WithTargetPort(intstr.FromInt(8080))
+	network = AdapterNetworkWithDefaults(network)
+	servicePortSpec := coreapplyv1.ServicePort().WithName(adapterPortName).WithProtocol(corev1.ProtocolTCP).WithPort(int32(network.ServicePort)).WithTargetPort(intstr.FromString(adapterPortName))
+	if network.AppProtocol != "" {
+		servicePortSpec = servicePortSpec.WithAppProtocol(network.AppProtocol)
+	}
 	serviceSpec := coreapplyv1.ServiceSpec().WithSelector(podLabels).WithPorts(servicePortSpec)
-	service := coreapplyv1.Service(resourceName, handle.nameSpace).WithSpec(serviceSpec)
+	service := coreapplyv1.Service(resourceName, handle.nameSpace).WithSpec(serviceSpec).WithLabels(podLabels).WithAnnotations(map[string]string{schemeAnnotation: network.Scheme})
 
-	appliedService, err := handle.clientSet.CoreV1().Services(handle.nameSpace).Apply(ctx, service, metav1.ApplyOptions{FieldManager: "adapter-attendant"})
+	appliedService, err := handle.clientSet.CoreV1().Services(handle.nameSpace).Apply(ctx, service, options)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed to apply config map")
+		return nil, nil, errors.Wrap(err, "failed to apply service")
 	}
 	return appliedDeployment, appliedService, nil
 }
 
-func (handle KubeHandle) ApplyAdapter(ctx context.Context, adapterId int, image string, userProvidedConfiguration map[string]string) error {
+// adapterEnvironment returns the environment of an adapter, except for the enrollment token
+func adapterEnvironment(userProvidedConfiguration map[string]string) map[string]string {
+	// Add mandatory configuration that is not visible to user
+	// System provided configuration is namespace with "HUEMIE_".
+	environment := map[string]string{
+		"HUEMIE_ENROLL_STORE": config.Loaded().Adapters.DeviceStoreURL,
+	}
+	// User provided configuration needs to be namespaced with "ADAPTER_"
+	// To prevent collision with system provided configuration
+	for k, v := range userProvidedConfiguration {
+		environment[fmt.Sprintf("ADAPTER_%s", k)] = v
+	}
+	return environment
+}
+
+// adapterObjects are the Kubernetes objects of an adapter
+type adapterObjects struct {
+	configMap  *corev1.ConfigMap
+	deployment *appsv1.Deployment
+	service    *corev1.Service
+}
+
+// applyAdapter renders and applies the objects of an adapter, returning them as applied
+func (handle KubeHandle) applyAdapter(ctx context.Context, adapter models.Adapter, userProvidedConfiguration map[string]string, credential *PullCredential, options metav1.ApplyOptions) (adapterObjects, error) {
+	resourceName := adapterResourceName(adapter.ID)
+	jwtSecret := config.Loaded().Adapters.DeviceStoreJWTSecret
+	jwtToken, err := utility.GenerateAdapterJWT(jwtSecret, 24*30*12*time.Hour, adapter.ID)
+	if err != nil {
+		logging.Error("Error generating enrollment token", ctx, map[string]interface{}{"ERROR": err.Error()})
+		return adapterObjects{}, errors.Wrap(err, "failed to generate enrollment token")
+	}
+	kubernetesConfiguration := adapterEnvironment(userProvidedConfiguration)
+	kubernetesConfiguration[enrollTokenKey] = jwtToken
+	configName := configMapName(resourceName, kubernetesConfiguration, jwtSecret)
+	containerSpec, err := adapterContainer(configName, resourceName, adapter)
+	if err != nil {
+		logging.Error("Invalid adapter container specification", ctx, map[string]interface{}{"ERROR": err.Error()})
+		return adapterObjects{}, errors.Wrap(err, "invalid adapter container specification")
+	}
+	objects := adapterObjects{}
+	objects.configMap, err = handle.applyConfig(ctx, resourceName, configName, kubernetesConfiguration, options)
+	if err != nil {
+		logging.Error("Error applying config map", ctx, map[string]interface{}{"ERROR": err.Error()})
+		return adapterObjects{}, errors.Wrap(err, "failed to apply config map")
+	}
+	if credential != nil {
+		if err := handle.applyPullSecret(ctx, resourceName, *credential, options); err != nil {
+			logging.Error("Error applying pull secret", ctx, map[string]interface{}{"ERROR": err.Error()})
+			return adapterObjects{}, err
+		}
+	}
+	if err := handle.applyServiceAccount(ctx, options); err != nil {
+		logging.Error("Error applying service account", ctx, map[string]interface{}{"ERROR": err.Error()})
+		return adapterObjects{}, err
+	}
+	podSpec := adapterPodSpec(containerSpec, adapterPullSecrets(resourceName, credential), adapter.Security)
+	objects.deployment, objects.service, err = handle.applyDeployment(resourceName, podSpec, adapter.Network, ctx, options)
+	if err != nil {
+		logging.Error("Error applying deployment", ctx, map[string]interface{}{"ERROR": err.Error()})
+		return adapterObjects{}, errors.Wrap(err, "failed to apply deployment")
+	}
+	return objects, nil
+}
+
+// ApplyAdapter applies the ConfigMap, Deployment and Service of an adapter, along with a
+// pull Secret if the adapter has a pull credential and the service account adapters run as.
+// The ConfigMap is named after its content and applied first, so until the Deployment
+// is applied the adapter keeps running on its previous ConfigMap.
+func (handle KubeHandle) ApplyAdapter(ctx context.Context, adapter models.Adapter, userProvidedConfiguration map[string]string, credential *PullCredential) error {
 	// FIXME This function is a piece of crap. I need to figure out a way to make this more REST-y while still;
 	// * Preventing configuration being created without a deployment
 	// * Preventing deployment from being created without configuration
 	// * Allow deployment be updated (image name/tag) without supplying configuration
 	// * Allow configuration be updated without supplying image information
-	// FIXME If the context is cancelled at the wrong time we may leave Kubernets in an inconsitent state
 	// FIXME Replace with ArgoCD or similar?
-	resourceName := fmt.Sprintf("adapter-%d", adapterId)
-	jwtToken, err := utility.GenerateAdapterJWT(config.Loaded.Adapters.DeviceStoreJWTSecret, 24*30*12*time.Hour, adapterId)
+	ctx, cancel := context.WithTimeout(ctx, applyTimeout)
+	defer cancel()
+	resourceName := adapterResourceName(adapter.ID)
+	previousConfigName := handle.referencedConfigMap(ctx, resourceName)
+	objects, err := handle.applyAdapter(ctx, adapter, userProvidedConfiguration, credential, applyOptions(false))
 	if err != nil {
-		logging.Error("Error generating enrollment token", ctx, map[string]interface{}{"ERROR": err.Error()})
-		return errors.Wrap(err, "failed to generate enrollment token")
+		return err
 	}
-	// Add mandatory configuration that is not visible to user
-	// System provided configuration is namespace with "HUEMIE_".
-	kubernetesConfiguration := map[string]string{
-		"HUEMIE_ENROLL_TOKEN": jwtToken,
-		"HUEMIE_ENROLL_STORE": config.Loaded.Adapters.DeviceStoreURL,
+	// Pods of the previous ReplicaSet still refer to the previous ConfigMap until the rollout is done,
+	// which is kept even if the ReplicaSet has not been created yet
+	handle.collectConfigMaps(ctx, resourceName, objects.configMap.Name, previousConfigName)
+	if credential == nil {
+		handle.collectPullSecret(ctx, resourceName)
 	}
-	// User provided configuration needs to be namespaced with "ADAPTER_"
-	// To prevent collision with system provided configuration
-	for k, v := range userProvidedConfiguration {
-		kubernetesConfiguration[fmt.Sprintf("ADAPTER_%s", k)] = v
+	return nil
+}
+
+// liveAdapter reads the objects of an adapter from the Kubernetes API, objects that do not exist are nil
+func (handle KubeHandle) liveAdapter(ctx context.Context, adapterId int) (adapterObjects, error) {
+	resourceName := adapterResourceName(adapterId)
+	live := adapterObjects{}
+	deployment, err := handle.clientSet.AppsV1().Deployments(handle.nameSpace).Get(ctx, resourceName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return live, errors.Wrap(err, "failed to get deployment")
+	}
+	if err == nil {
+		live.deployment = deployment
+	}
+	service, err := handle.clientSet.CoreV1().Services(handle.nameSpace).Get(ctx, resourceName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return live, errors.Wrap(err, "failed to get service")
+	}
+	if err == nil {
+		live.service = service
+	}
+	// The live ConfigMap is the one the Deployment refers to, which is named after its content
+	configName := resourceName
+	if live.deployment != nil && configMapReference(live.deployment.Spec.Template.Spec) != "" {
+		configName = configMapReference(live.deployment.Spec.Template.Spec)
 	}
-	// If config is supplied we should apply a ConfigMap
-	_, err = handle.applyConfig(ctx, resourceName, kubernetesConfiguration)
+	configMap, err := handle.clientSet.CoreV1().ConfigMaps(handle.nameSpace).Get(ctx, configName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return live, errors.Wrap(err, "failed to get config map")
+	}
+	if err == nil {
+		live.configMap = configMap
+	}
+	return live, nil
+}
+
+// DryRunAdapter applies an adapter with server-side dry run and returns how the result
+// differs from the live objects. Nothing is changed in Kubernetes. The pull Secret is
+// validated but left out of the diff, which would show the credential.
+func (handle KubeHandle) DryRunAdapter(ctx context.Context, adapter models.Adapter, userProvidedConfiguration map[string]string, credential *PullCredential) (models.SyncDiff, error) {
+	live, err := handle.liveAdapter(ctx, adapter.ID)
 	if err != nil {
-		logging.Error("Error applying config map", ctx, map[string]interface{}{"ERROR": err.Error()})
-		return errors.Wrap(err, "failed to apply config map")
+		return models.SyncDiff{}, err
 	}
-	// If image is set, we
-	_, _, err = handle.applyDeployment(resourceName, image, ctx)
+	desired, err := handle.applyAdapter(ctx, adapter, userProvidedConfiguration, credential, applyOptions(true))
 	if err != nil {
-		logging.Error("Error applying deployment", ctx, map[string]interface{}{"ERROR": err.Error()})
-		return errors.Wrap(err, "failed to apply deployment")
+		return models.SyncDiff{}, err
+	}
+	diff := models.SyncDiff{Objects: []models.ObjectDiff{}}
+	for _, object := range []struct {
+		kind    string
+		name    string
+		live    runtime.Object
+		desired runtime.Object
+	}{
+		{"ConfigMap", desired.configMap.Name, live.configMap, desired.configMap},
+		{"Deployment", desired.deployment.Name, live.deployment, desired.deployment},
+		{"Service", desired.service.Name, live.service, desired.service},
+	} {
+		objectDiff, err := diffObjects(object.kind, object.name, object.live, object.desired)
+		if err != nil {
+			return models.SyncDiff{}, err
+		}
+		diff.Objects = append(diff.Objects, objectDiff)
+	}
+	return diff, nil
+}
+
+// ResolveAdapterAddress looks up the Service of an adapter along with its endpoints.
+// Returns nil if the adapter has no Service.
+func (handle KubeHandle) ResolveAdapterAddress(adapterId int) (*models.AdapterAddress, error) {
+	service, err := handle.cache.cachedService(adapterResourceName(adapterId), handle.nameSpace)
+	if err != nil || service == nil {
+		return nil, err
+	}
+	address, err := AdapterServiceAddress(service)
+	if err != nil {
+		return nil, err
+	}
+	readyEndpoints, totalEndpoints, err := handle.cache.countEndpoints(service.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up endpoints")
+	}
+	ports := []models.AdapterServicePort{}
+	for _, port := range service.Spec.Ports {
+		servicePort := models.AdapterServicePort{
+			Name:       port.Name,
+			Port:       port.Port,
+			TargetPort: port.TargetPort.String(),
+			Protocol:   string(port.Protocol),
+		}
+		if port.AppProtocol != nil {
+			servicePort.AppProtocol = *port.AppProtocol
+		}
+		ports = append(ports, servicePort)
+	}
+	return &models.AdapterAddress{
+		Address:        address,
+		ClusterIP:      service.Spec.ClusterIP,
+		Ports:          ports,
+		ReadyEndpoints: readyEndpoints,
+		TotalEndpoints: totalEndpoints,
+	}, nil
+}
+
+// Ping verifies that the Kubernetes API is reachable, that the adapter namespace is
+// accessible and that the watch caches are populated
+func (handle KubeHandle) Ping(ctx context.Context) error {
+	if err := handle.clientSet.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error(); err != nil {
+		return errors.Wrap(err, "Kubernetes API not reachable")
+	}
+	if _, err := handle.clientSet.AppsV1().Deployments(handle.nameSpace).List(ctx, metav1.ListOptions{Limit: 1}); err != nil {
+		return errors.Wrapf(err, "namespace %q not accessible", handle.nameSpace)
+	}
+	if !handle.cache.synced() {
+		return fmt.Errorf("Kubernetes caches not synced")
 	}
 	return nil
 }
@@ -138,5 +524,6 @@ func NewPureK8sBackend(conf config.Kubernetes) (KubeHandle, error) {
 		clientSet: clientSet,
 		nameSpace: conf.NameSpace,
 	}
+	handle.cache = newKubeCache(handle)
 	return handle, nil
 }
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestConfigMapName(t *testing.T) {
+	configuration := map[string]string{"A": "1", "B": "2", enrollTokenKey: "token"}
+	name := configMapName("adapter-1", configuration, "secret")
+	if !regexp.MustCompile(`^adapter-1-[0-9a-f]{10}$`).MatchString(name) {
+		t.Fatalf("configMapName() = %q, want adapter-1 and a %d character hash", name, configMapHashLength)
+	}
+	tests := []struct {
+		name          string
+		resourceName  string
+		configuration map[string]string
+		tokenSecret   string
+		same          bool
+	}{
+		{name: "same content", resourceName: "adapter-1", configuration: map[string]string{"B": "2", "A": "1", enrollTokenKey: "token"}, tokenSecret: "secret", same: true},
+		{name: "new enrollment token", resourceName: "adapter-1", configuration: map[string]string{"A": "1", "B": "2", enrollTokenKey: "other"}, tokenSecret: "secret", same: true},
+		{name: "without enrollment token", resourceName: "adapter-1", configuration: map[string]string{"A": "1", "B": "2"}, tokenSecret: "secret", same: true},
+		{name: "changed value", resourceName: "adapter-1", configuration: map[string]string{"A": "1", "B": "3", enrollTokenKey: "token"}, tokenSecret: "secret"},
+		{name: "added key", resourceName: "adapter-1", configuration: map[string]string{"A": "1", "B": "2", "C": "", enrollTokenKey: "token"}, tokenSecret: "secret"},
+		{name: "value moved between keys", resourceName: "adapter-1", configuration: map[string]string{"A": "12", "B": "", enrollTokenKey: "token"}, tokenSecret: "secret"},
+		{name: "rotated token secret", resourceName: "adapter-1", configuration: configuration, tokenSecret: "rotated"},
+		{name: "other adapter", resourceName: "adapter-2", configuration: configuration, tokenSecret: "secret"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := configMapName(test.resourceName, test.configuration, test.tokenSecret)
+			if (got == name) != test.same {
+				t.Errorf("configMapName() = %q, first name was %q, want same %v", got, name, test.same)
+			}
+		})
+	}
+}
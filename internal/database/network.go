@@ -0,0 +1,68 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultAdapterPort   = 8080
+	defaultAdapterScheme = "http"
+	// schemeAnnotation records on the Service which scheme clients should use to reach the adapter
+	schemeAnnotation = "huemie.space/scheme"
+	// adapterPortName is the name of the adapter port on both the container and the Service
+	adapterPortName = "adapter"
+)
+
+// AdapterNetworkWithDefaults fills in network settings the adapter did not specify
+func AdapterNetworkWithDefaults(network models.AdapterNetwork) models.AdapterNetwork {
+	if network.ContainerPort == 0 {
+		network.ContainerPort = defaultAdapterPort
+	}
+	if network.ServicePort == 0 {
+		network.ServicePort = defaultAdapterPort
+	}
+	if network.Scheme == "" {
+		network.Scheme = defaultAdapterScheme
+	}
+	return network
+}
+
+// ValidateAdapterNetwork verifies network settings after defaults have been applied.
+// The returned error is suitable for showing to the user.
+func ValidateAdapterNetwork(network models.AdapterNetwork) error {
+	network = AdapterNetworkWithDefaults(network)
+	if network.ContainerPort < 1 || network.ContainerPort > 65535 {
+		return fmt.Errorf("containerPort %d is out of range", network.ContainerPort)
+	}
+	if network.ServicePort < 1 || network.ServicePort > 65535 {
+		return fmt.Errorf("servicePort %d is out of range", network.ServicePort)
+	}
+	switch network.Scheme {
+	case "http", "https", "grpc", "grpcs":
+	default:
+		return fmt.Errorf("unknown scheme %q", network.Scheme)
+	}
+	return nil
+}
+
+// AdapterServiceAddress derives the address of an adapter from its applied Service
+func AdapterServiceAddress(service *corev1.Service) (string, error) {
+	scheme := service.Annotations[schemeAnnotation]
+	if scheme == "" {
+		scheme = defaultAdapterScheme
+	}
+	for _, port := range service.Spec.Ports {
+		if port.Name == adapterPortName || len(service.Spec.Ports) == 1 {
+			address := url.URL{
+				Scheme: scheme,
+				Host:   fmt.Sprintf("%s.%s:%d", service.Name, service.Namespace, port.Port),
+			}
+			return address.String(), nil
+		}
+	}
+	return "", fmt.Errorf("service %s has no adapter port", service.Name)
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateAdapterNetwork(t *testing.T) {
+	tests := []struct {
+		name    string
+		network models.AdapterNetwork
+		wantErr bool
+	}{
+		{name: "defaults", network: models.AdapterNetwork{}},
+		{name: "grpcs on custom ports", network: models.AdapterNetwork{ContainerPort: 50051, ServicePort: 443, Scheme: "grpcs"}},
+		{name: "container port out of range", network: models.AdapterNetwork{ContainerPort: 65536}, wantErr: true},
+		{name: "negative service port", network: models.AdapterNetwork{ServicePort: -1}, wantErr: true},
+		{name: "unknown scheme", network: models.AdapterNetwork{Scheme: "ftp"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateAdapterNetwork(test.network); (err != nil) != test.wantErr {
+				t.Errorf("ValidateAdapterNetwork() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestAdapterServiceAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		ports       []corev1.ServicePort
+		want        string
+		wantErr     bool
+	}{
+		{name: "single unnamed port", ports: []corev1.ServicePort{{Port: 8080}}, want: "http://adapter-1.huemie:8080"},
+		{name: "scheme annotation", annotations: map[string]string{schemeAnnotation: "grpcs"}, ports: []corev1.ServicePort{{Name: adapterPortName, Port: 443}}, want: "grpcs://adapter-1.huemie:443"},
+		{name: "adapter port among others", ports: []corev1.ServicePort{{Name: "metrics", Port: 9090}, {Name: adapterPortName, Port: 8081}}, want: "http://adapter-1.huemie:8081"},
+		{name: "no adapter port", ports: []corev1.ServicePort{{Name: "metrics", Port: 9090}, {Name: "debug", Port: 6060}}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "adapter-1", Namespace: "huemie", Annotations: test.annotations},
+				Spec:       corev1.ServiceSpec{Ports: test.ports},
+			}
+			got, err := AdapterServiceAddress(service)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("AdapterServiceAddress() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("AdapterServiceAddress() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Kaese72/adapter-attendant/internal/config"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	coreapplyv1 "k8s.io/client-go/applyconfigurations/core/v1"
+)
+
+// defaultProbe returns the cluster default probe used when an adapter does not define one
+func defaultProbe() models.AdapterProbe {
+	return models.AdapterProbe{
+		Type: config.Loaded().Adapters.DefaultProbe.Type,
+		Path: config.Loaded().Adapters.DefaultProbe.Path,
+	}
+}
+
+// renderProbe validates a probe and turns it into an apply configuration.
+// Probes without a port target the adapter container port.
+// A nil probe configuration is returned for probes of type "none".
+func renderProbe(name string, probe models.AdapterProbe, containerPort int) (*coreapplyv1.ProbeApplyConfiguration, error) {
+	// Nothing else about a disabled probe matters
+	if probe.Type == "none" {
+		return nil, nil
+	}
+	port := probe.Port
+	if port == 0 {
+		port = containerPort
+	}
+	if port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("%s probe port %d is out of range", name, port)
+	}
+	rendered := coreapplyv1.Probe()
+	switch probe.Type {
+	case "http":
+		path := probe.Path
+		if path == "" {
+			path = config.Loaded().Adapters.DefaultProbe.Path
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("%s probe path %q must start with /", name, path)
+		}
+		rendered = rendered.WithHTTPGet(coreapplyv1.HTTPGetAction().WithPath(path).WithPort(intstr.FromInt(port)))
+	case "tcp":
+		rendered = rendered.WithTCPSocket(coreapplyv1.TCPSocketAction().WithPort(intstr.FromInt(port)))
+	default:
+		return nil, fmt.Errorf("%s probe has unknown type %q", name, probe.Type)
+	}
+	for _, field := range []struct {
+		name  string
+		value int32
+		apply func(int32) *coreapplyv1.ProbeApplyConfiguration
+	}{
+		{"initialDelaySeconds", probe.InitialDelaySeconds, rendered.WithInitialDelaySeconds},
+		{"periodSeconds", probe.PeriodSeconds, rendered.WithPeriodSeconds},
+		{"timeoutSeconds", probe.TimeoutSeconds, rendered.WithTimeoutSeconds},
+		{"failureThreshold", probe.FailureThreshold, rendered.WithFailureThreshold},
+	} {
+		if field.value < 0 {
+			return nil, fmt.Errorf("%s probe %s must not be negative", name, field.name)
+		}
+		if field.value > 0 {
+			field.apply(field.value)
+		}
+	}
+	return rendered, nil
+}
+
+// adapterContainerProbes renders the liveness, readiness and startup probes of an adapter.
+// Probes not defined by the adapter use the cluster default.
+func adapterContainerProbes(probes models.AdapterProbes, containerPort int) (liveness, readiness, startup *coreapplyv1.ProbeApplyConfiguration, err error) {
+	liveness, err = renderProbe("liveness", probeOrDefault(probes.Liveness, defaultProbe()), containerPort)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	readiness, err = renderProbe("readiness", probeOrDefault(probes.Readiness, defaultProbe()), containerPort)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// Adapters may take a while to connect to their devices, so the default startup
+	// probe gives them a couple of minutes before the liveness probe takes over.
+	defaultStartup := defaultProbe()
+	defaultStartup.PeriodSeconds = 5
+	defaultStartup.FailureThreshold = 30
+	startup, err = renderProbe("startup", probeOrDefault(probes.Startup, defaultStartup), containerPort)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return liveness, readiness, startup, nil
+}
+
+func probeOrDefault(probe *models.AdapterProbe, fallback models.AdapterProbe) models.AdapterProbe {
+	if probe != nil {
+		return *probe
+	}
+	return fallback
+}
+
+// ValidateAdapterProbes verifies that the adapter probes can be rendered.
+// The returned error is suitable for showing to the user.
+func ValidateAdapterProbes(probes models.AdapterProbes, network models.AdapterNetwork) error {
+	_, _, _, err := adapterContainerProbes(probes, AdapterNetworkWithDefaults(network).ContainerPort)
+	return err
+}
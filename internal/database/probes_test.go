@@ -0,0 +1,66 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/Kaese72/adapter-attendant/internal/config"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+)
+
+func TestRenderProbe(t *testing.T) {
+	// The default probe is an http probe of /healthz
+	if err := config.Load(""); err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	tests := []struct {
+		name     string
+		probe    models.AdapterProbe
+		wantNil  bool
+		httpPath string
+		port     int
+		tcp      bool
+		period   int32
+		wantErr  bool
+	}{
+		{name: "default", probe: defaultProbe(), httpPath: "/healthz", port: 8080},
+		{name: "http on the container port", probe: models.AdapterProbe{Type: "http"}, httpPath: "/healthz", port: 8080},
+		{name: "http with path and port", probe: models.AdapterProbe{Type: "http", Path: "/ready", Port: 9090, PeriodSeconds: 5}, httpPath: "/ready", port: 9090, period: 5},
+		{name: "tcp", probe: models.AdapterProbe{Type: "tcp", Port: 1883}, tcp: true, port: 1883},
+		{name: "none", probe: models.AdapterProbe{Type: "none"}, wantNil: true},
+		{name: "none ignores its settings", probe: models.AdapterProbe{Type: "none", Path: "healthz", Port: 70000}, wantNil: true},
+		{name: "relative path", probe: models.AdapterProbe{Type: "http", Path: "healthz"}, wantErr: true},
+		{name: "port out of range", probe: models.AdapterProbe{Type: "tcp", Port: 70000}, wantErr: true},
+		{name: "negative threshold", probe: models.AdapterProbe{Type: "tcp", FailureThreshold: -1}, wantErr: true},
+		{name: "unknown type", probe: models.AdapterProbe{Type: "grpc"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			probe, err := renderProbe("liveness", test.probe, 8080)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("renderProbe() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if (probe == nil) != test.wantNil {
+				t.Fatalf("renderProbe() = %v, want nil %v", probe, test.wantNil)
+			}
+			if test.wantNil {
+				return
+			}
+			switch {
+			case test.tcp:
+				if probe.TCPSocket == nil || probe.TCPSocket.Port.IntValue() != test.port {
+					t.Errorf("TCPSocket = %+v, want port %d", probe.TCPSocket, test.port)
+				}
+			default:
+				if probe.HTTPGet == nil || *probe.HTTPGet.Path != test.httpPath || probe.HTTPGet.Port.IntValue() != test.port {
+					t.Errorf("HTTPGet = %+v, want %s on port %d", probe.HTTPGet, test.httpPath, test.port)
+				}
+			}
+			if test.period != 0 && (probe.PeriodSeconds == nil || *probe.PeriodSeconds != test.period) {
+				t.Errorf("PeriodSeconds = %v, want %d", probe.PeriodSeconds, test.period)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/Kaese72/adapter-attendant/internal/config"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// resourceValue picks the adapter provided value, falling back to the cluster default
+func resourceValue(adapterValue string, defaultValue string) string {
+	if adapterValue != "" {
+		return adapterValue
+	}
+	return defaultValue
+}
+
+// parseBoundedQuantity parses a quantity and verifies that it does not exceed the configured maximum.
+// An empty value is allowed and results in a nil quantity.
+func parseBoundedQuantity(name string, value string, maxValue string) (*resource.Quantity, error) {
+	if value == "" {
+		return nil, nil
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s %q", name, value)
+	}
+	if quantity.Sign() <= 0 {
+		return nil, fmt.Errorf("%s must be positive, got %q", name, value)
+	}
+	if maxValue != "" {
+		maxQuantity, err := resource.ParseQuantity(maxValue)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid configured maximum %s %q", name, maxValue)
+		}
+		if quantity.Cmp(maxQuantity) > 0 {
+			return nil, fmt.Errorf("%s %q exceeds the maximum of %q", name, value, maxValue)
+		}
+	}
+	return &quantity, nil
+}
+
+// AdapterResourceRequirements merges adapter resources with the cluster defaults and validates
+// the result against the configured maximums.
+// The returned error is suitable for showing to the user.
+func AdapterResourceRequirements(resources models.AdapterResources) (corev1.ResourceRequirements, error) {
+	defaults := config.Loaded().Adapters.DefaultResources
+	maximums := config.Loaded().Adapters.MaxResources
+	requirements := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{},
+		Limits:   corev1.ResourceList{},
+	}
+	for _, entry := range []struct {
+		name         string
+		resourceName corev1.ResourceName
+		list         corev1.ResourceList
+		value        string
+		maxValue     string
+	}{
+		{"cpuRequest", corev1.ResourceCPU, requirements.Requests, resourceValue(resources.CPURequest, defaults.CPURequest), maximums.CPURequest},
+		{"cpuLimit", corev1.ResourceCPU, requirements.Limits, resourceValue(resources.CPULimit, defaults.CPULimit), maximums.CPULimit},
+		{"memoryRequest", corev1.ResourceMemory, requirements.Requests, resourceValue(resources.MemoryRequest, defaults.MemoryRequest), maximums.MemoryRequest},
+		{"memoryLimit", corev1.ResourceMemory, requirements.Limits, resourceValue(resources.MemoryLimit, defaults.MemoryLimit), maximums.MemoryLimit},
+	} {
+		quantity, err := parseBoundedQuantity(entry.name, entry.value, entry.maxValue)
+		if err != nil {
+			return corev1.ResourceRequirements{}, err
+		}
+		if quantity != nil {
+			entry.list[entry.resourceName] = *quantity
+		}
+	}
+	for _, resourceName := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		request, hasRequest := requirements.Requests[resourceName]
+		limit, hasLimit := requirements.Limits[resourceName]
+		if hasRequest && hasLimit && request.Cmp(limit) > 0 {
+			return corev1.ResourceRequirements{}, fmt.Errorf("%s request %q exceeds its limit %q", resourceName, request.String(), limit.String())
+		}
+	}
+	return requirements, nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/Kaese72/adapter-attendant/internal/config"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestAdapterResourceRequirements(t *testing.T) {
+	// The built in defaults and maximums apply
+	if err := config.Load(""); err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	tests := []struct {
+		name      string
+		resources models.AdapterResources
+		requests  map[corev1.ResourceName]string
+		limits    map[corev1.ResourceName]string
+		wantErr   bool
+	}{
+		{
+			name:     "cluster defaults",
+			requests: map[corev1.ResourceName]string{corev1.ResourceCPU: "50m", corev1.ResourceMemory: "64Mi"},
+			limits:   map[corev1.ResourceName]string{corev1.ResourceCPU: "500m", corev1.ResourceMemory: "256Mi"},
+		},
+		{
+			name:      "adapter values override defaults",
+			resources: models.AdapterResources{CPURequest: "100m", CPULimit: "1", MemoryLimit: "512Mi"},
+			requests:  map[corev1.ResourceName]string{corev1.ResourceCPU: "100m", corev1.ResourceMemory: "64Mi"},
+			limits:    map[corev1.ResourceName]string{corev1.ResourceCPU: "1", corev1.ResourceMemory: "512Mi"},
+		},
+		{name: "limit above maximum", resources: models.AdapterResources{CPULimit: "4"}, wantErr: true},
+		{name: "request above limit", resources: models.AdapterResources{MemoryRequest: "300Mi"}, wantErr: true},
+		{name: "invalid quantity", resources: models.AdapterResources{CPURequest: "lots"}, wantErr: true},
+		{name: "negative quantity", resources: models.AdapterResources{CPURequest: "-100m"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requirements, err := AdapterResourceRequirements(test.resources)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("AdapterResourceRequirements() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			for _, list := range []struct {
+				name string
+				got  corev1.ResourceList
+				want map[corev1.ResourceName]string
+			}{{"requests", requirements.Requests, test.requests}, {"limits", requirements.Limits, test.limits}} {
+				if len(list.got) != len(list.want) {
+					t.Errorf("%s = %v, want %v", list.name, list.got, list.want)
+				}
+				for resourceName, want := range list.want {
+					if got := list.got[resourceName]; got.String() != want {
+						t.Errorf("%s[%s] = %q, want %q", list.name, resourceName, got.String(), want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// rolloutPollInterval is how often WaitForAdapterRollout checks the watched Deployment
+const rolloutPollInterval = 2 * time.Second
+
+// WaitForAdapterRollout waits until the Deployment of an adapter runs the image of the adapter
+// and all of its replicas are available. It gives up early when the rollout has failed.
+func (handle KubeHandle) WaitForAdapterRollout(ctx context.Context, adapter models.Adapter, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+	reason := "deployment not updated yet"
+	for {
+		health, healthReason := handle.cache.rolloutHealth(adapter)
+		switch health {
+		case HealthHealthy:
+			return nil
+		case HealthFailed:
+			return fmt.Errorf("rollout failed: %s", healthReason)
+		}
+		if healthReason != "" {
+			reason = healthReason
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "adapter not ready, %s", reason)
+		case <-ticker.C:
+		}
+	}
+}
+
+// rolloutHealth returns the health of an adapter workload, which is progressing as long
+// as the watched Deployment does not run the image of the adapter yet
+func (kc *kubeCache) rolloutHealth(adapter models.Adapter) (string, string) {
+	resourceName := adapterResourceName(adapter.ID)
+	deployment, err := kc.deployments.Deployments(kc.nameSpace).Get(resourceName)
+	if err != nil {
+		return HealthProgressing, "deployment not found yet"
+	}
+	image := adapter.SyncedImage()
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Name == resourceName && container.Image != image {
+			return HealthProgressing, "deployment not updated yet"
+		}
+	}
+	pods, err := kc.pods.Pods(kc.nameSpace).List(labels.SelectorFromSet(labels.Set{"huemie-adapter": resourceName}))
+	if err != nil {
+		pods = nil
+	}
+	return adapterHealth(deployment, pods)
+}
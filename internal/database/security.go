@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/Kaese72/adapter-attendant/internal/config"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreapplyv1 "k8s.io/client-go/applyconfigurations/core/v1"
+)
+
+const (
+	// tmpVolumeName is the writable volume mounted at /tmp of adapter containers
+	tmpVolumeName = "tmp"
+)
+
+// capabilityPattern matches Linux capability names, with or without the CAP_ prefix Kubernetes leaves out
+var capabilityPattern = regexp.MustCompile(`^[A-Z][A-Z_]*[A-Z]$`)
+
+// ValidateAdapterSecurity checks the security settings of an adapter.
+// The returned error is suitable for showing to the user.
+func ValidateAdapterSecurity(security models.AdapterSecurity) error {
+	for _, capability := range security.AddCapabilities {
+		if !capabilityPattern.MatchString(capability) {
+			return fmt.Errorf("capability %q is not a Linux capability name, eg. NET_BIND_SERVICE", capability)
+		}
+	}
+	return nil
+}
+
+// containerSecurityContext renders the hardened security context of an adapter container,
+// relaxed as the adapter allows
+func containerSecurityContext(security models.AdapterSecurity) *coreapplyv1.SecurityContextApplyConfiguration {
+	capabilities := coreapplyv1.Capabilities().WithDrop("ALL")
+	for _, capability := range security.AddCapabilities {
+		capabilities = capabilities.WithAdd(corev1.Capability(capability))
+	}
+	securityContext := coreapplyv1.SecurityContext().
+		WithRunAsNonRoot(!security.RunAsRoot).
+		WithReadOnlyRootFilesystem(!security.WritableRootFilesystem).
+		WithAllowPrivilegeEscalation(false).
+		WithCapabilities(capabilities).
+		WithSeccompProfile(coreapplyv1.SeccompProfile().WithType(corev1.SeccompProfileTypeRuntimeDefault))
+	// Images with a root or non-numeric USER can not be verified to run as non-root, so they fail to
+	// start unless the user is set here
+	if runAsUser := config.Loaded().Adapters.RunAsUser; !security.RunAsRoot && runAsUser != 0 {
+		securityContext = securityContext.WithRunAsUser(runAsUser)
+	}
+	return securityContext
+}
+
+// adapterPodSpec renders the pod of an adapter around its container. The pod runs as the
+// adapter service account, without its token unless the adapter allows it.
+func adapterPodSpec(containerSpec *coreapplyv1.ContainerApplyConfiguration, pullSecrets []string, security models.AdapterSecurity) *coreapplyv1.PodSpecApplyConfiguration {
+	// A read-only root filesystem leaves adapters nowhere to write temporary files otherwise
+	containerSpec = containerSpec.
+		WithSecurityContext(containerSecurityContext(security)).
+		WithVolumeMounts(coreapplyv1.VolumeMount().WithName(tmpVolumeName).WithMountPath("/tmp"))
+	podSpec := coreapplyv1.PodSpec().
+		WithContainers(containerSpec).
+		WithVolumes(coreapplyv1.Volume().WithName(tmpVolumeName).WithEmptyDir(coreapplyv1.EmptyDirVolumeSource())).
+		WithServiceAccountName(config.Loaded().Adapters.ServiceAccount).
+		WithAutomountServiceAccountToken(security.MountServiceAccountToken).
+		WithSecurityContext(coreapplyv1.PodSecurityContext().
+			WithSeccompProfile(coreapplyv1.SeccompProfile().WithType(corev1.SeccompProfileTypeRuntimeDefault)))
+	for _, pullSecret := range pullSecrets {
+		podSpec = podSpec.WithImagePullSecrets(coreapplyv1.LocalObjectReference().WithName(pullSecret))
+	}
+	return podSpec
+}
+
+// applyServiceAccount applies the service account adapters run as, which has no permissions
+// of its own and does not mount its token by default
+func (handle KubeHandle) applyServiceAccount(ctx context.Context, options metav1.ApplyOptions) error {
+	serviceAccount := coreapplyv1.ServiceAccount(config.Loaded().Adapters.ServiceAccount, handle.nameSpace).
+		WithLabels(map[string]string{"huemie-purpose": "device-adapter"}).
+		WithAutomountServiceAccountToken(false)
+	_, err := handle.clientSet.CoreV1().ServiceAccounts(handle.nameSpace).Apply(ctx, serviceAccount, options)
+	return errors.Wrap(err, "failed to apply service account")
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Kaese72/adapter-attendant/internal/config"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestValidateAdapterSecurity(t *testing.T) {
+	tests := []struct {
+		name     string
+		security models.AdapterSecurity
+		wantErr  bool
+	}{
+		{name: "hardened", security: models.AdapterSecurity{}},
+		{name: "capability", security: models.AdapterSecurity{AddCapabilities: []string{"NET_BIND_SERVICE", "NET_RAW"}}},
+		{name: "lower case capability", security: models.AdapterSecurity{AddCapabilities: []string{"net_raw"}}, wantErr: true},
+		{name: "capability with spaces", security: models.AdapterSecurity{AddCapabilities: []string{"NET RAW"}}, wantErr: true},
+		{name: "empty capability", security: models.AdapterSecurity{AddCapabilities: []string{""}}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateAdapterSecurity(test.security)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ValidateAdapterSecurity() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestContainerSecurityContext(t *testing.T) {
+	t.Setenv("ADAPTERS_RUN_AS_USER", "65532")
+	if err := config.Load(""); err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	tests := []struct {
+		name            string
+		security        models.AdapterSecurity
+		runAsNonRoot    bool
+		readOnlyRootFS  bool
+		addCapabilities []corev1.Capability
+		runAsUser       int64
+	}{
+		{name: "hardened", security: models.AdapterSecurity{}, runAsNonRoot: true, readOnlyRootFS: true, runAsUser: 65532},
+		{name: "root", security: models.AdapterSecurity{RunAsRoot: true}, readOnlyRootFS: true},
+		{name: "writable root filesystem", security: models.AdapterSecurity{WritableRootFilesystem: true}, runAsNonRoot: true, runAsUser: 65532},
+		{
+			name:            "capabilities",
+			security:        models.AdapterSecurity{AddCapabilities: []string{"NET_BIND_SERVICE"}},
+			runAsNonRoot:    true,
+			readOnlyRootFS:  true,
+			addCapabilities: []corev1.Capability{"NET_BIND_SERVICE"},
+			runAsUser:       65532,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			securityContext := containerSecurityContext(test.security)
+			if *securityContext.RunAsNonRoot != test.runAsNonRoot {
+				t.Errorf("RunAsNonRoot = %v, want %v", *securityContext.RunAsNonRoot, test.runAsNonRoot)
+			}
+			if *securityContext.ReadOnlyRootFilesystem != test.readOnlyRootFS {
+				t.Errorf("ReadOnlyRootFilesystem = %v, want %v", *securityContext.ReadOnlyRootFilesystem, test.readOnlyRootFS)
+			}
+			var runAsUser int64
+			if securityContext.RunAsUser != nil {
+				runAsUser = *securityContext.RunAsUser
+			}
+			if runAsUser != test.runAsUser {
+				t.Errorf("RunAsUser = %d, want %d", runAsUser, test.runAsUser)
+			}
+			if *securityContext.AllowPrivilegeEscalation {
+				t.Errorf("AllowPrivilegeEscalation = true, want false")
+			}
+			if !reflect.DeepEqual(securityContext.Capabilities.Drop, []corev1.Capability{"ALL"}) {
+				t.Errorf("dropped capabilities = %v, want ALL", securityContext.Capabilities.Drop)
+			}
+			if !reflect.DeepEqual(securityContext.Capabilities.Add, test.addCapabilities) {
+				t.Errorf("added capabilities = %v, want %v", securityContext.Capabilities.Add, test.addCapabilities)
+			}
+		})
+	}
+}
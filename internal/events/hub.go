@@ -0,0 +1,81 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+)
+
+// Event types published on the hub
+const (
+	Created       = "created"
+	Updated       = "updated"
+	Deleted       = "deleted"
+	Synced        = "synced"
+	HealthChanged = "health-changed"
+)
+
+// subscriberBuffer is how many events a subscriber may lag behind before events are dropped
+const subscriberBuffer = 64
+
+type Event struct {
+	Type    string
+	Payload models.AdapterEvent
+}
+
+// Hub fans out adapter events to all current subscribers
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: map[chan Event]struct{}{},
+	}
+}
+
+// Publish sends an event to every subscriber.
+// Subscribers that are not keeping up miss the event rather than blocking the publisher.
+func (hub *Hub) Publish(ctx context.Context, eventType string, payload models.AdapterEvent) {
+	if payload.Time.IsZero() {
+		payload.Time = time.Now().UTC()
+	}
+	event := Event{Type: eventType, Payload: payload}
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for subscriber := range hub.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			logging.Info("Dropping event for slow subscriber", ctx, map[string]any{"EVENT_TYPE": eventType, "ADAPTER_ID": payload.AdapterID, "BUFFER": cap(subscriber)})
+		}
+	}
+}
+
+// Subscribe registers a new subscriber.
+// The returned function must be called to unsubscribe, after which the channel is closed.
+func (hub *Hub) Subscribe() (<-chan Event, func()) {
+	return hub.SubscribeBuffered(subscriberBuffer)
+}
+
+// SubscribeBuffered registers a new subscriber that may lag up to buffer events behind,
+// for subscribers that must not miss events while they do I/O
+func (hub *Hub) SubscribeBuffered(buffer int) (<-chan Event, func()) {
+	subscriber := make(chan Event, buffer)
+	hub.mu.Lock()
+	hub.subscribers[subscriber] = struct{}{}
+	hub.mu.Unlock()
+	var once sync.Once
+	return subscriber, func() {
+		once.Do(func() {
+			hub.mu.Lock()
+			delete(hub.subscribers, subscriber)
+			hub.mu.Unlock()
+			close(subscriber)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+)
+
+func TestHub(t *testing.T) {
+	ctx := context.Background()
+	hub := NewHub()
+	first, unsubscribeFirst := hub.Subscribe()
+	second, unsubscribeSecond := hub.Subscribe()
+	defer unsubscribeSecond()
+
+	hub.Publish(ctx, Created, models.AdapterEvent{AdapterID: 1})
+	for _, subscriber := range []<-chan Event{first, second} {
+		event := <-subscriber
+		if event.Type != Created || event.Payload.AdapterID != 1 || event.Payload.Time.IsZero() {
+			t.Errorf("received %+v, want a timestamped created event for adapter 1", event)
+		}
+	}
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	if _, open := <-first; open {
+		t.Errorf("channel of unsubscribed subscriber is still open")
+	}
+
+	// A subscriber that is not reading misses events instead of blocking the publisher
+	for i := 0; i < subscriberBuffer+1; i++ {
+		hub.Publish(ctx, Updated, models.AdapterEvent{AdapterID: 1})
+	}
+	if len(second) != subscriberBuffer {
+		t.Errorf("slow subscriber has %d buffered events, want %d", len(second), subscriberBuffer)
+	}
+}
@@ -0,0 +1,66 @@
+package health
+
+import (
+	"context"
+	"crypto/rsa"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Kaese72/adapter-attendant/migrations"
+)
+
+// DatabaseCheck verifies that the database answers
+func DatabaseCheck(db *sql.DB) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// PublicKeyCheck verifies that the token verification key has been loaded
+func PublicKeyCheck(key *rsa.PublicKey) Check {
+	return func(ctx context.Context) error {
+		if key == nil {
+			return errors.New("RSA public key not loaded")
+		}
+		return nil
+	}
+}
+
+// SchemaVersionCheck verifies that the database schema is at the version this binary was built for.
+// Applied versions are read from the Flyway schema history table.
+func SchemaVersionCheck(db *sql.DB, driver string) Check {
+	return func(ctx context.Context) error {
+		expected, err := migrations.LatestVersion(driver)
+		if err != nil {
+			return err
+		}
+		rows, err := db.QueryContext(ctx, "SELECT version FROM flyway_schema_history WHERE success = TRUE AND version IS NOT NULL")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		applied := 0
+		for rows.Next() {
+			var versionString string
+			if err := rows.Scan(&versionString); err != nil {
+				return err
+			}
+			version, err := strconv.Atoi(versionString)
+			if err != nil {
+				return fmt.Errorf("unexpected schema version %q", versionString)
+			}
+			if version > applied {
+				applied = version
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if applied != expected {
+			return fmt.Errorf("schema is at version %d, expected %d", applied, expected)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds how long a single dependency check may take
+const checkTimeout = 5 * time.Second
+
+// Check verifies a single dependency, returning nil if it is usable
+type Check func(ctx context.Context) error
+
+type DependencyStatus struct {
+	Name   string `json:"name"`
+	Ready  bool   `json:"ready"`
+	Error  string `json:"error,omitempty"`
+	TookMs int64  `json:"tookMs"`
+}
+
+type Report struct {
+	Ready        bool               `json:"ready"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks of adapter-attendant
+type Checker struct {
+	checks []namedCheck
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Add registers a named dependency check, reported in the order added
+func (checker *Checker) Add(name string, check Check) {
+	checker.checks = append(checker.checks, namedCheck{name: name, check: check})
+}
+
+// Run executes all checks concurrently
+func (checker *Checker) Run(ctx context.Context) Report {
+	report := Report{Ready: true, Dependencies: make([]DependencyStatus, len(checker.checks))}
+	var wg sync.WaitGroup
+	for index, check := range checker.checks {
+		wg.Add(1)
+		go func(index int, check namedCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			start := time.Now()
+			err := check.check(checkCtx)
+			status := DependencyStatus{Name: check.name, Ready: err == nil, TookMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				status.Error = err.Error()
+			}
+			report.Dependencies[index] = status
+		}(index, check)
+	}
+	wg.Wait()
+	for _, status := range report.Dependencies {
+		report.Ready = report.Ready && status.Ready
+	}
+	return report
+}
+
+// LivenessV1 reports that the process is alive and serving requests
+func (checker *Checker) LivenessV1(ctx context.Context, input *struct {
+}) (*struct {
+	Body struct {
+		Status string `json:"status"`
+	}
+}, error) {
+	response := &struct {
+		Body struct {
+			Status string `json:"status"`
+		}
+	}{}
+	response.Body.Status = "ok"
+	return response, nil
+}
+
+// ReadinessV1 reports whether all dependencies are usable, with a per-dependency breakdown
+func (checker *Checker) ReadinessV1(ctx context.Context, input *struct {
+}) (*struct {
+	Status int
+	Body   Report
+}, error) {
+	report := checker.Run(ctx)
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	return &struct {
+		Status int
+		Body   Report
+	}{
+		Status: status,
+		Body:   report,
+	}, nil
+}
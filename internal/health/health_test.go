@@ -0,0 +1,68 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	ready := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("connection refused") }
+	tests := []struct {
+		name       string
+		checks     map[string]Check
+		order      []string
+		wantStatus int
+		wantErrors map[string]string
+	}{
+		{name: "no dependencies", wantStatus: http.StatusOK},
+		{
+			name:       "all ready",
+			checks:     map[string]Check{"database": ready},
+			order:      []string{"database"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "one failing",
+			checks:     map[string]Check{"database": failing, "kubernetes": ready},
+			order:      []string{"kubernetes", "database"},
+			wantStatus: http.StatusServiceUnavailable,
+			wantErrors: map[string]string{"database": "connection refused"},
+		},
+		{
+			name:       "public key missing",
+			checks:     map[string]Check{"public-key": PublicKeyCheck(nil)},
+			order:      []string{"public-key"},
+			wantStatus: http.StatusServiceUnavailable,
+			wantErrors: map[string]string{"public-key": "RSA public key not loaded"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checker := NewChecker()
+			for _, name := range test.order {
+				checker.Add(name, test.checks[name])
+			}
+			response, err := checker.ReadinessV1(context.Background(), nil)
+			if err != nil {
+				t.Fatalf("ReadinessV1() error = %v", err)
+			}
+			if response.Status != test.wantStatus || response.Body.Ready != (test.wantStatus == http.StatusOK) {
+				t.Errorf("ReadinessV1() = %d, ready %v, want %d", response.Status, response.Body.Ready, test.wantStatus)
+			}
+			if len(response.Body.Dependencies) != len(test.order) {
+				t.Fatalf("got %d dependencies, want %d", len(response.Body.Dependencies), len(test.order))
+			}
+			for index, dependency := range response.Body.Dependencies {
+				if dependency.Name != test.order[index] {
+					t.Errorf("dependency %d = %q, want %q", index, dependency.Name, test.order[index])
+				}
+				if dependency.Error != test.wantErrors[dependency.Name] || dependency.Ready != (dependency.Error == "") {
+					t.Errorf("dependency %q = %+v, want error %q", dependency.Name, dependency, test.wantErrors[dependency.Name])
+				}
+			}
+		})
+	}
+}
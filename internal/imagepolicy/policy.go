@@ -0,0 +1,151 @@
+// Package imagepolicy decides which images adapters may run, by repository allowlist
+// and by signature verification hooks.
+package imagepolicy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/internal/config"
+	"github.com/Kaese72/adapter-attendant/internal/registry"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultHookTimeout bounds a verification hook that has no timeout configured
+	defaultHookTimeout = 10 * time.Second
+	// maxReasonLength limits how much of a rejecting hook's response is passed on as the reason
+	maxReasonLength = 512
+)
+
+// DeniedError is returned for images the policy does not allow
+type DeniedError struct {
+	Reason string
+}
+
+func (err DeniedError) Error() string {
+	return err.Reason
+}
+
+// Allowed checks that the repository of an image is allowed.
+// Returns a DeniedError if it is not.
+func Allowed(policy config.ImagePolicy, imageName string) error {
+	if len(policy.AllowedRepositories) == 0 {
+		return nil
+	}
+	repository := registry.ParseRepository(imageName).String()
+	if matchAny(policy.AllowedRepositories, repository) {
+		return nil
+	}
+	return DeniedError{Reason: fmt.Sprintf("repository %s is not in the allowed repositories", repository)}
+}
+
+// RequiresVerification reports whether any verification hook applies to an image
+func RequiresVerification(policy config.ImagePolicy, imageName string) bool {
+	return len(hooksFor(policy, imageName)) > 0
+}
+
+// Verify asks every verification hook that applies to an image to verify the image at digest.
+// Returns a DeniedError if a hook rejects it, other errors mean it could not be verified.
+func Verify(ctx context.Context, policy config.ImagePolicy, imageName string, digest string) error {
+	repository := registry.ParseRepository(imageName).String()
+	for _, hook := range hooksFor(policy, imageName) {
+		if err := callHook(ctx, hook, repository, digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hooksFor returns the verification hooks that apply to an image
+func hooksFor(policy config.ImagePolicy, imageName string) []config.VerificationHook {
+	repository := registry.ParseRepository(imageName).String()
+	hooks := []config.VerificationHook{}
+	for _, hook := range policy.VerificationHooks {
+		if len(hook.Repositories) == 0 || matchAny(hook.Repositories, repository) {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+// verificationRequest is posted to verification hooks
+type verificationRequest struct {
+	Image      string `json:"image"`
+	Repository string `json:"repository"`
+	Digest     string `json:"digest"`
+}
+
+// callHook asks a single verification hook to verify an image
+func callHook(ctx context.Context, hook config.VerificationHook, repository string, digest string) error {
+	timeout := hook.Timeout
+	if timeout == 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	payload, err := json.Marshal(verificationRequest{Image: repository + "@" + digest, Repository: repository, Digest: digest})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode verification request")
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrap(err, "failed to build verification request")
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "failed to reach verification hook %s", hook.URL)
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxReasonLength))
+	if response.StatusCode >= 500 {
+		return fmt.Errorf("verification hook %s responded %s", hook.URL, response.Status)
+	}
+	reason := strings.TrimSpace(string(body))
+	if reason == "" {
+		reason = response.Status
+	}
+	return DeniedError{Reason: fmt.Sprintf("signature of %s@%s was rejected: %s", repository, digest, reason)}
+}
+
+// matchAny reports whether a repository matches any of the glob patterns
+func matchAny(patterns []string, repository string) bool {
+	for _, pattern := range patterns {
+		if globPattern(pattern).MatchString(repository) {
+			return true
+		}
+	}
+	return false
+}
+
+// globPattern compiles a glob pattern where * matches within a path segment and ** across segments
+func globPattern(pattern string) *regexp.Regexp {
+	expression := strings.Builder{}
+	expression.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			expression.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			expression.WriteString("[^/]*")
+		case pattern[i] == '?':
+			expression.WriteString("[^/]")
+		default:
+			expression.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expression.WriteString("$")
+	return regexp.MustCompile(expression.String())
+}
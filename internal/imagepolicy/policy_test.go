@@ -0,0 +1,30 @@
+package imagepolicy
+
+import "testing"
+
+func TestGlobPattern(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		repository string
+		want       bool
+	}{
+		{pattern: "docker.io/library/nginx", repository: "docker.io/library/nginx", want: true},
+		{pattern: "docker.io/library/nginx", repository: "docker.io/library/nginx-unprivileged", want: false},
+		{pattern: "ghcr.io/kaese72/*", repository: "ghcr.io/kaese72/adapter", want: true},
+		{pattern: "ghcr.io/kaese72/*", repository: "ghcr.io/kaese72/adapters/hue", want: false},
+		{pattern: "ghcr.io/kaese72/**", repository: "ghcr.io/kaese72/adapters/hue", want: true},
+		{pattern: "ghcr.io/**/hue", repository: "ghcr.io/kaese72/adapters/hue", want: true},
+		{pattern: "ghcr.io/kaese72/adapter-?", repository: "ghcr.io/kaese72/adapter-1", want: true},
+		{pattern: "ghcr.io/kaese72/adapter-?", repository: "ghcr.io/kaese72/adapter-10", want: false},
+		{pattern: "registry.example.com:5000/*", repository: "registry.example.com:5000/adapter", want: true},
+		// Periods are literal, not regular expression wildcards
+		{pattern: "ghcr.io/*", repository: "ghcrxio/adapter", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.repository, func(t *testing.T) {
+			if got := globPattern(test.pattern).MatchString(test.repository); got != test.want {
+				t.Errorf("globPattern(%q) matching %q = %v, want %v", test.pattern, test.repository, got, test.want)
+			}
+		})
+	}
+}
@@ -34,3 +34,12 @@ func Error(msg string, ctx context.Context, data ...map[string]interface{}) {
 func Fatal(msg string, ctx context.Context, data ...map[string]interface{}) {
 	liblogger.Fatal(msg, append(data, extractApmDict(ctx))...)
 }
+
+func Debug(msg string, ctx context.Context, data ...map[string]interface{}) {
+	liblogger.Debug(msg, append(data, extractApmDict(ctx))...)
+}
+
+// SetDebug enables or disables debug logging
+func SetDebug(enabled bool) {
+	liblogger.SetDebugLogging(enabled)
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/internal/store"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	k8smetrics "k8s.io/client-go/tools/metrics"
+)
+
+const namespace = "adapter_attendant"
+
+// Registry holds every metric exposed by adapter-attendant
+var Registry = prometheus.NewRegistry()
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by operation and status code.",
+	}, []string{"operation", "method", "code"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time spent handling HTTP requests, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "method"})
+	syncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sync_duration_seconds",
+		Help:      "Time spent syncing adapters to Kubernetes, by outcome.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"outcome"})
+	kubernetesAPIErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kubernetes_api_errors_total",
+		Help:      "Failed Kubernetes API requests, by HTTP method and status code.",
+	}, []string{"method", "code"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal,
+		requestDuration,
+		syncDuration,
+		kubernetesAPIErrors,
+	)
+	k8smetrics.Register(k8smetrics.RegisterOpts{RequestResult: kubernetesResultMetric{}})
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Middleware records request counts and latency per huma operation
+func Middleware(ctx huma.Context, next func(huma.Context)) {
+	start := time.Now()
+	next(ctx)
+	operation := ctx.Operation()
+	status := ctx.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	requestsTotal.WithLabelValues(operation.OperationID, operation.Method, strconv.Itoa(status)).Inc()
+	requestDuration.WithLabelValues(operation.OperationID, operation.Method).Observe(time.Since(start).Seconds())
+}
+
+// ObserveSync records the duration and outcome of an adapter sync started at start
+func ObserveSync(start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	syncDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+}
+
+// kubernetesResultMetric counts failed requests made by client-go, including those made by watches
+type kubernetesResultMetric struct{}
+
+func (kubernetesResultMetric) Increment(_ context.Context, code string, method string, _ string) {
+	statusCode, err := strconv.Atoi(code)
+	if err != nil || statusCode >= 400 {
+		kubernetesAPIErrors.WithLabelValues(method, code).Inc()
+	}
+}
+
+// RegisterHealthSource exposes the number of adapters in each health state, as reported by counts
+func RegisterHealthSource(counts func() map[string]int) {
+	Registry.MustRegister(&healthCollector{counts: counts})
+}
+
+type healthCollector struct {
+	counts func() map[string]int
+}
+
+var adaptersByHealth = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "adapters"),
+	"Adapters with a workload in Kubernetes, by health state.",
+	[]string{"health"}, nil,
+)
+
+func (collector *healthCollector) Describe(descriptions chan<- *prometheus.Desc) {
+	descriptions <- adaptersByHealth
+}
+
+func (collector *healthCollector) Collect(metrics chan<- prometheus.Metric) {
+	for health, count := range collector.counts() {
+		metrics <- prometheus.MustNewConstMetric(adaptersByHealth, prometheus.GaugeValue, float64(count), health)
+	}
+}
+
+// RegisterDatabase exposes connection pool statistics and how far Kubernetes lags behind the database
+func RegisterDatabase(db *sql.DB, adapters store.AdapterStore) {
+	Registry.MustRegister(
+		collectors.NewDBStatsCollector(db, "adapterattendant"),
+		&reconciliationCollector{adapters: adapters},
+	)
+}
+
+type reconciliationCollector struct {
+	adapters store.AdapterStore
+}
+
+var (
+	unsyncedAdapters = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "unsynced_adapters"),
+		"Adapters changed in the database since they were last synced.",
+		nil, nil,
+	)
+	reconciliationLag = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "reconciliation_lag_seconds"),
+		"Age of the oldest adapter change that has not been synced to Kubernetes.",
+		nil, nil,
+	)
+)
+
+func (collector *reconciliationCollector) Describe(descriptions chan<- *prometheus.Desc) {
+	descriptions <- unsyncedAdapters
+	descriptions <- reconciliationLag
+}
+
+func (collector *reconciliationCollector) Collect(metrics chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	count, oldest, err := collector.adapters.Unsynced(ctx)
+	if err != nil {
+		logging.Error("Database error when collecting reconciliation metrics", ctx, map[string]any{"ERROR": err.Error()})
+		return
+	}
+	lag := 0.0
+	if oldest != nil {
+		lag = time.Since(*oldest).Seconds()
+	}
+	metrics <- prometheus.MustNewConstMetric(unsyncedAdapters, prometheus.GaugeValue, float64(count))
+	metrics <- prometheus.MustNewConstMetric(reconciliationLag, prometheus.GaugeValue, lag)
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+)
+
+func TestKubernetesResultMetric(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		counted bool
+	}{
+		{name: "success", code: "200", counted: false},
+		{name: "conflict", code: "409", counted: true},
+		{name: "server error", code: "503", counted: true},
+		{name: "connection failure", code: "<error>", counted: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := kubernetesErrorCount(t, test.code)
+			kubernetesResultMetric{}.Increment(context.Background(), test.code, "GET", "")
+			if counted := kubernetesErrorCount(t, test.code) > before; counted != test.counted {
+				t.Errorf("counted = %v, want %v", counted, test.counted)
+			}
+		})
+	}
+}
+
+// kubernetesErrorCount reads the failed GET requests with a status code from the registry
+func kubernetesErrorCount(t *testing.T, code string) float64 {
+	t.Helper()
+	families, err := Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != namespace+"_kubernetes_api_errors_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["method"] == "GET" && labels["code"] == code {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
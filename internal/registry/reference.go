@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The image reference grammar of the OCI distribution specification, as implemented by
+// github.com/distribution/reference, without IPv6 registry hosts
+var (
+	pathComponent   = `[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*`
+	domainComponent = `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
+	domain          = domainComponent + `(?:\.` + domainComponent + `)*(?::[0-9]+)?`
+	hostPattern     = regexp.MustCompile(`^` + domain + `$`)
+	namePattern     = regexp.MustCompile(`^(?:` + domain + `/)?` + pathComponent + `(?:/` + pathComponent + `)*$`)
+	tagPattern      = regexp.MustCompile(`^[\w][\w.-]*$`)
+	digestPattern   = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+	sha256Pattern   = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+const (
+	// maxNameLength is the longest image name accepted by the reference grammar
+	maxNameLength = 255
+	// maxTagLength is the longest image tag the database stores, the reference grammar accepts 128
+	maxTagLength = 64
+)
+
+// ValidateName checks an image name, eg. "ghcr.io/org/adapter", which must not include a tag or digest
+func ValidateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("image name must be set")
+	}
+	if len(name) > maxNameLength {
+		return fmt.Errorf("image name %q is longer than %d characters", name, maxNameLength)
+	}
+	if namePattern.MatchString(name) {
+		return nil
+	}
+	if strings.Contains(name, "@") || strings.Contains(name[strings.LastIndex(name, "/")+1:], ":") {
+		return fmt.Errorf("image name %q must not include a tag or digest, set them separately", name)
+	}
+	return fmt.Errorf("image name %q is not a valid repository name, which is lower case and made of letters, digits and separators", name)
+}
+
+// ValidateHost checks a registry host, eg. "ghcr.io" or "registry.example.com:5000", which must
+// look like a host to an image name, that is contain a period or port or be localhost
+func ValidateHost(host string) error {
+	if !hostPattern.MatchString(host) || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return fmt.Errorf("registry %q is not a registry host, eg. ghcr.io or registry.example.com:5000", host)
+	}
+	return nil
+}
+
+// ValidateTag checks an image tag, eg. "1.4.2"
+func ValidateTag(tag string) error {
+	if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+		return fmt.Errorf("image tag %q is not valid, tags are at most %d letters, digits, underscores, periods and dashes and do not start with a period or dash", tag, maxTagLength)
+	}
+	return nil
+}
+
+// ValidateDigest checks an image digest, eg. "sha256:" followed by 64 hexadecimal digits
+func ValidateDigest(digest string) error {
+	if !digestPattern.MatchString(digest) {
+		return fmt.Errorf("image digest %q is not valid, digests look like sha256:<hex>", digest)
+	}
+	if strings.HasPrefix(digest, "sha256:") && !sha256Pattern.MatchString(digest) {
+		return fmt.Errorf("image digest %q is not valid, sha256 digests have 64 lower case hexadecimal digits", digest)
+	}
+	return nil
+}
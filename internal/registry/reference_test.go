@@ -0,0 +1,79 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "nginx"},
+		{name: "library/nginx"},
+		{name: "ghcr.io/kaese72/adapter"},
+		{name: "registry.example.com:5000/adapters/hue-adapter"},
+		{name: "localhost/adapter"},
+		{name: "", wantErr: true},
+		{name: "ghcr.io/Kaese72/adapter", wantErr: true},
+		{name: "ghcr.io/kaese72/adapter:1.0.0", wantErr: true},
+		{name: "ghcr.io/kaese72/adapter@sha256:abc", wantErr: true},
+		{name: "ghcr.io/kaese72//adapter", wantErr: true},
+		{name: strings.Repeat("a", maxNameLength+1), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateName(test.name); (err != nil) != test.wantErr {
+				t.Errorf("ValidateName(%q) error = %v, wantErr %v", test.name, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTag(t *testing.T) {
+	tests := []struct {
+		tag     string
+		wantErr bool
+	}{
+		{tag: "1.4.2"},
+		{tag: "v1.4.2-rc.1"},
+		{tag: "latest"},
+		{tag: "_build"},
+		{tag: strings.Repeat("a", maxTagLength)},
+		{tag: "", wantErr: true},
+		{tag: ".hidden", wantErr: true},
+		{tag: "-dash", wantErr: true},
+		{tag: "1.0+build", wantErr: true},
+		{tag: strings.Repeat("a", maxTagLength+1), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.tag, func(t *testing.T) {
+			if err := ValidateTag(test.tag); (err != nil) != test.wantErr {
+				t.Errorf("ValidateTag(%q) error = %v, wantErr %v", test.tag, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateDigest(t *testing.T) {
+	tests := []struct {
+		digest  string
+		wantErr bool
+	}{
+		{digest: "sha256:" + strings.Repeat("a", 64)},
+		{digest: "sha512:" + strings.Repeat("a", 128)},
+		{digest: "", wantErr: true},
+		{digest: strings.Repeat("a", 64), wantErr: true},
+		{digest: "sha256:" + strings.Repeat("a", 63), wantErr: true},
+		{digest: "sha256:" + strings.Repeat("A", 64), wantErr: true},
+		{digest: "sha256:" + strings.Repeat("g", 64), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.digest, func(t *testing.T) {
+			if err := ValidateDigest(test.digest); (err != nil) != test.wantErr {
+				t.Errorf("ValidateDigest(%q) error = %v, wantErr %v", test.digest, err, test.wantErr)
+			}
+		})
+	}
+}
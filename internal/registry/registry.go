@@ -0,0 +1,260 @@
+// Package registry queries OCI registries, through the distribution HTTP API, for the tags
+// and digests of adapter images.
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// dockerHub is where images without a registry host are pulled from
+	dockerHub = "registry-1.docker.io"
+	// requestTimeout bounds every request to a registry
+	requestTimeout = 30 * time.Second
+	// maxTagPages stops following pagination of repositories with an absurd number of tags
+	maxTagPages = 50
+)
+
+// manifestMediaTypes are accepted when resolving digests, indexes first so that the digest
+// of a multi-platform image is that of its index, like the one Kubernetes resolves
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Credentials authenticate with a private registry, nil meaning anonymous access
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Client queries OCI registries
+type Client struct {
+	http *http.Client
+}
+
+func NewClient() *Client {
+	return &Client{http: &http.Client{Timeout: requestTimeout}}
+}
+
+// Repository is where an image lives, split into the registry host and the repository path
+type Repository struct {
+	Host string
+	Path string
+}
+
+// String returns the canonical name of the repository, eg. "docker.io/library/nginx" for "nginx"
+func (repository Repository) String() string {
+	if repository.Host == dockerHub {
+		return "docker.io/" + repository.Path
+	}
+	return repository.Host + "/" + repository.Path
+}
+
+// ParseRepository splits an image name like "ghcr.io/org/adapter" or "nginx" into its registry
+// host and repository path, resolving Docker Hub shorthands the way container runtimes do
+func ParseRepository(imageName string) Repository {
+	host, path, found := strings.Cut(imageName, "/")
+	if !found || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		path = imageName
+		host = dockerHub
+		if !strings.Contains(path, "/") {
+			path = "library/" + path
+		}
+	}
+	return Repository{Host: NormalizeHost(host), Path: path}
+}
+
+// NormalizeHost returns the host images of a registry are pulled from, eg. registry-1.docker.io for docker.io
+func NormalizeHost(host string) string {
+	if host == "docker.io" || host == "index.docker.io" {
+		return dockerHub
+	}
+	return host
+}
+
+// Tags lists the tags of an image
+func (client *Client) Tags(ctx context.Context, imageName string, credentials *Credentials) ([]string, error) {
+	repository := ParseRepository(imageName)
+	next := fmt.Sprintf("https://%s/v2/%s/tags/list", repository.Host, repository.Path)
+	tags := []string{}
+	for page := 0; next != "" && page < maxTagPages; page++ {
+		response, err := client.get(ctx, http.MethodGet, next, repository, credentials, nil)
+		if err != nil {
+			return nil, err
+		}
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(response.Body).Decode(&body)
+		response.Body.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode tags of %s", imageName)
+		}
+		tags = append(tags, body.Tags...)
+		next, err = nextPage(response, next)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// Digest resolves a tag, or a digest, of an image to the digest of its manifest
+func (client *Client) Digest(ctx context.Context, imageName string, reference string, credentials *Credentials) (string, error) {
+	repository := ParseRepository(imageName)
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", repository.Host, repository.Path, reference)
+	response, err := client.get(ctx, http.MethodHead, manifestURL, repository, credentials, map[string]string{"Accept": strings.Join(manifestMediaTypes, ", ")})
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+	digest := response.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry returned no digest for %s:%s", imageName, reference)
+	}
+	return digest, nil
+}
+
+// get sends a request, authenticating as the registry asks once it responds 401.
+// Responses other than 200 are returned as errors.
+func (client *Client) get(ctx context.Context, method string, target string, repository Repository, credentials *Credentials, headers map[string]string) (*http.Response, error) {
+	authorization := ""
+	for attempt := 0; attempt < 2; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, method, target, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to build registry request")
+		}
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		response, err := client.http.Do(request)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to reach registry %s", repository.Host)
+		}
+		if response.StatusCode == http.StatusUnauthorized && authorization == "" {
+			challenge := response.Header.Get("WWW-Authenticate")
+			response.Body.Close()
+			authorization, err = client.authorization(ctx, challenge, repository, credentials)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			return nil, fmt.Errorf("registry %s responded %s for %s", repository.Host, response.Status, repository.Path)
+		}
+		return response, nil
+	}
+	return nil, fmt.Errorf("registry %s refused access to %s", repository.Host, repository.Path)
+}
+
+// challengeParameter matches the parameters of a WWW-Authenticate challenge, eg. realm="..."
+var challengeParameter = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// authorization answers the challenge of a registry with an Authorization header, using
+// credentials directly for Basic challenges and to fetch a pull token for Bearer challenges
+func (client *Client) authorization(ctx context.Context, challenge string, repository Repository, credentials *Credentials) (string, error) {
+	scheme, parameters, _ := strings.Cut(challenge, " ")
+	switch {
+	case strings.EqualFold(scheme, "Basic") && credentials != nil:
+		return "Basic " + basicAuth(credentials), nil
+	case strings.EqualFold(scheme, "Bearer"):
+		token, err := client.token(ctx, parameters, repository, credentials)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	return "", fmt.Errorf("registry %s requires %q authentication, which is not supported without credentials", repository.Host, scheme)
+}
+
+// basicAuth encodes credentials for HTTP Basic authentication
+func basicAuth(credentials *Credentials) string {
+	return base64.StdEncoding.EncodeToString([]byte(credentials.Username + ":" + credentials.Password))
+}
+
+// token fetches a pull token as described by the parameters of a Bearer challenge,
+// anonymously unless there are credentials
+func (client *Client) token(ctx context.Context, parameters string, repository Repository, credentials *Credentials) (string, error) {
+	values := map[string]string{}
+	for _, match := range challengeParameter.FindAllStringSubmatch(parameters, -1) {
+		values[match[1]] = match[2]
+	}
+	realm, err := url.Parse(values["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", fmt.Errorf("registry %s sent an invalid token realm %q", repository.Host, values["realm"])
+	}
+	query := realm.Query()
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	scope := values["scope"]
+	if scope == "" {
+		scope = "repository:" + repository.Path + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build token request")
+	}
+	if credentials != nil {
+		request.Header.Set("Authorization", "Basic "+basicAuth(credentials))
+	}
+	response, err := client.http.Do(request)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to fetch token for registry %s", repository.Host)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token service of registry %s responded %s", repository.Host, response.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return "", errors.Wrap(err, "failed to decode registry token")
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// linkNext matches the next page of a Link header, eg. </v2/x/tags/list?last=b&n=100>; rel="next"
+var linkNext = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+// nextPage returns the URL of the next page of a paginated response, or an empty string
+func nextPage(response *http.Response, current string) (string, error) {
+	match := linkNext.FindStringSubmatch(response.Header.Get("Link"))
+	if match == nil {
+		return "", nil
+	}
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse registry URL")
+	}
+	next, err := base.Parse(match[1])
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse registry pagination link")
+	}
+	return next.String(), nil
+}
@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// canonical turns a tag into a semantic version understood by the semver package,
+// which requires a "v" prefix. Returns an empty string for tags that are not versions.
+func canonical(tag string) string {
+	version := tag
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	if !semver.IsValid(version) {
+		return ""
+	}
+	return version
+}
+
+// IsVersion reports whether a tag is a semantic version, eg. "1.4.2" or "v1.4.2"
+func IsVersion(tag string) bool {
+	return canonical(tag) != ""
+}
+
+// LatestUpdate returns the highest tag newer than current that shares its major version,
+// and with patchOnly also its minor version. Pre-releases are only considered when current
+// is one. Returns an empty string when there is no newer tag.
+func LatestUpdate(current string, tags []string, patchOnly bool) string {
+	currentVersion := canonical(current)
+	if currentVersion == "" {
+		return ""
+	}
+	latest := ""
+	latestVersion := currentVersion
+	for _, tag := range tags {
+		// Tags that adapters can not be updated to are never offered
+		if ValidateTag(tag) != nil {
+			continue
+		}
+		version := canonical(tag)
+		if version == "" || semver.Major(version) != semver.Major(currentVersion) {
+			continue
+		}
+		if patchOnly && semver.MajorMinor(version) != semver.MajorMinor(currentVersion) {
+			continue
+		}
+		if semver.Prerelease(version) != "" && semver.Prerelease(currentVersion) == "" {
+			continue
+		}
+		// Tags with and without the "v" prefix may name the same version, the first one found wins
+		if semver.Compare(version, latestVersion) > 0 {
+			latest = tag
+			latestVersion = version
+		}
+	}
+	return latest
+}
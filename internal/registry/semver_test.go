@@ -0,0 +1,34 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLatestUpdate(t *testing.T) {
+	tags := []string{"1.2.3", "1.2.4", "1.2.10", "1.3.0", "1.3.1-rc.1", "2.0.0", "latest", "v1.4.0"}
+	tests := []struct {
+		name      string
+		current   string
+		tags      []string
+		patchOnly bool
+		want      string
+	}{
+		{name: "minor", current: "1.2.3", tags: tags, want: "v1.4.0"},
+		{name: "patch", current: "1.2.3", tags: tags, patchOnly: true, want: "1.2.10"},
+		{name: "up to date", current: "v1.4.0", tags: tags, want: ""},
+		{name: "not a version", current: "latest", tags: tags, want: ""},
+		{name: "no newer tags", current: "2.0.0", tags: tags, want: ""},
+		{name: "pre-releases only from a pre-release", current: "1.3.1-rc.0", tags: tags, patchOnly: true, want: "1.3.1-rc.1"},
+		{name: "pre-releases skipped", current: "1.3.0", tags: tags, patchOnly: true, want: ""},
+		{name: "no tags", current: "1.2.3", tags: nil, want: ""},
+		{name: "tag too long to store", current: "1.3.1-rc.0", tags: []string{"1.3.1-rc.1", "1.3.1-rc." + strings.Repeat("a", maxTagLength)}, patchOnly: true, want: "1.3.1-rc.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := LatestUpdate(test.current, test.tags, test.patchOnly); got != test.want {
+				t.Errorf("LatestUpdate(%q, %v, %v) = %q, want %q", test.current, test.tags, test.patchOnly, got, test.want)
+			}
+		})
+	}
+}
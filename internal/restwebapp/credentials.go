@@ -0,0 +1,225 @@
+package restwebapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Kaese72/adapter-attendant/internal/config"
+	"github.com/Kaese72/adapter-attendant/internal/database"
+	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/internal/registry"
+	"github.com/Kaese72/adapter-attendant/internal/sealing"
+	"github.com/Kaese72/adapter-attendant/internal/store"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// credentialSealContext binds sealed passwords to the registry credentials table
+const credentialSealContext = "registryCredentials.password"
+
+// credentialSealData binds a sealed password to its credential, so that it can not be copied to another one
+func credentialSealData(id int) string {
+	return fmt.Sprintf("%s:%d", credentialSealContext, id)
+}
+
+// credentialKey returns the key registry credentials are encrypted with
+// Returns an API friendly error
+func credentialKey(ctx context.Context) ([]byte, error) {
+	key, err := config.Loaded().Database.CredentialKey()
+	if err != nil {
+		logging.Error("Invalid credential encryption key", ctx, map[string]any{"ERROR": err.Error()})
+		return nil, huma.Error500InternalServerError("Internal Server Error")
+	}
+	if key == nil {
+		return nil, huma.Error503ServiceUnavailable("registry credentials are disabled, database.encryption-key is not set")
+	}
+	return key, nil
+}
+
+// sealPassword encrypts the password of a registry credential for storage
+// Returns an API friendly error
+func sealPassword(ctx context.Context, id int, password string) (string, error) {
+	key, err := credentialKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := sealing.Seal(key, password, credentialSealData(id))
+	if err != nil {
+		logging.Error("Error encrypting registry credential", ctx, map[string]any{"ERROR": err.Error()})
+		return "", huma.Error500InternalServerError("Internal Server Error")
+	}
+	return sealed, nil
+}
+
+// validateRegistryCredential checks the registry of a credential
+// Returns an API friendly error
+func validateRegistryCredential(credential models.RegistryCredential) error {
+	if err := registry.ValidateHost(credential.Registry); err != nil {
+		return huma.Error422UnprocessableEntity(err.Error())
+	}
+	return nil
+}
+
+// GetRegistryCredentialsV1 returns all registry credentials, without their passwords
+func (app webApp) GetRegistryCredentialsV1(ctx context.Context, input *struct {
+}) (*struct {
+	Body []models.RegistryCredential
+}, error) {
+	credentials, err := app.credentials.ListRegistryCredentials(ctx)
+	if err != nil {
+		return nil, storeError(ctx, err, "registry credential")
+	}
+	return &struct {
+		Body []models.RegistryCredential
+	}{
+		Body: credentials,
+	}, nil
+}
+
+// GetRegistryCredentialV1 returns a specific registry credential, without its password
+func (app webApp) GetRegistryCredentialV1(ctx context.Context, input *struct {
+	Id int `path:"id" doc:"the Id of the registry credential"`
+}) (*struct {
+	Body models.RegistryCredential
+}, error) {
+	credential, err := app.credentials.GetRegistryCredential(ctx, input.Id)
+	if err != nil {
+		return nil, storeError(ctx, err, "registry credential")
+	}
+	return &struct {
+		Body models.RegistryCredential
+	}{
+		Body: credential,
+	}, nil
+}
+
+// PostRegistryCredentialV1 registers a registry credential, encrypting its password
+func (app webApp) PostRegistryCredentialV1(ctx context.Context, input *struct {
+	Body models.RegistryCredential `body:""`
+}) (*struct {
+	Body models.RegistryCredential
+}, error) {
+	credential := input.Body
+	if err := validateRegistryCredential(credential); err != nil {
+		return nil, err
+	}
+	if credential.Password == "" {
+		return nil, huma.Error422UnprocessableEntity("password is required")
+	}
+	key, err := credentialKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	created, err := app.credentials.CreateRegistryCredential(ctx, credential, func(id int) (string, error) {
+		return sealing.Seal(key, credential.Password, credentialSealData(id))
+	})
+	if err != nil {
+		return nil, storeError(ctx, err, "registry credential")
+	}
+	return &struct {
+		Body models.RegistryCredential
+	}{
+		Body: created,
+	}, nil
+}
+
+// UpdateRegistryCredentialV1 replaces a registry credential. Adapters using it are marked
+// as changed, they need a sync for the change to reach their pull Secret.
+func (app webApp) UpdateRegistryCredentialV1(ctx context.Context, input *struct {
+	Id   int                       `path:"id" doc:"the Id of the registry credential to update"`
+	Body models.RegistryCredential `body:""`
+}) (*struct {
+	Body models.RegistryCredential
+}, error) {
+	credential := input.Body
+	if err := validateRegistryCredential(credential); err != nil {
+		return nil, err
+	}
+	if credential.Password != "" {
+		sealed, err := sealPassword(ctx, input.Id, credential.Password)
+		if err != nil {
+			return nil, err
+		}
+		credential.Password = sealed
+	}
+	updated, err := app.credentials.UpdateRegistryCredential(ctx, input.Id, credential)
+	if err != nil {
+		return nil, storeError(ctx, err, "registry credential")
+	}
+	return &struct {
+		Body models.RegistryCredential
+	}{
+		Body: updated,
+	}, nil
+}
+
+// DeleteRegistryCredentialV1 deletes a registry credential that no adapter uses
+func (app webApp) DeleteRegistryCredentialV1(ctx context.Context, input *struct {
+	Id int `path:"id" doc:"the Id of the registry credential to delete"`
+}) (*struct {
+}, error) {
+	if err := app.credentials.DeleteRegistryCredential(ctx, input.Id); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			return nil, huma.Error409Conflict("registry credential is used by adapters, remove it from them first")
+		}
+		return nil, storeError(ctx, err, "registry credential")
+	}
+	return nil, nil
+}
+
+// checkPullCredential verifies that the pull credential of an adapter exists and is for the registry of its image
+// Returns an API friendly error
+func (app webApp) checkPullCredential(ctx context.Context, adapter models.Adapter) error {
+	if adapter.PullCredentialID == nil {
+		return nil
+	}
+	credential, err := app.credentials.GetRegistryCredential(ctx, *adapter.PullCredentialID)
+	if errors.Is(err, store.ErrNotFound) {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf("registry credential %d does not exist", *adapter.PullCredentialID))
+	}
+	if err != nil {
+		return storeError(ctx, err, "registry credential")
+	}
+	imageRegistry := registry.ParseRepository(adapter.ImageName).Host
+	if registry.NormalizeHost(credential.Registry) != imageRegistry {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf("registry credential %d is for %s, not %s", credential.ID, credential.Registry, imageRegistry))
+	}
+	return nil
+}
+
+// pullCredential returns the decrypted pull credential of an adapter, nil if it has none
+// Returns an API friendly error
+func (app webApp) pullCredential(ctx context.Context, adapter models.Adapter) (*database.PullCredential, error) {
+	if adapter.PullCredentialID == nil {
+		return nil, nil
+	}
+	credential, err := app.credentials.GetRegistryCredential(ctx, *adapter.PullCredentialID)
+	if err != nil {
+		return nil, storeError(ctx, err, "registry credential")
+	}
+	sealed, err := app.credentials.GetRegistryCredentialPassword(ctx, credential.ID)
+	if err != nil {
+		return nil, storeError(ctx, err, "registry credential")
+	}
+	key, err := credentialKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	password, err := sealing.Open(key, sealed, credentialSealData(credential.ID))
+	if err != nil {
+		logging.Error("Error decrypting registry credential", ctx, map[string]any{"ERROR": err.Error(), "CREDENTIAL_ID": credential.ID})
+		return nil, internalError(err)
+	}
+	return &database.PullCredential{Registry: credential.Registry, Username: credential.Username, Password: password}, nil
+}
+
+// registryCredentials returns the credentials the attendant queries the registry of an adapter with
+// Returns an API friendly error
+func (app webApp) registryCredentials(ctx context.Context, adapter models.Adapter) (*registry.Credentials, error) {
+	credential, err := app.pullCredential(ctx, adapter)
+	if err != nil || credential == nil {
+		return nil, err
+	}
+	return &registry.Credentials{Username: credential.Username, Password: credential.Password}, nil
+}
@@ -0,0 +1,39 @@
+package restwebapp
+
+import (
+	"context"
+
+	"github.com/Kaese72/adapter-attendant/internal/database"
+	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// GetDriftV1 reports how the adapters running in Kubernetes differ from the database
+func (app webApp) GetDriftV1(ctx context.Context, input *struct {
+}) (*struct {
+	Body models.DriftReport
+}, error) {
+	adapters, err := app.adapters.ListAdapters(ctx)
+	if err != nil {
+		return nil, storeError(ctx, err, "adapter")
+	}
+	desired := []database.DesiredAdapter{}
+	for _, adapter := range adapters {
+		arguments, err := app.adapterArguments(ctx, adapter.ID)
+		if err != nil {
+			return nil, err
+		}
+		desired = append(desired, database.DesiredAdapter{Adapter: adapter, Configuration: arguments})
+	}
+	report, err := app.kubernetes.DriftReport(ctx, desired)
+	if err != nil {
+		logging.Error("Error building drift report", ctx, map[string]any{"ERROR": err.Error()})
+		return nil, huma.Error500InternalServerError("Internal Server Error")
+	}
+	return &struct {
+		Body models.DriftReport
+	}{
+		Body: report,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package restwebapp
+
+import (
+	"context"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/internal/events"
+	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/danielgtaylor/huma/v2/sse"
+)
+
+// AdapterEventTypesV1 maps event names on the event stream to their payloads
+var AdapterEventTypesV1 = map[string]any{
+	events.Created:       models.AdapterCreatedEvent{},
+	events.Updated:       models.AdapterUpdatedEvent{},
+	events.Deleted:       models.AdapterDeletedEvent{},
+	events.Synced:        models.AdapterSyncedEvent{},
+	events.HealthChanged: models.AdapterHealthChangedEvent{},
+	"heartbeat":          models.HeartbeatEvent{},
+}
+
+// heartbeatInterval is how often idle event streams get a heartbeat, well within the
+// idle timeouts of common proxies
+const heartbeatInterval = 30 * time.Second
+
+// typedEvent converts a hub event into the payload type registered for its name
+func typedEvent(event events.Event) any {
+	switch event.Type {
+	case events.Created:
+		return models.AdapterCreatedEvent(event.Payload)
+	case events.Updated:
+		return models.AdapterUpdatedEvent(event.Payload)
+	case events.Deleted:
+		return models.AdapterDeletedEvent(event.Payload)
+	case events.Synced:
+		return models.AdapterSyncedEvent(event.Payload)
+	case events.HealthChanged:
+		return models.AdapterHealthChangedEvent(event.Payload)
+	}
+	return nil
+}
+
+// GetAdapterEventsV1 streams adapter events until the client disconnects.
+// A heartbeat is sent whenever the stream has been idle for heartbeatInterval.
+func (app webApp) GetAdapterEventsV1(ctx context.Context, input *struct{}, send sse.Sender) {
+	subscription, unsubscribe := app.events.Subscribe()
+	defer unsubscribe()
+	heartbeat := time.NewTimer(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-app.lifecycle.closing:
+			return
+		case now := <-heartbeat.C:
+			if err := send.Data(models.HeartbeatEvent{Time: now.UTC()}); err != nil {
+				logging.Info("Event stream closed", ctx, map[string]any{"ERROR": err.Error()})
+				return
+			}
+			heartbeat.Reset(heartbeatInterval)
+		case event, ok := <-subscription:
+			if !ok {
+				return
+			}
+			data := typedEvent(event)
+			if data == nil {
+				continue
+			}
+			if err := send.Data(data); err != nil {
+				logging.Info("Event stream closed", ctx, map[string]any{"ERROR": err.Error()})
+				return
+			}
+			heartbeat.Reset(heartbeatInterval)
+		}
+	}
+}
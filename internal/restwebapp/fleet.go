@@ -0,0 +1,194 @@
+package restwebapp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/internal/store"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+const (
+	// defaultFleetConcurrency is the number of adapters synced at the same time unless requested otherwise
+	defaultFleetConcurrency = 4
+	// operationLease is how long a running operation is considered alive without its lease being renewed.
+	// Operations are only run by the replica that started them, so they are cancelled when their lease runs out.
+	operationLease = time.Minute
+)
+
+// selectAdapters returns the adapters matching every selector of a fleet sync request
+func selectAdapters(adapters []models.Adapter, request models.FleetSyncRequest) []models.Adapter {
+	selected := []models.Adapter{}
+	for _, adapter := range adapters {
+		if len(request.IDs) > 0 && !slices.Contains(request.IDs, adapter.ID) {
+			continue
+		}
+		if request.ImageName != "" && adapter.ImageName != request.ImageName {
+			continue
+		}
+		if request.OutOfDate && adapter.Synced != nil && !adapter.Updated.After(*adapter.Synced) {
+			continue
+		}
+		selected = append(selected, adapter)
+	}
+	return selected
+}
+
+// SyncAdaptersV1 starts syncing the selected adapters in the background and returns
+// the operation recording its progress
+func (app webApp) SyncAdaptersV1(ctx context.Context, input *struct {
+	Body models.FleetSyncRequest `body:""`
+}) (*struct {
+	Body models.Operation
+}, error) {
+	request := input.Body
+	if !request.All && len(request.IDs) == 0 && request.ImageName == "" && !request.OutOfDate {
+		return nil, huma.Error422UnprocessableEntity("all, ids, imageName or outOfDate is required")
+	}
+	adapters, err := app.adapters.ListAdapters(ctx)
+	if err != nil {
+		return nil, storeError(ctx, err, "adapter")
+	}
+	for _, id := range request.IDs {
+		if !slices.ContainsFunc(adapters, func(adapter models.Adapter) bool { return adapter.ID == id }) {
+			return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("adapter %d does not exist", id))
+		}
+	}
+	selected := selectAdapters(adapters, request)
+	operation, err := app.operations.CreateOperation(ctx, models.Operation{
+		Kind:    "sync",
+		Status:  store.StatusRunning,
+		Total:   len(selected),
+		Results: models.OperationResults{},
+	}, time.Now().Add(operationLease))
+	if err != nil {
+		return nil, storeError(ctx, err, "operation")
+	}
+	concurrency := request.Concurrency
+	if concurrency == 0 {
+		concurrency = defaultFleetConcurrency
+	}
+	jobCtx, done := app.lifecycle.startJob(ctx)
+	go func() {
+		defer done()
+		app.runFleetSync(jobCtx, operation, selected, concurrency)
+	}()
+	return &struct {
+		Body models.Operation
+	}{
+		Body: operation,
+	}, nil
+}
+
+// runFleetSync syncs adapters, at most concurrency at a time, recording every result in the operation.
+// The run stops if the operation is no longer running, as it has been cancelled for having been interrupted.
+func (app webApp) runFleetSync(ctx context.Context, operation models.Operation, adapters []models.Adapter, concurrency int) {
+	runCtx, stopRun := context.WithCancel(ctx)
+	defer stopRun()
+	go app.renewOperation(runCtx, operation.ID)
+	stopped := false
+	slots := make(chan struct{}, concurrency)
+	var mu sync.Mutex
+	var syncs sync.WaitGroup
+	for _, adapter := range adapters {
+		select {
+		case slots <- struct{}{}:
+		case <-runCtx.Done():
+		}
+		if runCtx.Err() != nil {
+			break
+		}
+		syncs.Add(1)
+		go func(adapter models.Adapter) {
+			defer syncs.Done()
+			defer func() { <-slots }()
+			result := models.OperationResult{AdapterID: adapter.ID, Name: adapter.Name, Status: "succeeded"}
+			// syncAdapter logs its own errors
+			if err := app.syncAdapter(runCtx, adapter); err != nil {
+				result.Status = "failed"
+				result.Error = failureCause(err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if stopped {
+				return
+			}
+			operation.Results = append(operation.Results, result)
+			if result.Status == "failed" {
+				operation.Failed++
+			} else {
+				operation.Succeeded++
+			}
+			err := app.operations.UpdateOperation(runCtx, operation)
+			if err == store.ErrNotFound {
+				logging.Info("Operation is no longer running, stopping", ctx, map[string]any{"OPERATION_ID": operation.ID})
+				stopped = true
+				stopRun()
+				return
+			}
+			if err != nil {
+				logging.Error("Database error when recording operation progress", ctx, map[string]any{"ERROR": err.Error(), "OPERATION_ID": operation.ID})
+			}
+		}(adapter)
+	}
+	syncs.Wait()
+	if stopped {
+		return
+	}
+	switch {
+	case len(operation.Results) < operation.Total:
+		operation.Status = "cancelled"
+	case operation.Failed > 0:
+		operation.Status = "failed"
+	default:
+		operation.Status = "succeeded"
+	}
+	// The operation is finished even if the job was cancelled
+	err := app.operations.UpdateOperation(context.WithoutCancel(ctx), operation)
+	if err != nil && err != store.ErrNotFound {
+		logging.Error("Database error when finishing operation", ctx, map[string]any{"ERROR": err.Error(), "OPERATION_ID": operation.ID})
+	}
+	logging.Info("Fleet sync finished", ctx, map[string]any{"OPERATION_ID": operation.ID, "STATUS": operation.Status, "SUCCEEDED": operation.Succeeded, "FAILED": operation.Failed})
+}
+
+// renewOperation keeps extending the lease of a running operation until ctx is cancelled
+func (app webApp) renewOperation(ctx context.Context, id int) {
+	ticker := time.NewTicker(operationLease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := app.operations.RenewOperation(ctx, id, time.Now().Add(operationLease)); err != nil && ctx.Err() == nil {
+			logging.Error("Database error when renewing operation", ctx, map[string]any{"ERROR": err.Error(), "OPERATION_ID": id})
+		}
+	}
+}
+
+// CancelInterruptedOperations cancels operations left running by replicas that stopped without
+// finishing them, on startup and then whenever their leases may have run out, until ctx is cancelled
+func (app webApp) CancelInterruptedOperations(ctx context.Context) {
+	ticker := time.NewTicker(operationLease)
+	defer ticker.Stop()
+	for {
+		cancelled, err := app.operations.CancelInterruptedOperations(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			logging.Error("Database error when cancelling interrupted operations", ctx, map[string]any{"ERROR": err.Error()})
+		}
+		if cancelled > 0 {
+			logging.Info("Cancelled interrupted operations", ctx, map[string]any{"OPERATIONS": cancelled})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package restwebapp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+)
+
+func TestSelectAdapters(t *testing.T) {
+	synced := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	adapters := []models.Adapter{
+		{ID: 1, ImageName: "ghcr.io/kaese72/hue-adapter", Updated: synced.Add(-time.Hour), Synced: &synced},
+		{ID: 2, ImageName: "ghcr.io/kaese72/hue-adapter", Updated: synced.Add(time.Hour), Synced: &synced},
+		{ID: 3, ImageName: "ghcr.io/kaese72/zigbee-adapter", Updated: synced},
+	}
+	tests := []struct {
+		name    string
+		request models.FleetSyncRequest
+		want    []int
+	}{
+		{name: "all", request: models.FleetSyncRequest{All: true}, want: []int{1, 2, 3}},
+		{name: "by Id", request: models.FleetSyncRequest{IDs: []int{3, 1}}, want: []int{1, 3}},
+		{name: "by image", request: models.FleetSyncRequest{ImageName: "ghcr.io/kaese72/hue-adapter"}, want: []int{1, 2}},
+		{name: "out of date or never synced", request: models.FleetSyncRequest{OutOfDate: true}, want: []int{2, 3}},
+		{name: "selectors combined", request: models.FleetSyncRequest{ImageName: "ghcr.io/kaese72/hue-adapter", OutOfDate: true}, want: []int{2}},
+		{name: "unknown Id", request: models.FleetSyncRequest{IDs: []int{4}}, want: []int{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := []int{}
+			for _, adapter := range selectAdapters(adapters, test.request) {
+				got = append(got, adapter.ID)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("selectAdapters() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package restwebapp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/internal/store"
+)
+
+// newLeaseHolder returns a new identity to hold leases with. It starts with the host name,
+// which is the pod name in Kubernetes, so that leases can be traced to the replica holding them.
+func newLeaseHolder() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	randomBytes := make([]byte, 8)
+	// The host name alone still tells replicas apart should this fail
+	_, _ = rand.Read(randomBytes)
+	return hostname + "/" + hex.EncodeToString(randomBytes)
+}
+
+// acquireLease takes or renews a lease for duration, and reports whether holder has it
+func (app webApp) acquireLease(ctx context.Context, name string, holder string, duration time.Duration) bool {
+	now := time.Now()
+	err := app.leases.AcquireLease(ctx, name, holder, now, now.Add(duration))
+	if err != nil && !errors.Is(err, store.ErrConflict) {
+		logging.Error("Database error when acquiring lease", ctx, map[string]any{"ERROR": err.Error(), "LEASE": name})
+	}
+	return err == nil
+}
+
+// holdLease renews a lease acquired by holder until ctx is cancelled, calling lost if another
+// holder has taken it over in the meantime. The returned function waits for renewals to stop
+// after ctx has been cancelled.
+func (app webApp) holdLease(ctx context.Context, lost context.CancelFunc, name string, holder string, duration time.Duration) func() {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(duration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			now := time.Now()
+			err := app.leases.AcquireLease(ctx, name, holder, now, now.Add(duration))
+			if errors.Is(err, store.ErrConflict) {
+				logging.Error("Lease taken over by another replica", ctx, map[string]any{"LEASE": name})
+				lost()
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				logging.Error("Database error when renewing lease", ctx, map[string]any{"ERROR": err.Error(), "LEASE": name})
+			}
+		}
+	}()
+	return func() { <-stopped }
+}
+
+// releaseLease lets other replicas acquire a lease right away
+func (app webApp) releaseLease(ctx context.Context, name string, holder string) {
+	if err := app.leases.ReleaseLease(context.WithoutCancel(ctx), name, holder); err != nil {
+		logging.Error("Database error when releasing lease", ctx, map[string]any{"ERROR": err.Error(), "LEASE": name})
+	}
+}
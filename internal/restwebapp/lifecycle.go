@@ -0,0 +1,62 @@
+package restwebapp
+
+import (
+	"context"
+	"sync"
+)
+
+// lifecycle keeps track of work that has to finish, or be cancelled, before shutting down
+type lifecycle struct {
+	jobs       sync.WaitGroup
+	jobsCtx    context.Context
+	cancelJobs context.CancelFunc
+	closing    chan struct{}
+	closeOnce  sync.Once
+}
+
+func newLifecycle() *lifecycle {
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	return &lifecycle{
+		jobsCtx:    jobsCtx,
+		cancelJobs: cancelJobs,
+		closing:    make(chan struct{}),
+	}
+}
+
+// startJob registers a job that shutdown waits for.
+// The returned context keeps the values of ctx but not its cancellation, so that a client
+// disconnecting does not abort a job midway. It is cancelled when shutdown gives up on waiting.
+// The returned function must be called once the job is done.
+func (lc *lifecycle) startJob(ctx context.Context) (context.Context, func()) {
+	lc.jobs.Add(1)
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(lc.jobsCtx, cancel)
+	return jobCtx, func() {
+		stop()
+		cancel()
+		lc.jobs.Done()
+	}
+}
+
+// CloseStreams ends all long lived streams, such as the event stream, so that the
+// HTTP servers are able to shut down
+func (app webApp) CloseStreams() {
+	app.lifecycle.closeOnce.Do(func() { close(app.lifecycle.closing) })
+}
+
+// Drain waits for running jobs, such as syncs, to finish.
+// When ctx expires the remaining jobs are cancelled and Drain waits for them to return.
+func (app webApp) Drain(ctx context.Context) {
+	app.CloseStreams()
+	done := make(chan struct{})
+	go func() {
+		app.lifecycle.jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		app.lifecycle.cancelJobs()
+		<-done
+	}
+}
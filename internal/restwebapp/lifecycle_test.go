@@ -0,0 +1,72 @@
+package restwebapp
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	tests := []struct {
+		name          string
+		jobDuration   time.Duration
+		drainTimeout  time.Duration
+		wantCancelled bool
+	}{
+		{name: "job finishes in time", jobDuration: 10 * time.Millisecond, drainTimeout: time.Second, wantCancelled: false},
+		{name: "job outlives the drain timeout", jobDuration: time.Minute, drainTimeout: 10 * time.Millisecond, wantCancelled: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := webApp{lifecycle: newLifecycle()}
+			jobCtx, done := app.lifecycle.startJob(context.Background())
+			cancelled := make(chan bool, 1)
+			go func() {
+				defer done()
+				select {
+				case <-time.After(test.jobDuration):
+					cancelled <- false
+				case <-jobCtx.Done():
+					cancelled <- true
+				}
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), test.drainTimeout)
+			defer cancel()
+			app.Drain(ctx)
+			select {
+			case got := <-cancelled:
+				if got != test.wantCancelled {
+					t.Errorf("job cancelled = %v, want %v", got, test.wantCancelled)
+				}
+			default:
+				t.Errorf("Drain() returned before the job did")
+			}
+			select {
+			case <-app.lifecycle.closing:
+			default:
+				t.Errorf("Drain() did not close the streams")
+			}
+		})
+	}
+}
+
+func TestStartJobOutlivesCaller(t *testing.T) {
+	type key struct{}
+	lc := newLifecycle()
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "request"))
+	jobCtx, done := lc.startJob(ctx)
+	defer done()
+	cancel()
+	if jobCtx.Err() != nil {
+		t.Errorf("job context cancelled along with the caller")
+	}
+	if jobCtx.Value(key{}) != "request" {
+		t.Errorf("job context lost the values of the caller")
+	}
+	lc.cancelJobs()
+	select {
+	case <-jobCtx.Done():
+	case <-time.After(time.Second):
+		t.Errorf("job context not cancelled when shutdown gave up")
+	}
+}
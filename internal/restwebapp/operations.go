@@ -0,0 +1,24 @@
+package restwebapp
+
+import (
+	"context"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+)
+
+// GetOperationV1 returns the progress of an operation
+func (app webApp) GetOperationV1(ctx context.Context, input *struct {
+	Id int `path:"id" doc:"the Id of the operation"`
+}) (*struct {
+	Body models.Operation
+}, error) {
+	operation, err := app.operations.GetOperation(ctx, input.Id)
+	if err != nil {
+		return nil, storeError(ctx, err, "operation")
+	}
+	return &struct {
+		Body models.Operation
+	}{
+		Body: operation,
+	}, nil
+}
@@ -0,0 +1,36 @@
+package restwebapp
+
+import (
+	"context"
+
+	"github.com/Kaese72/adapter-attendant/internal/logging"
+)
+
+// ResyncAdapters syncs every adapter that has been synced before, so that changed
+// configuration reaches the workloads. Adapters that were never synced are left alone.
+func (app webApp) ResyncAdapters(ctx context.Context) {
+	ctx, done := app.lifecycle.startJob(ctx)
+	defer done()
+	adapters, err := app.adapters.ListAdapters(ctx)
+	if err != nil {
+		logging.Error("Database error when listing adapters to resync", ctx, map[string]any{"ERROR": err.Error()})
+		return
+	}
+	failed := 0
+	synced := 0
+	for _, adapter := range adapters {
+		if adapter.Synced == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		// syncAdapter logs its own errors
+		if err := app.syncAdapter(ctx, adapter); err != nil {
+			failed++
+			continue
+		}
+		synced++
+	}
+	logging.Info("Resynced adapters", ctx, map[string]any{"SYNCED": synced, "FAILED": failed})
+}
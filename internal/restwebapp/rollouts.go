@@ -0,0 +1,342 @@
+package restwebapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/internal/config"
+	"github.com/Kaese72/adapter-attendant/internal/events"
+	"github.com/Kaese72/adapter-attendant/internal/imagepolicy"
+	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/internal/registry"
+	"github.com/Kaese72/adapter-attendant/internal/store"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+const (
+	// defaultRolloutBatchSize is the number of adapters upgraded at a time unless requested otherwise
+	defaultRolloutBatchSize = 1
+	// defaultReadinessTimeout is how long an upgraded adapter has to become ready unless requested otherwise
+	defaultReadinessTimeout = 300
+	// rolloutLease is how long a replica running a campaign keeps it from the other replicas
+	// without renewing its lease, and how often replicas look for campaigns to resume
+	rolloutLease = time.Minute
+)
+
+// GetRolloutsV1 returns all rollout campaigns
+func (app webApp) GetRolloutsV1(ctx context.Context, input *struct {
+}) (*struct {
+	Body []models.RolloutCampaign
+}, error) {
+	rollouts, err := app.rollouts.ListRollouts(ctx)
+	if err != nil {
+		return nil, storeError(ctx, err, "rollout campaign")
+	}
+	return &struct {
+		Body []models.RolloutCampaign
+	}{
+		Body: rollouts,
+	}, nil
+}
+
+// GetRolloutV1 returns a specific rollout campaign
+func (app webApp) GetRolloutV1(ctx context.Context, input *struct {
+	Id int `path:"id" doc:"the Id of the rollout campaign"`
+}) (*struct {
+	Body models.RolloutCampaign
+}, error) {
+	rollout, err := app.rollouts.GetRollout(ctx, input.Id)
+	if err != nil {
+		return nil, storeError(ctx, err, "rollout campaign")
+	}
+	return &struct {
+		Body models.RolloutCampaign
+	}{
+		Body: rollout,
+	}, nil
+}
+
+// PostRolloutV1 creates a rollout campaign and starts it in the background
+func (app webApp) PostRolloutV1(ctx context.Context, input *struct {
+	Body models.RolloutCampaign `body:""`
+}) (*struct {
+	Body models.RolloutCampaign
+}, error) {
+	rollout := input.Body
+	if err := registry.ValidateName(rollout.ImageName); err != nil {
+		return nil, huma.Error422UnprocessableEntity(err.Error())
+	}
+	if err := registry.ValidateTag(rollout.ImageTag); err != nil {
+		return nil, huma.Error422UnprocessableEntity(err.Error())
+	}
+	if err := imagepolicy.Allowed(config.Loaded().Adapters.ImagePolicy, rollout.ImageName); err != nil {
+		return nil, huma.Error403Forbidden("image not allowed: " + err.Error())
+	}
+	if rollout.BatchSize == 0 {
+		rollout.BatchSize = defaultRolloutBatchSize
+	}
+	if rollout.ReadinessTimeoutSeconds == 0 {
+		rollout.ReadinessTimeoutSeconds = defaultReadinessTimeout
+	}
+	existing, err := app.rollouts.ListRollouts(ctx)
+	if err != nil {
+		return nil, storeError(ctx, err, "rollout campaign")
+	}
+	for _, campaign := range existing {
+		if campaign.Status == store.StatusRunning && campaign.ImageName == rollout.ImageName {
+			return nil, huma.Error409Conflict(fmt.Sprintf("rollout campaign %d is already upgrading %s", campaign.ID, rollout.ImageName))
+		}
+	}
+	adapters, err := app.adapters.ListAdapters(ctx)
+	if err != nil {
+		return nil, storeError(ctx, err, "adapter")
+	}
+	rollout.Status = store.StatusRunning
+	rollout.Total = len(pendingRolloutAdapters(adapters, rollout))
+	rollout.Results = models.OperationResults{}
+	created, err := app.rollouts.CreateRollout(ctx, rollout)
+	if err != nil {
+		return nil, storeError(ctx, err, "rollout campaign")
+	}
+	app.startRollout(ctx, created, false)
+	return &struct {
+		Body models.RolloutCampaign
+	}{
+		Body: created,
+	}, nil
+}
+
+// CancelRolloutV1 stops a rollout campaign from starting further batches.
+// Adapters already upgraded are left as they are.
+func (app webApp) CancelRolloutV1(ctx context.Context, input *struct {
+	Id int `path:"id" doc:"the Id of the rollout campaign to cancel"`
+}) (*struct {
+	Body models.RolloutCampaign
+}, error) {
+	if err := app.rollouts.CancelRollout(ctx, input.Id); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			return nil, huma.Error409Conflict("rollout campaign has already finished")
+		}
+		return nil, storeError(ctx, err, "rollout campaign")
+	}
+	rollout, err := app.rollouts.GetRollout(ctx, input.Id)
+	if err != nil {
+		return nil, storeError(ctx, err, "rollout campaign")
+	}
+	return &struct {
+		Body models.RolloutCampaign
+	}{
+		Body: rollout,
+	}, nil
+}
+
+// ResumeRollouts continues running campaigns that no replica is running, on startup and then
+// whenever the lease of a replica that stopped may have run out, until ctx is cancelled
+func (app webApp) ResumeRollouts(ctx context.Context) {
+	ticker := time.NewTicker(rolloutLease)
+	defer ticker.Stop()
+	for {
+		rollouts, err := app.rollouts.ListRollouts(ctx)
+		if err != nil && ctx.Err() == nil {
+			logging.Error("Database error when listing rollout campaigns to resume", ctx, map[string]any{"ERROR": err.Error()})
+		}
+		for _, rollout := range rollouts {
+			if rollout.Status == store.StatusRunning {
+				app.startRollout(ctx, rollout, true)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pendingRolloutAdapters returns the adapters a campaign has yet to upgrade, in order.
+// Adapters pinned to a digest are left alone, and adapters that failed to upgrade are not retried.
+// Adapters still being upgraded when the campaign was interrupted come first, as they may
+// already run the new tag without having been seen to become ready.
+func pendingRolloutAdapters(adapters []models.Adapter, rollout models.RolloutCampaign) []models.Adapter {
+	interrupted := []models.Adapter{}
+	pending := []models.Adapter{}
+	for _, adapter := range adapters {
+		if adapter.ImageName != rollout.ImageName {
+			continue
+		}
+		index := slices.IndexFunc(rollout.Results, func(result models.OperationResult) bool { return result.AdapterID == adapter.ID })
+		if index >= 0 {
+			if rollout.Results[index].Status == store.StatusRunning {
+				interrupted = append(interrupted, adapter)
+			}
+			continue
+		}
+		if adapter.ImageTag == rollout.ImageTag || adapter.ImageTag == "" || adapter.ImageDigest != "" {
+			continue
+		}
+		pending = append(pending, adapter)
+	}
+	byId := func(a, b models.Adapter) int { return a.ID - b.ID }
+	slices.SortFunc(interrupted, byId)
+	slices.SortFunc(pending, byId)
+	return append(interrupted, pending...)
+}
+
+// setRolloutResult records the result of an adapter in a campaign, replacing an earlier one
+func setRolloutResult(rollout *models.RolloutCampaign, result models.OperationResult) {
+	index := slices.IndexFunc(rollout.Results, func(recorded models.OperationResult) bool { return recorded.AdapterID == result.AdapterID })
+	if index < 0 {
+		rollout.Results = append(rollout.Results, result)
+		return
+	}
+	rollout.Results[index] = result
+}
+
+// rolloutLeaseName names the lease of the replica running a campaign
+func rolloutLeaseName(id int) string {
+	return fmt.Sprintf("rollout-%d", id)
+}
+
+// startRollout runs a campaign in the background, unless another replica, or this one, already runs it
+func (app webApp) startRollout(ctx context.Context, rollout models.RolloutCampaign, resumed bool) {
+	name := rolloutLeaseName(rollout.ID)
+	holder := newLeaseHolder()
+	if !app.acquireLease(ctx, name, holder, rolloutLease) {
+		return
+	}
+	if resumed {
+		logging.Info("Resuming rollout campaign", ctx, map[string]any{"ROLLOUT_ID": rollout.ID})
+	}
+	jobCtx, done := app.lifecycle.startJob(ctx)
+	go func() {
+		defer done()
+		runCtx, stopRun := context.WithCancel(jobCtx)
+		stopRenewing := app.holdLease(runCtx, stopRun, name, holder, rolloutLease)
+		app.runRollout(runCtx, rollout)
+		stopRun()
+		stopRenewing()
+		app.releaseLease(jobCtx, name, holder)
+	}()
+}
+
+// runRollout upgrades the adapters of a campaign a batch at a time until none are left,
+// too many upgrades have failed or the campaign is cancelled. A campaign interrupted by
+// shutdown is left running, to be resumed by another replica or on the next start.
+func (app webApp) runRollout(ctx context.Context, rollout models.RolloutCampaign) {
+	timeout := time.Duration(rollout.ReadinessTimeoutSeconds) * time.Second
+	for {
+		// Cancellations are recorded in the database by CancelRolloutV1
+		current, err := app.rollouts.GetRollout(ctx, rollout.ID)
+		if err != nil {
+			logging.Error("Database error when reading rollout campaign", ctx, map[string]any{"ERROR": err.Error(), "ROLLOUT_ID": rollout.ID})
+			return
+		}
+		if current.Status != store.StatusRunning {
+			logging.Info("Rollout campaign stopped", ctx, map[string]any{"ROLLOUT_ID": rollout.ID, "STATUS": current.Status})
+			return
+		}
+		adapters, err := app.adapters.ListAdapters(ctx)
+		if err != nil {
+			logging.Error("Database error when listing adapters to roll out", ctx, map[string]any{"ERROR": err.Error(), "ROLLOUT_ID": rollout.ID})
+			return
+		}
+		pending := pendingRolloutAdapters(adapters, rollout)
+		if len(pending) == 0 {
+			rollout.Status = "succeeded"
+			break
+		}
+		batch := pending[:min(rollout.BatchSize, len(pending))]
+		rollout.Batch++
+		// Adapters are recorded as upgrading before their tag changes, so that a batch interrupted
+		// by shutdown resumes with them rather than taking them for upgraded already
+		for _, adapter := range batch {
+			setRolloutResult(&rollout, models.OperationResult{AdapterID: adapter.ID, Name: adapter.Name, Status: store.StatusRunning})
+		}
+		app.recordRollout(ctx, rollout)
+		logging.Info("Starting rollout batch", ctx, map[string]any{"ROLLOUT_ID": rollout.ID, "BATCH": rollout.Batch, "ADAPTERS": len(batch)})
+
+		results := make([]models.OperationResult, len(batch))
+		var upgrades sync.WaitGroup
+		for i, adapter := range batch {
+			upgrades.Add(1)
+			go func() {
+				defer upgrades.Done()
+				results[i] = models.OperationResult{AdapterID: adapter.ID, Name: adapter.Name, Status: "succeeded"}
+				if err := app.upgradeAdapter(ctx, adapter, rollout.ImageTag, timeout); err != nil {
+					results[i].Status = "failed"
+					results[i].Error = failureCause(err)
+				}
+			}()
+		}
+		upgrades.Wait()
+		if ctx.Err() != nil {
+			// Upgrades cut short by shutdown are not failures, they are retried on resume
+			return
+		}
+		for _, result := range results {
+			setRolloutResult(&rollout, result)
+			if result.Status == "failed" {
+				rollout.Failed++
+			} else {
+				rollout.Succeeded++
+			}
+		}
+		if float64(rollout.Failed)/float64(rollout.Failed+rollout.Succeeded) > rollout.MaxFailureRatio {
+			rollout.Status = "halted"
+			break
+		}
+		app.recordRollout(ctx, rollout)
+		select {
+		case <-time.After(time.Duration(rollout.PauseSeconds) * time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+	app.recordRollout(context.WithoutCancel(ctx), rollout)
+	logging.Info("Rollout campaign finished", ctx, map[string]any{"ROLLOUT_ID": rollout.ID, "STATUS": rollout.Status, "SUCCEEDED": rollout.Succeeded, "FAILED": rollout.Failed})
+}
+
+// recordRollout stores the progress of a campaign
+func (app webApp) recordRollout(ctx context.Context, rollout models.RolloutCampaign) {
+	if err := app.rollouts.UpdateRollout(ctx, rollout); err != nil {
+		logging.Error("Database error when recording rollout campaign", ctx, map[string]any{"ERROR": err.Error(), "ROLLOUT_ID": rollout.ID})
+	}
+}
+
+// upgradeAdapter changes the image tag of an adapter like UpdateAdapterV1, syncs it and
+// waits for it to become ready. An adapter on the tag already, as its upgrade was interrupted,
+// is synced and waited for all the same.
+func (app webApp) upgradeAdapter(ctx context.Context, adapter models.Adapter, imageTag string, timeout time.Duration) error {
+	candidate := adapter
+	candidate.ImageTag = imageTag
+	candidate.ImageDigest = ""
+	if err := validateAdapterSpecification(candidate); err != nil {
+		return err
+	}
+	if err := app.checkImagePolicy(ctx, candidate); err != nil {
+		return err
+	}
+	upgraded := adapter
+	if adapter.ImageTag != imageTag {
+		var err error
+		upgraded, err = app.adapters.UpdateAdapter(ctx, adapter.ID, store.AdapterUpdate{ImageTag: &imageTag})
+		if err != nil {
+			return storeError(ctx, err, "adapter")
+		}
+		app.events.Publish(ctx, events.Updated, models.AdapterEvent{AdapterID: upgraded.ID, Adapter: &upgraded})
+	}
+	if err := app.syncAdapter(ctx, upgraded); err != nil {
+		return err
+	}
+	// Read back the digest the sync applied, which the Deployment is expected to run
+	synced, err := app.adapters.GetAdapter(ctx, adapter.ID)
+	if err != nil {
+		return storeError(ctx, err, "adapter")
+	}
+	return app.kubernetes.WaitForAdapterRollout(ctx, synced, timeout)
+}
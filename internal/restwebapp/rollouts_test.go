@@ -0,0 +1,74 @@
+package restwebapp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+)
+
+func TestPendingRolloutAdapters(t *testing.T) {
+	const image = "ghcr.io/kaese72/hue-adapter"
+	adapters := []models.Adapter{
+		{ID: 4, ImageName: image, ImageTag: "1.0.0"},
+		{ID: 1, ImageName: image, ImageTag: "1.0.0"},
+		{ID: 2, ImageName: image, ImageTag: "1.1.0"},
+		{ID: 3, ImageName: "ghcr.io/kaese72/zigbee-adapter", ImageTag: "1.0.0"},
+		{ID: 5, ImageName: image, ImageTag: "1.0.0", ImageDigest: "sha256:abc"},
+		{ID: 6, ImageName: image},
+	}
+	tests := []struct {
+		name    string
+		results models.OperationResults
+		want    []int
+	}{
+		{name: "fresh campaign", want: []int{1, 4}},
+		{name: "upgraded adapter done", results: models.OperationResults{{AdapterID: 1, Status: "succeeded"}}, want: []int{4}},
+		{name: "failed adapter not retried", results: models.OperationResults{{AdapterID: 4, Status: "failed"}}, want: []int{1}},
+		{name: "everything done", results: models.OperationResults{{AdapterID: 1, Status: "succeeded"}, {AdapterID: 4, Status: "failed"}}, want: []int{}},
+		{name: "interrupted upgrade on the new tag first", results: models.OperationResults{{AdapterID: 2, Status: "running"}}, want: []int{2, 1, 4}},
+		{name: "interrupted upgrade on the old tag first", results: models.OperationResults{{AdapterID: 4, Status: "running"}}, want: []int{4, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rollout := models.RolloutCampaign{ImageName: image, ImageTag: "1.1.0", Results: test.results}
+			got := []int{}
+			for _, adapter := range pendingRolloutAdapters(adapters, rollout) {
+				got = append(got, adapter.ID)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("pendingRolloutAdapters() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSetRolloutResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		results models.OperationResults
+		result  models.OperationResult
+		want    models.OperationResults
+	}{
+		{
+			name:   "first result",
+			result: models.OperationResult{AdapterID: 1, Status: "running"},
+			want:   models.OperationResults{{AdapterID: 1, Status: "running"}},
+		},
+		{
+			name:    "replaces the running result",
+			results: models.OperationResults{{AdapterID: 1, Status: "running"}, {AdapterID: 2, Status: "running"}},
+			result:  models.OperationResult{AdapterID: 2, Status: "failed", Error: "not ready"},
+			want:    models.OperationResults{{AdapterID: 1, Status: "running"}, {AdapterID: 2, Status: "failed", Error: "not ready"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rollout := models.RolloutCampaign{Results: test.results}
+			setRolloutResult(&rollout, test.result)
+			if !reflect.DeepEqual(rollout.Results, test.want) {
+				t.Errorf("Results = %v, want %v", rollout.Results, test.want)
+			}
+		})
+	}
+}
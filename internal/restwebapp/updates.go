@@ -0,0 +1,160 @@
+package restwebapp
+
+import (
+	"context"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/internal/config"
+	"github.com/Kaese72/adapter-attendant/internal/events"
+	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/internal/registry"
+	"github.com/Kaese72/adapter-attendant/internal/store"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+)
+
+const (
+	// disabledPollRecheck is how often a disabled poller checks whether polling has been enabled by a reload
+	disabledPollRecheck = time.Minute
+	// updatePollLeaseName names the lease of the replica polling registries, so that replicas do not
+	// poll, and apply updates, at the same time
+	updatePollLeaseName = "image-update-poll"
+)
+
+// PollImageUpdates periodically looks for newer images of adapters that have an update policy,
+// until ctx is cancelled. The interval is read again after every poll so reloads apply.
+// Polls are skipped while another replica holds the poll lease, which is held for an interval
+// after every poll so that registries are polled once per interval whatever the number of replicas.
+func (app webApp) PollImageUpdates(ctx context.Context) {
+	holder := newLeaseHolder()
+	for {
+		interval := config.Loaded().Adapters.UpdatePollInterval
+		wait := interval
+		if interval == 0 {
+			wait = disabledPollRecheck
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+		interval = config.Loaded().Adapters.UpdatePollInterval
+		if interval == 0 || !app.acquireLease(ctx, updatePollLeaseName, holder, interval) {
+			continue
+		}
+		pollCtx, stopPoll := context.WithCancel(ctx)
+		stopRenewing := app.holdLease(pollCtx, stopPoll, updatePollLeaseName, holder, interval)
+		app.checkImageUpdates(pollCtx)
+		stopPoll()
+		stopRenewing()
+	}
+}
+
+// checkImageUpdates polls the registries of all adapters once
+func (app webApp) checkImageUpdates(ctx context.Context) {
+	ctx, done := app.lifecycle.startJob(ctx)
+	defer done()
+	adapters, err := app.adapters.ListAdapters(ctx)
+	if err != nil {
+		logging.Error("Database error when listing adapters to check for image updates", ctx, map[string]any{"ERROR": err.Error()})
+		return
+	}
+	found := 0
+	failed := 0
+	for _, adapter := range adapters {
+		if ctx.Err() != nil {
+			break
+		}
+		if !adapter.UpdatePolicy.Tracking() {
+			continue
+		}
+		update, err := app.findImageUpdate(ctx, adapter)
+		if err != nil {
+			logging.Error("Error checking registry for image updates", ctx, map[string]any{"ERROR": err.Error(), "ADAPTER_ID": adapter.ID, "IMAGE": adapter.ImageName})
+			failed++
+			continue
+		}
+		if update == nil {
+			if adapter.AvailableUpdate != nil {
+				app.recordImageUpdate(ctx, adapter, nil)
+			}
+			continue
+		}
+		found++
+		if adapter.UpdatePolicy.Apply {
+			app.applyImageUpdate(ctx, adapter, *update)
+			continue
+		}
+		app.recordImageUpdate(ctx, adapter, update)
+	}
+	logging.Info("Checked registries for image updates", ctx, map[string]any{"FOUND": found, "FAILED": failed})
+}
+
+// findImageUpdate returns the image an adapter should be updated to according to its update policy,
+// or nil if it is up to date
+func (app webApp) findImageUpdate(ctx context.Context, adapter models.Adapter) (*models.AvailableUpdate, error) {
+	credentials, err := app.registryCredentials(ctx, adapter)
+	if err != nil {
+		return nil, err
+	}
+	switch adapter.UpdatePolicy.Mode {
+	case models.UpdatePolicyPatch, models.UpdatePolicyMinor:
+		tags, err := app.registry.Tags(ctx, adapter.ImageName, credentials)
+		if err != nil {
+			return nil, err
+		}
+		latest := registry.LatestUpdate(adapter.ImageTag, tags, adapter.UpdatePolicy.Mode == models.UpdatePolicyPatch)
+		if latest == "" {
+			return nil, nil
+		}
+		return &models.AvailableUpdate{ImageTag: latest, Checked: time.Now()}, nil
+	case models.UpdatePolicyDigest:
+		digest, err := app.registry.Digest(ctx, adapter.ImageName, adapter.ImageTag, credentials)
+		if err != nil {
+			return nil, err
+		}
+		// An adapter following its tag runs the digest applied by its last sync
+		current := adapter.ImageDigest
+		if current == "" {
+			current = adapter.SyncedDigest
+		}
+		if digest == current {
+			return nil, nil
+		}
+		return &models.AvailableUpdate{ImageTag: adapter.ImageTag, ImageDigest: digest, Checked: time.Now()}, nil
+	}
+	return nil, nil
+}
+
+// recordImageUpdate stores the update found for an adapter, nil clearing it
+func (app webApp) recordImageUpdate(ctx context.Context, adapter models.Adapter, update *models.AvailableUpdate) {
+	if err := app.adapters.SetAvailableUpdate(ctx, adapter.ID, update); err != nil {
+		logging.Error("Database error when recording available image update", ctx, map[string]any{"ERROR": err.Error(), "ADAPTER_ID": adapter.ID})
+	}
+}
+
+// applyImageUpdate changes the image of an adapter like UpdateAdapterV1 and, if the adapter has
+// been synced before, syncs it. The update is left recorded as available if it is not allowed by
+// the image policy or could not be applied.
+func (app webApp) applyImageUpdate(ctx context.Context, adapter models.Adapter, update models.AvailableUpdate) {
+	candidate := adapter
+	candidate.ImageTag = update.ImageTag
+	candidate.ImageDigest = update.ImageDigest
+	if err := app.checkImagePolicy(ctx, candidate); err != nil {
+		// checkImagePolicy logs why, the update is left for an operator to look at
+		app.recordImageUpdate(ctx, adapter, &update)
+		return
+	}
+	logging.Info("Applying image update", ctx, map[string]any{"ADAPTER_ID": adapter.ID, "IMAGE_TAG": update.ImageTag, "IMAGE_DIGEST": update.ImageDigest})
+	updated, err := app.adapters.UpdateAdapter(ctx, adapter.ID, store.AdapterUpdate{ImageTag: &update.ImageTag, ImageDigest: &update.ImageDigest})
+	if err != nil {
+		logging.Error("Database error when applying image update", ctx, map[string]any{"ERROR": err.Error(), "ADAPTER_ID": adapter.ID})
+		app.recordImageUpdate(ctx, adapter, &update)
+		return
+	}
+	app.events.Publish(ctx, events.Updated, models.AdapterEvent{AdapterID: updated.ID, Adapter: &updated})
+	if adapter.Synced == nil {
+		return
+	}
+	// syncAdapter logs its own errors, the adapter is left unsynced for the next sync to pick up
+	_ = app.syncAdapter(ctx, updated)
+}
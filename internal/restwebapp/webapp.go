@@ -2,25 +2,50 @@ package restwebapp
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
+	"net/http"
+	"reflect"
+	"time"
 
+	"github.com/Kaese72/adapter-attendant/internal/auth"
 	"github.com/Kaese72/adapter-attendant/internal/config"
 	"github.com/Kaese72/adapter-attendant/internal/database"
+	"github.com/Kaese72/adapter-attendant/internal/events"
+	"github.com/Kaese72/adapter-attendant/internal/imagepolicy"
 	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/internal/metrics"
+	"github.com/Kaese72/adapter-attendant/internal/registry"
+	"github.com/Kaese72/adapter-attendant/internal/store"
 	"github.com/Kaese72/adapter-attendant/rest/models"
 	"github.com/danielgtaylor/huma/v2"
 )
 
 type webApp struct {
-	kubernetes database.KubeHandle
-	db         *sql.DB
+	kubernetes  database.KubeHandle
+	adapters    store.AdapterStore
+	webhooks    store.WebhookStore
+	operations  store.OperationStore
+	rollouts    store.RolloutStore
+	credentials store.RegistryCredentialStore
+	leases      store.LeaseStore
+	registry    *registry.Client
+	events      *events.Hub
+	lifecycle   *lifecycle
 }
 
-func NewWebApp(kubernetes database.KubeHandle, db *sql.DB) webApp {
+func NewWebApp(kubernetes database.KubeHandle, db store.Store, eventHub *events.Hub) webApp {
 	return webApp{
-		kubernetes: kubernetes,
-		db:         db,
+		kubernetes:  kubernetes,
+		adapters:    db,
+		webhooks:    db,
+		operations:  db,
+		rollouts:    db,
+		credentials: db,
+		leases:      db,
+		registry:    registry.NewClient(),
+		events:      eventHub,
+		lifecycle:   newLifecycle(),
 	}
 }
 
@@ -29,9 +54,9 @@ func (app webApp) GetAdaptersV1(ctx context.Context, input *struct {
 }) (*struct {
 	Body []models.Adapter
 }, error) {
-	retAdapters, err := app.getAdaptersV1(ctx, nil)
+	retAdapters, err := app.adapters.ListAdapters(ctx)
 	if err != nil {
-		return nil, err
+		return nil, storeError(ctx, err, "adapter")
 	}
 	return &struct {
 		Body []models.Adapter
@@ -40,32 +65,46 @@ func (app webApp) GetAdaptersV1(ctx context.Context, input *struct {
 	}, nil
 }
 
-// getAdaptersV1 is a helper function to get adapters, optionally by id
-// Returns an API friendly error
-func (app webApp) getAdaptersV1(ctx context.Context, id *int) ([]models.Adapter, error) {
-	retAdapters := []models.Adapter{}
-	query := "SELECT id, name, imageName, imageTag, created, updated, synced FROM adapters"
-	queryArguments := []interface{}{}
-	if id != nil {
-		query += " WHERE id = ?"
-		queryArguments = append(queryArguments, *id)
-	}
-	rows, err := app.db.QueryContext(ctx, query, queryArguments...)
-	if err != nil {
-		logging.Error("Database error when fetching adapters", ctx, map[string]interface{}{"ERROR": err.Error()})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var retAdapter models.Adapter
-		err := rows.Scan(&retAdapter.ID, &retAdapter.Name, &retAdapter.ImageName, &retAdapter.ImageTag, &retAdapter.Created, &retAdapter.Updated, &retAdapter.Synced)
-		if err != nil {
-			logging.Error("Database error when fetching adapter", ctx, map[string]interface{}{"ERROR": err.Error()})
-			return nil, huma.Error500InternalServerError("Internal Server Error")
-		}
-		retAdapters = append(retAdapters, retAdapter)
+// storeError converts an error returned by the store into an API friendly error
+// what names the kind of entity, eg. "adapter"
+func storeError(ctx context.Context, err error, what string) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return huma.Error404NotFound(what + " not found")
+	case errors.Is(err, store.ErrConflict):
+		return huma.Error409Conflict(what + " conflict")
+	}
+	logging.Error("Database error", ctx, map[string]any{"ERROR": err.Error(), "ENTITY": what})
+	return internalError(err)
+}
+
+// causedError is an API friendly error that keeps the error causing it
+type causedError struct {
+	apiError error
+	cause    error
+}
+
+func (err causedError) Error() string {
+	return err.apiError.Error()
+}
+
+// Unwrap returns the API friendly error, which is what huma responds with
+func (err causedError) Unwrap() error {
+	return err.apiError
+}
+
+// internalError hides cause from API responses, while keeping it for the results of operations
+func internalError(cause error) error {
+	return causedError{apiError: huma.Error500InternalServerError("Internal Server Error"), cause: cause}
+}
+
+// failureCause describes an error returned by a handler helper for the results of operations
+func failureCause(err error) string {
+	var caused causedError
+	if errors.As(err, &caused) {
+		return caused.cause.Error()
 	}
-	return retAdapters, nil
+	return err.Error()
 }
 
 // GetAdapterV1 returns a specific adapter by id
@@ -74,17 +113,14 @@ func (app webApp) GetAdapterV1(ctx context.Context, input *struct {
 }) (*struct {
 	Body models.Adapter
 }, error) {
-	retAdapters, err := app.getAdaptersV1(ctx, &input.Id)
+	retAdapter, err := app.adapters.GetAdapter(ctx, input.Id)
 	if err != nil {
-		return nil, err
-	}
-	if len(retAdapters) == 0 {
-		return nil, huma.Error404NotFound("adapter not found")
+		return nil, storeError(ctx, err, "adapter")
 	}
 	return &struct {
 		Body models.Adapter
 	}{
-		Body: retAdapters[0],
+		Body: retAdapter,
 	}, nil
 }
 
@@ -94,20 +130,25 @@ func (app webApp) PostAdapterV1(ctx context.Context, input *struct {
 }) (*struct {
 	Body models.Adapter
 }, error) {
-	// Override adapter.Name based on REST endpoint
-	query := `INSERT IGNORE INTO adapters (name, imageName, imageTag) 
-			  VALUES (?, ?, ?)
-			  RETURNING id, name, imageName, imageTag, created, updated, synced`
-	rows := app.db.QueryRowContext(ctx, query, input.Body.Name, input.Body.ImageName, input.Body.ImageTag)
-	var resultAdapter models.Adapter
-	err := rows.Scan(&resultAdapter.ID, &resultAdapter.Name, &resultAdapter.ImageName, &resultAdapter.ImageTag, &resultAdapter.Created, &resultAdapter.Updated, &resultAdapter.Synced)
+	if err := validateAdapterSpecification(input.Body); err != nil {
+		return nil, err
+	}
+	if err := checkSecurityRelaxation(ctx, input.Body.Security); err != nil {
+		return nil, err
+	}
+	if err := app.checkPullCredential(ctx, input.Body); err != nil {
+		return nil, err
+	}
+	if err := app.checkImagePolicy(ctx, input.Body); err != nil {
+		return nil, err
+	}
+	newAdapter := input.Body
+	newAdapter.Network = database.AdapterNetworkWithDefaults(newAdapter.Network)
+	resultAdapter, err := app.adapters.CreateAdapter(ctx, newAdapter)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, huma.Error409Conflict("adapter conflict")
-		}
-		logging.Error("Database error when inserting adapter", ctx, map[string]interface{}{"ERROR": err.Error()})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
+		return nil, storeError(ctx, err, "adapter")
 	}
+	app.events.Publish(ctx, events.Created, models.AdapterEvent{AdapterID: resultAdapter.ID, Adapter: &resultAdapter})
 
 	return &struct {
 		Body models.Adapter
@@ -121,91 +162,342 @@ func (app webApp) DeleteAdapterV1(ctx context.Context, input *struct {
 	Id int `path:"id" doc:"the Id of the adapter to delete"`
 }) (*struct {
 }, error) {
-	// Override adapter.Name based on REST endpoint
-	query := `DELETE FROM adapters WHERE id = ?`
-	_, err := app.db.ExecContext(ctx, query, input.Id)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, huma.Error404NotFound("adapter not found")
-		}
-		logging.Error("Database error when deleting adapter", ctx, map[string]interface{}{"ERROR": err.Error()})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
+	if err := app.adapters.DeleteAdapter(ctx, input.Id); err != nil {
+		return nil, storeError(ctx, err, "adapter")
 	}
+	app.events.Publish(ctx, events.Deleted, models.AdapterEvent{AdapterID: input.Id})
 	return nil, nil
 }
 
-// SyncAdapterV1 triggers a sync for the adapter
+// SyncAdapterV1 triggers a sync for the adapter, or with dryRun shows what a sync would change
 func (app webApp) SyncAdapterV1(ctx context.Context, input *struct {
-	Id int `path:"id" doc:"the Id of the adapter to sync"`
+	Id     int  `path:"id" doc:"the Id of the adapter to sync"`
+	DryRun bool `query:"dryRun" doc:"validate the sync with the Kubernetes API and return what it would change, without changing anything"`
 }) (*struct {
+	Status int
+	Body   *models.SyncDiff
 }, error) {
-	syncAdapters, err := app.getAdaptersV1(ctx, &input.Id)
+	if input.DryRun {
+		syncAdapter, err := app.adapters.GetAdapter(ctx, input.Id)
+		if err != nil {
+			return nil, storeError(ctx, err, "adapter")
+		}
+		syncArguments, err := app.adapterArguments(ctx, syncAdapter.ID)
+		if err != nil {
+			return nil, err
+		}
+		syncAdapter, err = app.resolveImage(ctx, syncAdapter)
+		if err != nil {
+			return nil, err
+		}
+		if err := app.checkImagePolicy(ctx, syncAdapter); err != nil {
+			return nil, err
+		}
+		credential, err := app.pullCredential(ctx, syncAdapter)
+		if err != nil {
+			return nil, err
+		}
+		diff, err := app.kubernetes.DryRunAdapter(ctx, syncAdapter, syncArguments, credential)
+		if err != nil {
+			logging.Error("Error dry running sync", ctx, map[string]any{"ERROR": err.Error(), "ADAPTER_ID": syncAdapter.ID})
+			return nil, huma.Error500InternalServerError("Internal Server Error")
+		}
+		return &struct {
+			Status int
+			Body   *models.SyncDiff
+		}{
+			Status: http.StatusOK,
+			Body:   &diff,
+		}, nil
+	}
+	ctx, done := app.lifecycle.startJob(ctx)
+	defer done()
+	syncAdapter, err := app.adapters.GetAdapter(ctx, input.Id)
 	if err != nil {
+		return nil, storeError(ctx, err, "adapter")
+	}
+	if err := app.syncAdapter(ctx, syncAdapter); err != nil {
 		return nil, err
 	}
-	if len(syncAdapters) == 0 {
-		return nil, huma.Error404NotFound("adapter not found")
+	return &struct {
+		Status int
+		Body   *models.SyncDiff
+	}{
+		Status: http.StatusNoContent,
+	}, nil
+}
+
+// adapterArguments returns the configuration of an adapter as it is passed to Kubernetes
+// Returns an API friendly error
+func (app webApp) adapterArguments(ctx context.Context, adapterId int) (map[string]string, error) {
+	configurations, err := app.adapters.ListAdapterConfiguration(ctx, adapterId)
+	if err != nil {
+		return nil, storeError(ctx, err, "adapter configuration")
+	}
+	arguments := map[string]string{}
+	for _, config := range configurations {
+		arguments[config.ConfigKey] = config.ConfigValue
+	}
+	return arguments, nil
+}
+
+// syncAdapter applies an adapter and its arguments to Kubernetes and records the sync
+// Returns an API friendly error
+func (app webApp) syncAdapter(ctx context.Context, syncAdapter models.Adapter) error {
+	syncArguments, err := app.adapterArguments(ctx, syncAdapter.ID)
+	if err != nil {
+		return err
 	}
-	syncConfigurations, err := app.getAdapterArgumentsV1(ctx, input.Id)
+	syncAdapter, err = app.resolveImage(ctx, syncAdapter)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	syncArguments := map[string]string{}
-	for _, config := range syncConfigurations {
-		syncArguments[config.ConfigKey] = config.ConfigValue
+	if err := app.checkImagePolicy(ctx, syncAdapter); err != nil {
+		return err
+	}
+	credential, err := app.pullCredential(ctx, syncAdapter)
+	if err != nil {
+		return err
 	}
-	syncAdapter := syncAdapters[0]
 	logging.Info("Starting sync for adapter", ctx, map[string]any{"ADAPTER_ID": syncAdapter.ID, "ADAPTER_NAME": syncAdapter.Name})
-	err = app.kubernetes.ApplyAdapter(ctx, syncAdapter.ID, syncAdapter.ImageName+":"+syncAdapter.ImageTag, syncArguments)
+	syncStart := time.Now()
+	err = app.kubernetes.ApplyAdapter(ctx, syncAdapter, syncArguments, credential)
+	metrics.ObserveSync(syncStart, err)
 	if err != nil {
 		logging.Error("Error syncing adapter", ctx, map[string]any{"ERROR": err.Error(), "ADAPTER_ID": syncAdapter.ID, "ADAPTER_NAME": syncAdapter.Name})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
+		return internalError(err)
 	}
-	err = app.registerAdapterSynced(ctx, syncAdapter.ID)
+	err = app.adapters.MarkAdapterSynced(ctx, syncAdapter.ID, syncAdapter.ImageDigest)
 	if err != nil {
 		logging.Error("Error registering adapter sync", ctx, map[string]any{"ERROR": err.Error(), "ADAPTER_ID": syncAdapter.ID, "ADAPTER_NAME": syncAdapter.Name})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
+		return internalError(err)
 	}
-	return nil, nil
+	app.publishAdapterEvent(ctx, events.Synced, syncAdapter.ID)
+	return nil
+}
+
+// resolveImage pins an adapter that is not pinned to a digest to the digest its tag points to,
+// if digests are resolved at sync time or the image needs its signature verified, so that what
+// runs is what was verified. The digest is only applied, the adapter keeps following its tag.
+// Returns an API friendly error
+func (app webApp) resolveImage(ctx context.Context, adapter models.Adapter) (models.Adapter, error) {
+	if adapter.ImageDigest != "" {
+		return adapter, nil
+	}
+	settings := config.Loaded().Adapters
+	if !settings.ResolveDigests && !imagepolicy.RequiresVerification(settings.ImagePolicy, adapter.ImageName) {
+		return adapter, nil
+	}
+	credentials, err := app.registryCredentials(ctx, adapter)
+	if err != nil {
+		return adapter, err
+	}
+	digest, err := app.registry.Digest(ctx, adapter.ImageName, adapter.ImageTag, credentials)
+	if err != nil {
+		logging.Error("Error resolving image digest", ctx, map[string]any{"ERROR": err.Error(), "ADAPTER_ID": adapter.ID, "IMAGE": adapter.Image()})
+		return adapter, huma.Error502BadGateway("could not resolve the digest of image " + adapter.Image())
+	}
+	adapter.ImageDigest = digest
+	return adapter, nil
+}
+
+// checkImagePolicy verifies that the image of an adapter is allowed to run
+// Returns an API friendly error
+func (app webApp) checkImagePolicy(ctx context.Context, adapter models.Adapter) error {
+	policy := config.Loaded().Adapters.ImagePolicy
+	err := imagepolicy.Allowed(policy, adapter.ImageName)
+	if err == nil && imagepolicy.RequiresVerification(policy, adapter.ImageName) {
+		resolved, resolveErr := app.resolveImage(ctx, adapter)
+		if resolveErr != nil {
+			return resolveErr
+		}
+		err = imagepolicy.Verify(ctx, policy, adapter.ImageName, resolved.ImageDigest)
+	}
+	var denied imagepolicy.DeniedError
+	if errors.As(err, &denied) {
+		logging.Info("Image denied by policy", ctx, map[string]any{"ADAPTER_ID": adapter.ID, "IMAGE": adapter.Image(), "REASON": denied.Reason})
+		return huma.Error403Forbidden("image not allowed: " + denied.Reason)
+	}
+	if err != nil {
+		logging.Error("Error verifying image", ctx, map[string]any{"ERROR": err.Error(), "ADAPTER_ID": adapter.ID, "IMAGE": adapter.Image()})
+		return huma.Error502BadGateway("could not verify image " + adapter.Image())
+	}
+	return nil
+}
+
+// validateAdapterSpecification verifies the parts of an adapter that end up in Kubernetes
+// Returns an API friendly error
+func validateAdapterSpecification(adapter models.Adapter) error {
+	if err := validateAdapterImage(adapter); err != nil {
+		return huma.Error422UnprocessableEntity(err.Error())
+	}
+	if _, err := database.AdapterResourceRequirements(adapter.Resources); err != nil {
+		return huma.Error422UnprocessableEntity(err.Error())
+	}
+	if err := database.ValidateAdapterNetwork(adapter.Network); err != nil {
+		return huma.Error422UnprocessableEntity(err.Error())
+	}
+	if err := database.ValidateAdapterProbes(adapter.Probes, adapter.Network); err != nil {
+		return huma.Error422UnprocessableEntity(err.Error())
+	}
+	if err := database.ValidateAdapterSecurity(adapter.Security); err != nil {
+		return huma.Error422UnprocessableEntity(err.Error())
+	}
+	return nil
+}
+
+// checkSecurityRelaxation verifies that the caller may relax the security settings of an adapter,
+// which only admins may do. Hardening an adapter is allowed for anyone.
+// Returns an API friendly error
+func checkSecurityRelaxation(ctx context.Context, security models.AdapterSecurity) error {
+	if security.Hardened() || auth.IsAdmin(ctx) {
+		return nil
+	}
+	return huma.Error403Forbidden("relaxing the security settings of an adapter requires the " + config.Loaded().Auth.AdminRole + " role")
+}
+
+// validateAdapterImage checks the image reference of an adapter and that its update policy can follow it
+func validateAdapterImage(adapter models.Adapter) error {
+	if err := registry.ValidateName(adapter.ImageName); err != nil {
+		return err
+	}
+	if adapter.ImageTag == "" && adapter.ImageDigest == "" {
+		return errors.New("imageTag or imageDigest must be set")
+	}
+	if adapter.ImageTag != "" {
+		if err := registry.ValidateTag(adapter.ImageTag); err != nil {
+			return err
+		}
+	}
+	if adapter.ImageDigest != "" {
+		if err := registry.ValidateDigest(adapter.ImageDigest); err != nil {
+			return err
+		}
+	}
+	switch adapter.UpdatePolicy.Mode {
+	case models.UpdatePolicyPatch, models.UpdatePolicyMinor:
+		if !registry.IsVersion(adapter.ImageTag) {
+			return fmt.Errorf("update policy %s requires an image tag that is a semantic version, not %q", adapter.UpdatePolicy.Mode, adapter.ImageTag)
+		}
+	case models.UpdatePolicyDigest:
+		if adapter.ImageTag == "" {
+			return errors.New("update policy digest requires an image tag to follow")
+		}
+	}
+	return nil
 }
 
-// UpdateAdapterV1 updates the image tag for an adapter
+// updateAdapter returns the adapter as it looks after the update
+func updateAdapter(adapter models.Adapter, update store.AdapterUpdate) models.Adapter {
+	if update.ImageTag != nil {
+		adapter.ImageTag = *update.ImageTag
+		adapter.ImageDigest = ""
+	}
+	if update.ImageDigest != nil {
+		adapter.ImageDigest = *update.ImageDigest
+	}
+	if update.PullCredentialID != nil {
+		adapter.PullCredentialID = update.PullCredentialID
+		if *update.PullCredentialID == 0 {
+			adapter.PullCredentialID = nil
+		}
+	}
+	if update.UpdatePolicy != nil {
+		adapter.UpdatePolicy = *update.UpdatePolicy
+	}
+	if update.Resources != nil {
+		adapter.Resources = *update.Resources
+	}
+	if update.Probes != nil {
+		adapter.Probes = *update.Probes
+	}
+	if update.Network != nil {
+		adapter.Network = *update.Network
+	}
+	if update.Security != nil {
+		adapter.Security = *update.Security
+	}
+	return adapter
+}
+
+// UpdateAdapterV1 updates the image tag or digest, pull credential, update policy, resources, probes, network and/or security settings for an adapter
 func (app webApp) UpdateAdapterV1(ctx context.Context, input *struct {
 	Id   int `path:"id" doc:"the Id of the adapter to update"`
 	Body struct {
-		ImageTag string `json:"imageTag" doc:"the new image tag"`
+		ImageTag         string                      `json:"imageTag,omitempty" maxLength:"64" doc:"the new image tag, clears the digest unless imageDigest is also set"`
+		ImageDigest      string                      `json:"imageDigest,omitempty" maxLength:"100" doc:"the new image digest"`
+		UpdatePolicy     *models.AdapterUpdatePolicy `json:"updatePolicy,omitempty" doc:"the new update policy, replacing the current one"`
+		PullCredentialID *int                        `json:"pullCredentialId,omitempty" minimum:"0" doc:"the Id of the registry credential to pull the image with, 0 removes the credential"`
+		Resources        *models.AdapterResources    `json:"resources,omitempty" doc:"the new resources, replacing the current ones"`
+		Probes           *models.AdapterProbes       `json:"probes,omitempty" doc:"the new probes, replacing the current ones"`
+		Network          *models.AdapterNetwork      `json:"network,omitempty" doc:"the new network settings, replacing the current ones"`
+		Security         *models.AdapterSecurity     `json:"security,omitempty" doc:"the new security settings, replacing the current ones. Relaxing them requires the admin role"`
 	} `body:""`
 }) (*struct {
 	Body models.Adapter
 }, error) {
-	if input.Body.ImageTag == "" {
-		return nil, huma.Error400BadRequest("imageTag is required")
+	if input.Body.ImageTag == "" && input.Body.ImageDigest == "" && input.Body.PullCredentialID == nil && input.Body.UpdatePolicy == nil && input.Body.Resources == nil && input.Body.Probes == nil && input.Body.Network == nil && input.Body.Security == nil {
+		return nil, huma.Error400BadRequest("imageTag, imageDigest, pullCredentialId, updatePolicy, resources, probes, network or security is required")
 	}
-	updateQuery := "UPDATE adapters SET imageTag = ? WHERE id = ?"
-	result, err := app.db.ExecContext(ctx, updateQuery, input.Body.ImageTag, input.Id)
-	if err != nil {
-		logging.Error("Database error when updating adapter", ctx, map[string]any{"ERROR": err.Error()})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
+	update := store.AdapterUpdate{
+		PullCredentialID: input.Body.PullCredentialID,
+		UpdatePolicy:     input.Body.UpdatePolicy,
+		Resources:        input.Body.Resources,
+		Probes:           input.Body.Probes,
+		Security:         input.Body.Security,
 	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		logging.Error("Database error when checking adapter update result", ctx, map[string]any{"ERROR": err.Error()})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
+	if input.Body.ImageTag != "" {
+		update.ImageTag = &input.Body.ImageTag
+	}
+	if input.Body.ImageDigest != "" {
+		update.ImageDigest = &input.Body.ImageDigest
+	}
+	if input.Body.Security != nil {
+		if err := checkSecurityRelaxation(ctx, *input.Body.Security); err != nil {
+			return nil, err
+		}
 	}
-	if rowsAffected == 0 {
-		return nil, huma.Error404NotFound("adapter not found")
+	if input.Body.Network != nil {
+		network := database.AdapterNetworkWithDefaults(*input.Body.Network)
+		update.Network = &network
 	}
-	updatedAdapters, err := app.getAdaptersV1(ctx, &input.Id)
+	currentAdapter, err := app.adapters.GetAdapter(ctx, input.Id)
 	if err != nil {
+		return nil, storeError(ctx, err, "adapter")
+	}
+	// The pull credential and image are checked before the update since checking them
+	// means talking to the store and the registry
+	checkedAdapter := updateAdapter(currentAdapter, update)
+	if err := app.checkPullCredential(ctx, checkedAdapter); err != nil {
 		return nil, err
 	}
-	if len(updatedAdapters) == 0 {
-		return nil, huma.Error404NotFound("adapter not found")
+	if update.ImageTag != nil || update.ImageDigest != nil {
+		if err := app.checkImagePolicy(ctx, checkedAdapter); err != nil {
+			return nil, err
+		}
 	}
+	update.Check = func(current models.Adapter) error {
+		// Validate the adapter as it will look after the update since
+		// eg. probes depend on the network settings
+		updatedAdapter := updateAdapter(current, update)
+		if updatedAdapter.Image() != checkedAdapter.Image() || !reflect.DeepEqual(updatedAdapter.PullCredentialID, checkedAdapter.PullCredentialID) {
+			return huma.Error409Conflict("adapter was changed while being updated, try again")
+		}
+		return validateAdapterSpecification(updatedAdapter)
+	}
+	resultAdapter, err := app.adapters.UpdateAdapter(ctx, input.Id, update)
+	var statusError huma.StatusError
+	if errors.As(err, &statusError) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, storeError(ctx, err, "adapter")
+	}
+	app.events.Publish(ctx, events.Updated, models.AdapterEvent{AdapterID: input.Id, Adapter: &resultAdapter})
 	return &struct {
 		Body models.Adapter
 	}{
-		Body: updatedAdapters[0],
+		Body: resultAdapter,
 	}, nil
 }
 
@@ -213,34 +505,30 @@ func (app webApp) UpdateAdapterV1(ctx context.Context, input *struct {
 func (app webApp) GetAdapterAddressV1(ctx context.Context, input *struct {
 	Id int `path:"id" doc:"the Id of the adapter to retrieve the address for"`
 }) (*struct {
-	Body struct {
-		Address string `json:"address"`
-	}
+	Body models.AdapterAddress
 }, error) {
-	adapters, err := app.getAdaptersV1(ctx, &input.Id)
+	adapter, err := app.adapters.GetAdapter(ctx, input.Id)
 	if err != nil {
-		return nil, err
-	}
-	if len(adapters) == 0 {
-		return nil, huma.Error404NotFound("adapter not found")
+		return nil, storeError(ctx, err, "adapter")
 	}
-	adapter := adapters[0]
 	if adapter.Synced == nil {
 		return nil, huma.Error409Conflict("adapter not synced")
 	}
-	// FIXME should probably not assume this address.
-	// Works for now...
-	address := fmt.Sprintf("http://adapter-%d.%s:8080", adapter.ID, config.Loaded.ClusterConfig.NameSpace)
+	address, err := app.kubernetes.ResolveAdapterAddress(adapter.ID)
+	if err != nil {
+		logging.Error("Error resolving adapter address", ctx, map[string]any{"ERROR": err.Error(), "ADAPTER_ID": adapter.ID})
+		return nil, huma.Error500InternalServerError("Internal Server Error")
+	}
+	if address == nil {
+		return nil, huma.Error409Conflict("adapter service not found, the adapter needs to be synced")
+	}
+	if address.ReadyEndpoints == 0 {
+		return nil, huma.Error503ServiceUnavailable("adapter has no ready endpoints")
+	}
 	return &struct {
-		Body struct {
-			Address string `json:"address"`
-		}
+		Body models.AdapterAddress
 	}{
-		Body: struct {
-			Address string `json:"address"`
-		}{
-			Address: address,
-		},
+		Body: *address,
 	}, nil
 }
 
@@ -250,9 +538,9 @@ func (app webApp) GetAdapterArgumentsForAdapterV1(ctx context.Context, input *st
 }) (*struct {
 	Body []models.AdapterConfiguration
 }, error) {
-	configurations, err := app.getAdapterArgumentsV1(ctx, input.Id)
+	configurations, err := app.adapters.ListAdapterConfiguration(ctx, input.Id)
 	if err != nil {
-		return nil, err
+		return nil, storeError(ctx, err, "adapter configuration")
 	}
 	return &struct {
 		Body []models.AdapterConfiguration
@@ -261,32 +549,6 @@ func (app webApp) GetAdapterArgumentsForAdapterV1(ctx context.Context, input *st
 	}, nil
 }
 
-// getAdapterArgumentsV1 is a helper function to get adapter configuration entries
-// Returns an API friendly error
-func (app webApp) getAdapterArgumentsV1(ctx context.Context, adapterID int) ([]models.AdapterConfiguration, error) {
-	query := "SELECT id, adapterId, configKey, configValue, created, updated FROM adapterConfiguration WHERE adapterId = ?"
-	rows, err := app.db.QueryContext(ctx, query, adapterID)
-	if err != nil {
-		logging.Error("Database error when fetching adapter arguments", ctx, map[string]any{"ERROR": err.Error()})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
-	}
-	defer rows.Close()
-	result := []models.AdapterConfiguration{}
-	for rows.Next() {
-		var config models.AdapterConfiguration
-		if err := rows.Scan(&config.ID, &config.AdapterID, &config.ConfigKey, &config.ConfigValue, &config.Created, &config.Updated); err != nil {
-			logging.Error("Database error when scanning adapter arguments", ctx, map[string]any{"ERROR": err.Error()})
-			return nil, huma.Error500InternalServerError("Internal Server Error")
-		}
-		result = append(result, config)
-	}
-	if err := rows.Err(); err != nil {
-		logging.Error("Database error when iterating adapter arguments", ctx, map[string]any{"ERROR": err.Error()})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
-	}
-	return result, nil
-}
-
 // PostAdapterArgumentsForAdapterV1 creates an adapter configuration entry
 func (app webApp) PostAdapterArgumentsForAdapterV1(ctx context.Context, input *struct {
 	Id   int                         `path:"id" doc:"the Id of the adapter to add configuration for"`
@@ -294,19 +556,11 @@ func (app webApp) PostAdapterArgumentsForAdapterV1(ctx context.Context, input *s
 }) (*struct {
 	Body models.AdapterConfiguration
 }, error) {
-	query := `INSERT IGNORE INTO adapterConfiguration (adapterId, configKey, configValue)
-			  VALUES (?, ?, ?)
-			  RETURNING id, adapterId, configKey, configValue, created, updated`
-	row := app.db.QueryRowContext(ctx, query, input.Id, input.Body.ConfigKey, input.Body.ConfigValue)
-	var resultConfig models.AdapterConfiguration
-	err := row.Scan(&resultConfig.ID, &resultConfig.AdapterID, &resultConfig.ConfigKey, &resultConfig.ConfigValue, &resultConfig.Created, &resultConfig.Updated)
+	resultConfig, err := app.adapters.CreateAdapterConfiguration(ctx, input.Id, input.Body)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, huma.Error409Conflict("adapter configuration conflict")
-		}
-		logging.Error("Database error when inserting adapter configuration", ctx, map[string]any{"ERROR": err.Error()})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
+		return nil, storeError(ctx, err, "adapter configuration")
 	}
+	app.publishAdapterEvent(ctx, events.Updated, input.Id)
 	return &struct {
 		Body models.AdapterConfiguration
 	}{
@@ -320,20 +574,10 @@ func (app webApp) DeleteAdapterArgumentsForAdapterV1(ctx context.Context, input
 	ArgumentId int `path:"argumentId" doc:"the Id of the configuration entry to delete"`
 }) (*struct {
 }, error) {
-	query := "DELETE FROM adapterConfiguration WHERE id = ? AND adapterId = ?"
-	result, err := app.db.ExecContext(ctx, query, input.ArgumentId, input.Id)
-	if err != nil {
-		logging.Error("Database error when deleting adapter configuration", ctx, map[string]any{"ERROR": err.Error()})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
-	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		logging.Error("Database error when checking adapter configuration delete result", ctx, map[string]any{"ERROR": err.Error()})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
-	}
-	if rowsAffected == 0 {
-		return nil, huma.Error404NotFound("adapter configuration not found")
+	if err := app.adapters.DeleteAdapterConfiguration(ctx, input.Id, input.ArgumentId); err != nil {
+		return nil, storeError(ctx, err, "adapter configuration")
 	}
+	app.publishAdapterEvent(ctx, events.Updated, input.Id)
 	return nil, nil
 }
 
@@ -345,29 +589,11 @@ func (app webApp) PatchAdapterArgumentsForAdapterV1(ctx context.Context, input *
 }) (*struct {
 	Body models.AdapterConfiguration
 }, error) {
-	updateQuery := `UPDATE adapterConfiguration
-				   SET configKey = ?, configValue = ?
-				   WHERE adapterId = ? AND id = ?`
-	result, err := app.db.ExecContext(ctx, updateQuery, input.Body.ConfigKey, input.Body.ConfigValue, input.AdapterId, input.ArgumentId)
-	if err != nil {
-		logging.Error("Database error when updating adapter configuration", ctx, map[string]any{"ERROR": err.Error()})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
-	}
-	rowsAffected, err := result.RowsAffected()
+	resultConfig, err := app.adapters.UpdateAdapterConfiguration(ctx, input.AdapterId, input.ArgumentId, input.Body)
 	if err != nil {
-		logging.Error("Database error when checking adapter configuration update result", ctx, map[string]any{"ERROR": err.Error()})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
-	}
-	if rowsAffected == 0 {
-		return nil, huma.Error404NotFound("adapter configuration not found")
-	}
-	selectQuery := "SELECT id, adapterId, configKey, configValue, created, updated FROM adapterConfiguration WHERE adapterId = ? AND id = ?"
-	row := app.db.QueryRowContext(ctx, selectQuery, input.AdapterId, input.ArgumentId)
-	var resultConfig models.AdapterConfiguration
-	if err := row.Scan(&resultConfig.ID, &resultConfig.AdapterID, &resultConfig.ConfigKey, &resultConfig.ConfigValue, &resultConfig.Created, &resultConfig.Updated); err != nil {
-		logging.Error("Database error when fetching updated adapter configuration", ctx, map[string]any{"ERROR": err.Error()})
-		return nil, huma.Error500InternalServerError("Internal Server Error")
+		return nil, storeError(ctx, err, "adapter configuration")
 	}
+	app.publishAdapterEvent(ctx, events.Updated, input.AdapterId)
 	return &struct {
 		Body models.AdapterConfiguration
 	}{
@@ -375,11 +601,13 @@ func (app webApp) PatchAdapterArgumentsForAdapterV1(ctx context.Context, input *
 	}, nil
 }
 
-// registerSynced updates a device with information about being synced.
-// This is an internal function and does not return API friendly errors.
-func (app webApp) registerAdapterSynced(ctx context.Context, adapterId int) error {
-	// FIXME allow passing in sync time in order to avoid time skew issues
-	updateQuery := "UPDATE adapters SET synced = NOW() WHERE id = ?"
-	_, err := app.db.ExecContext(ctx, updateQuery, adapterId)
-	return err
+// publishAdapterEvent publishes an event carrying the current state of the adapter.
+// Failing to look up the adapter does not prevent the event from being published.
+func (app webApp) publishAdapterEvent(ctx context.Context, eventType string, adapterId int) {
+	event := models.AdapterEvent{AdapterID: adapterId}
+	adapter, err := app.adapters.GetAdapter(ctx, adapterId)
+	if err == nil {
+		event.Adapter = &adapter
+	}
+	app.events.Publish(ctx, eventType, event)
 }
@@ -0,0 +1,118 @@
+package restwebapp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/internal/webhooks"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// GetWebhooksV1 returns all webhook subscriptions
+func (app webApp) GetWebhooksV1(ctx context.Context, input *struct {
+}) (*struct {
+	Body []models.WebhookSubscription
+}, error) {
+	subscriptions, err := app.webhooks.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		return nil, storeError(ctx, err, "webhook subscription")
+	}
+	return &struct {
+		Body []models.WebhookSubscription
+	}{
+		Body: subscriptions,
+	}, nil
+}
+
+// GetWebhookV1 returns a specific webhook subscription
+func (app webApp) GetWebhookV1(ctx context.Context, input *struct {
+	Id int `path:"id" doc:"the Id of the webhook subscription"`
+}) (*struct {
+	Body models.WebhookSubscription
+}, error) {
+	subscription, err := app.webhooks.GetWebhookSubscription(ctx, input.Id)
+	if err != nil {
+		return nil, storeError(ctx, err, "webhook subscription")
+	}
+	return &struct {
+		Body models.WebhookSubscription
+	}{
+		Body: subscription,
+	}, nil
+}
+
+// PostWebhookV1 creates a webhook subscription
+func (app webApp) PostWebhookV1(ctx context.Context, input *struct {
+	Body models.WebhookSubscription `body:""`
+}) (*struct {
+	Body models.WebhookSubscription
+}, error) {
+	if err := webhooks.ValidateTarget(ctx, input.Body.TargetURL); err != nil {
+		return nil, huma.Error422UnprocessableEntity(err.Error())
+	}
+	secret := input.Body.Secret
+	if secret == "" {
+		randomBytes := make([]byte, 32)
+		if _, err := rand.Read(randomBytes); err != nil {
+			logging.Error("Could not generate webhook secret", ctx, map[string]any{"ERROR": err.Error()})
+			return nil, huma.Error500InternalServerError("Internal Server Error")
+		}
+		secret = hex.EncodeToString(randomBytes)
+	}
+	newSubscription := input.Body
+	newSubscription.Secret = secret
+	subscription, err := app.webhooks.CreateWebhookSubscription(ctx, newSubscription)
+	if err != nil {
+		return nil, storeError(ctx, err, "webhook subscription")
+	}
+	// The secret is only ever returned here, so that generated secrets can be picked up
+	subscription.Secret = secret
+	return &struct {
+		Body models.WebhookSubscription
+	}{
+		Body: subscription,
+	}, nil
+}
+
+// DeleteWebhookV1 deletes a webhook subscription along with its dead letters
+func (app webApp) DeleteWebhookV1(ctx context.Context, input *struct {
+	Id int `path:"id" doc:"the Id of the webhook subscription to delete"`
+}) (*struct {
+}, error) {
+	if err := app.webhooks.DeleteWebhookSubscription(ctx, input.Id); err != nil {
+		return nil, storeError(ctx, err, "webhook subscription")
+	}
+	return nil, nil
+}
+
+// GetWebhookDeadLettersV1 returns events that could not be delivered to a webhook subscription
+func (app webApp) GetWebhookDeadLettersV1(ctx context.Context, input *struct {
+	Id int `path:"id" doc:"the Id of the webhook subscription"`
+}) (*struct {
+	Body []models.WebhookDeadLetter
+}, error) {
+	deadLetters, err := app.webhooks.ListWebhookDeadLetters(ctx, input.Id)
+	if err != nil {
+		return nil, storeError(ctx, err, "webhook dead letter")
+	}
+	return &struct {
+		Body []models.WebhookDeadLetter
+	}{
+		Body: deadLetters,
+	}, nil
+}
+
+// DeleteWebhookDeadLetterV1 removes a dead letter once it has been dealt with
+func (app webApp) DeleteWebhookDeadLetterV1(ctx context.Context, input *struct {
+	Id           int `path:"id" doc:"the Id of the webhook subscription"`
+	DeadLetterId int `path:"deadLetterId" doc:"the Id of the dead letter to delete"`
+}) (*struct {
+}, error) {
+	if err := app.webhooks.DeleteWebhookDeadLetter(ctx, input.Id, input.DeadLetterId); err != nil {
+		return nil, storeError(ctx, err, "webhook dead letter")
+	}
+	return nil, nil
+}
@@ -0,0 +1,58 @@
+// Package sealing encrypts secrets stored in the database with AES-GCM.
+package sealing
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// newAEAD creates the AES-GCM cipher of a 32 byte key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	return aead, errors.Wrap(err, "failed to create cipher")
+}
+
+// Seal encrypts plaintext, returning the nonce and ciphertext as base64.
+// additionalData, eg. the Id of the row, binds the sealed value to where it is stored.
+func Seal(key []byte, plaintext string, additionalData string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "failed to generate nonce")
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(additionalData))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value sealed by Seal with the same additionalData
+func Open(key []byte, sealed string, additionalData string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", errors.Wrap(err, "sealed value is not base64")
+	}
+	if len(decoded) < aead.NonceSize() {
+		return "", fmt.Errorf("sealed value is too short")
+	}
+	nonce, ciphertext := decoded[:aead.NonceSize()], decoded[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(additionalData))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decrypt sealed value, was the encryption key changed?")
+	}
+	return string(plaintext), nil
+}
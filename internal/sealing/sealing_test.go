@@ -0,0 +1,56 @@
+package sealing
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	otherKey := bytes.Repeat([]byte{2}, 32)
+	sealed, err := Seal(key, "hunter2", "registryCredentials.password:1")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	tests := []struct {
+		name           string
+		key            []byte
+		sealed         string
+		additionalData string
+		want           string
+		wantErr        bool
+	}{
+		{name: "same key and data", key: key, sealed: sealed, additionalData: "registryCredentials.password:1", want: "hunter2"},
+		{name: "other data", key: key, sealed: sealed, additionalData: "registryCredentials.password:2", wantErr: true},
+		{name: "other key", key: otherKey, sealed: sealed, additionalData: "registryCredentials.password:1", wantErr: true},
+		{name: "not base64", key: key, sealed: "not base64!", additionalData: "registryCredentials.password:1", wantErr: true},
+		{name: "too short", key: key, sealed: "AAAA", additionalData: "registryCredentials.password:1", wantErr: true},
+		{name: "invalid key", key: []byte("short"), sealed: sealed, additionalData: "registryCredentials.password:1", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Open(test.key, test.sealed, test.additionalData)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Open() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("Open() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSealUsesFreshNonces(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	first, err := Seal(key, "hunter2", "")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	second, err := Seal(key, "hunter2", "")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if first == second {
+		t.Errorf("Seal() sealed the same plaintext to %q twice", first)
+	}
+}
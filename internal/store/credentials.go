@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/pkg/errors"
+)
+
+// registryCredentialColumns are the columns read by scanRegistryCredential, in order
+const registryCredentialColumns = "id, registry, username, created, updated"
+
+// scanRegistryCredential reads a row selected using registryCredentialColumns
+func scanRegistryCredential(row interface{ Scan(...any) error }) (models.RegistryCredential, error) {
+	var credential models.RegistryCredential
+	err := row.Scan(&credential.ID, &credential.Registry, &credential.Username, &credential.Created, &credential.Updated)
+	return credential, err
+}
+
+func (store sqlStore) ListRegistryCredentials(ctx context.Context) ([]models.RegistryCredential, error) {
+	rows, err := store.query(ctx, "SELECT "+registryCredentialColumns+" FROM registryCredentials")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list registry credentials")
+	}
+	defer rows.Close()
+	credentials := []models.RegistryCredential{}
+	for rows.Next() {
+		credential, err := scanRegistryCredential(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read registry credential")
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, errors.Wrap(rows.Err(), "failed to list registry credentials")
+}
+
+func (store sqlStore) GetRegistryCredential(ctx context.Context, id int) (models.RegistryCredential, error) {
+	credential, err := scanRegistryCredential(store.queryRow(ctx, "SELECT "+registryCredentialColumns+" FROM registryCredentials WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return models.RegistryCredential{}, ErrNotFound
+	}
+	return credential, errors.Wrap(err, "failed to get registry credential")
+}
+
+func (store sqlStore) GetRegistryCredentialPassword(ctx context.Context, id int) (string, error) {
+	var password string
+	err := store.queryRow(ctx, "SELECT password FROM registryCredentials WHERE id = ?", id).Scan(&password)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return password, errors.Wrap(err, "failed to get registry credential password")
+}
+
+func (store sqlStore) CreateRegistryCredential(ctx context.Context, credential models.RegistryCredential, seal func(id int) (string, error)) (models.RegistryCredential, error) {
+	var id int
+	// The password is sealed once the Id is known, the credential is never stored without it
+	err := store.inTransaction(ctx, func(transaction transaction) error {
+		err := transaction.queryRow(ctx, "INSERT INTO registryCredentials (registry, username, password) VALUES (?, ?, ?) RETURNING id", credential.Registry, credential.Username, "").Scan(&id)
+		if err != nil {
+			return errors.Wrap(err, "failed to insert registry credential")
+		}
+		sealed, err := seal(id)
+		if err != nil {
+			return errors.Wrap(err, "failed to seal registry credential password")
+		}
+		_, err = transaction.exec(ctx, "UPDATE registryCredentials SET password = ? WHERE id = ?", sealed, id)
+		return errors.Wrap(err, "failed to store registry credential password")
+	})
+	if err != nil {
+		return models.RegistryCredential{}, err
+	}
+	return store.GetRegistryCredential(ctx, id)
+}
+
+func (store sqlStore) UpdateRegistryCredential(ctx context.Context, id int, credential models.RegistryCredential) (models.RegistryCredential, error) {
+	query := "UPDATE registryCredentials SET registry = ?, username = ?"
+	arguments := []interface{}{credential.Registry, credential.Username}
+	if credential.Password != "" {
+		query += ", password = ?"
+		arguments = append(arguments, credential.Password)
+	}
+	// An update that changes nothing affects no rows, so existence is checked by reading the credential back
+	if _, err := store.exec(ctx, query+" WHERE id = ?", append(arguments, id)...); err != nil {
+		return models.RegistryCredential{}, errors.Wrap(err, "failed to update registry credential")
+	}
+	updated, err := store.GetRegistryCredential(ctx, id)
+	if err != nil {
+		return models.RegistryCredential{}, err
+	}
+	// Adapters pulling with the credential need a sync to pick up the change
+	if _, err := store.exec(ctx, "UPDATE adapters SET updated = CURRENT_TIMESTAMP WHERE pullCredentialId = ?", id); err != nil {
+		return models.RegistryCredential{}, errors.Wrap(err, "failed to mark adapters using the registry credential as changed")
+	}
+	return updated, nil
+}
+
+func (store sqlStore) DeleteRegistryCredential(ctx context.Context, id int) error {
+	var users int
+	if err := store.queryRow(ctx, "SELECT COUNT(*) FROM adapters WHERE pullCredentialId = ?", id).Scan(&users); err != nil {
+		return errors.Wrap(err, "failed to count adapters using the registry credential")
+	}
+	if users > 0 {
+		return ErrConflict
+	}
+	return affectedOne(store.exec(ctx, "DELETE FROM registryCredentials WHERE id = ?", id))
+}
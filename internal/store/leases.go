@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func (store sqlStore) AcquireLease(ctx context.Context, name string, holder string, now time.Time, lockedUntil time.Time) error {
+	// Times are stored as Unix seconds, which compare the same way in every database
+	err := affectedOne(store.exec(ctx, "UPDATE leases SET holder = ?, lockedUntil = ? WHERE name = ? AND (holder = ? OR lockedUntil <= ?)",
+		holder, lockedUntil.Unix(), name, holder, now.Unix()))
+	if err != ErrNotFound {
+		return errors.Wrap(err, "failed to acquire lease")
+	}
+	_, err = store.insertIgnore(ctx, "INTO leases (name, holder, lockedUntil) VALUES (?, ?, ?)", name, holder, lockedUntil.Unix())
+	if err != ErrConflict {
+		return errors.Wrap(err, "failed to acquire lease")
+	}
+	// MySQL does not count rows updated to the values they already have, so a holder renewing
+	// within the same second is only recognized by reading the lease back
+	var current string
+	var currentUntil int64
+	err = store.queryRow(ctx, "SELECT holder, lockedUntil FROM leases WHERE name = ?", name).Scan(&current, &currentUntil)
+	if err == sql.ErrNoRows {
+		return ErrConflict
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read lease")
+	}
+	if current == holder && currentUntil == lockedUntil.Unix() {
+		return nil
+	}
+	return ErrConflict
+}
+
+func (store sqlStore) ReleaseLease(ctx context.Context, name string, holder string) error {
+	// MySQL does not count rows updated to the values they already have, so affected rows are not checked
+	_, err := store.exec(ctx, "UPDATE leases SET lockedUntil = 0 WHERE name = ? AND holder = ?", name, holder)
+	return errors.Wrap(err, "failed to release lease")
+}
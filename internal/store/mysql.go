@@ -0,0 +1,28 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// noReferencedRow is the MySQL error number of a row referring to a missing row
+const noReferencedRow = 1452
+
+// NewMySQL returns a Store backed by a MySQL or MariaDB database
+func NewMySQL(db *sql.DB) Store {
+	return sqlStore{
+		db: db,
+		dialect: dialect{
+			// INSERT IGNORE also skips rows referring to missing adapters
+			insertIgnore: "INSERT IGNORE",
+			// Plain inserts referring to missing adapters fail
+			isConstraintViolation: func(err error) bool {
+				var mysqlErr *mysql.MySQLError
+				return errors.As(err, &mysqlErr) && mysqlErr.Number == noReferencedRow
+			},
+			forUpdate: "FOR UPDATE",
+		},
+	}
+}
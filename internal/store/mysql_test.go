@@ -0,0 +1,30 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	pkgerrors "github.com/pkg/errors"
+)
+
+func TestMySQLConstraintViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "missing referenced row", err: &mysql.MySQLError{Number: noReferencedRow}, want: true},
+		{name: "wrapped", err: pkgerrors.Wrap(&mysql.MySQLError{Number: noReferencedRow}, "failed to insert"), want: true},
+		{name: "duplicate entry", err: &mysql.MySQLError{Number: 1062}},
+		{name: "other error", err: errors.New("connection refused")},
+	}
+	isConstraintViolation := NewMySQL(nil).(sqlStore).dialect.isConstraintViolation
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isConstraintViolation(test.err); got != test.want {
+				t.Errorf("isConstraintViolation(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
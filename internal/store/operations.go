@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/pkg/errors"
+)
+
+// operationColumns are the columns read by scanOperation, in order
+const operationColumns = "id, kind, status, total, succeeded, failed, results, created, updated, finished"
+
+// scanOperation reads a row selected using operationColumns
+func scanOperation(row interface{ Scan(...any) error }) (models.Operation, error) {
+	var operation models.Operation
+	err := row.Scan(&operation.ID, &operation.Kind, &operation.Status, &operation.Total, &operation.Succeeded, &operation.Failed, &operation.Results, &operation.Created, &operation.Updated, &operation.Finished)
+	return operation, err
+}
+
+func (store sqlStore) GetOperation(ctx context.Context, id int) (models.Operation, error) {
+	operation, err := scanOperation(store.queryRow(ctx, "SELECT "+operationColumns+" FROM operations WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return models.Operation{}, ErrNotFound
+	}
+	return operation, errors.Wrap(err, "failed to get operation")
+}
+
+func (store sqlStore) CreateOperation(ctx context.Context, operation models.Operation, lockedUntil time.Time) (models.Operation, error) {
+	var id int
+	err := store.queryRow(ctx, "INSERT INTO operations (kind, status, total, succeeded, failed, results, lockedUntil) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id",
+		operation.Kind, operation.Status, operation.Total, operation.Succeeded, operation.Failed, operation.Results, lockedUntil.Unix()).Scan(&id)
+	if err != nil {
+		return models.Operation{}, errors.Wrap(err, "failed to insert operation")
+	}
+	return store.GetOperation(ctx, id)
+}
+
+func (store sqlStore) UpdateOperation(ctx context.Context, operation models.Operation) error {
+	query := "UPDATE operations SET status = ?, total = ?, succeeded = ?, failed = ?, results = ?"
+	if operation.Status != StatusRunning {
+		query += ", finished = CURRENT_TIMESTAMP"
+	}
+	// Every update adds a result or changes the status, so MySQL counts the row as affected
+	err := affectedOne(store.exec(ctx, query+" WHERE id = ? AND status = ?", operation.Status, operation.Total, operation.Succeeded, operation.Failed, operation.Results, operation.ID, StatusRunning))
+	if err == ErrNotFound {
+		return err
+	}
+	return errors.Wrap(err, "failed to update operation")
+}
+
+func (store sqlStore) RenewOperation(ctx context.Context, id int, lockedUntil time.Time) error {
+	// MySQL does not count rows updated to the values they already have, so affected rows are not checked
+	_, err := store.exec(ctx, "UPDATE operations SET lockedUntil = ? WHERE id = ? AND status = ?", lockedUntil.Unix(), id, StatusRunning)
+	return errors.Wrap(err, "failed to renew operation")
+}
+
+func (store sqlStore) CancelInterruptedOperations(ctx context.Context, now time.Time) (int, error) {
+	// Times are stored as Unix seconds, which compare the same way in every database
+	result, err := store.exec(ctx, "UPDATE operations SET status = ?, finished = CURRENT_TIMESTAMP WHERE status = ? AND lockedUntil <= ?", "cancelled", StatusRunning, now.Unix())
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to cancel interrupted operations")
+	}
+	cancelled, err := result.RowsAffected()
+	return int(cancelled), errors.Wrap(err, "failed to cancel interrupted operations")
+}
@@ -0,0 +1,29 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// foreignKeyViolation is the PostgreSQL error code of an insert referring to a missing row
+const foreignKeyViolation = "23503"
+
+// NewPostgres returns a Store backed by a PostgreSQL database
+func NewPostgres(db *sql.DB) Store {
+	return sqlStore{
+		db: db,
+		dialect: dialect{
+			insertIgnore:     "INSERT",
+			onConflictIgnore: "ON CONFLICT DO NOTHING",
+			// ON CONFLICT only covers unique constraints, not rows referring to missing adapters
+			isConstraintViolation: func(err error) bool {
+				var pqErr *pq.Error
+				return errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation
+			},
+			numberedPlaceholders: true,
+			forUpdate:            "FOR UPDATE",
+		},
+	}
+}
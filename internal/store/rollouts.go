@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/pkg/errors"
+)
+
+// rolloutColumns are the columns read by scanRollout, in order
+const rolloutColumns = "id, imageName, imageTag, batchSize, pauseSeconds, readinessTimeoutSeconds, maxFailureRatio, status, batch, total, succeeded, failed, results, created, updated, finished"
+
+// scanRollout reads a row selected using rolloutColumns
+func scanRollout(row interface{ Scan(...any) error }) (models.RolloutCampaign, error) {
+	var rollout models.RolloutCampaign
+	err := row.Scan(&rollout.ID, &rollout.ImageName, &rollout.ImageTag, &rollout.BatchSize, &rollout.PauseSeconds, &rollout.ReadinessTimeoutSeconds, &rollout.MaxFailureRatio,
+		&rollout.Status, &rollout.Batch, &rollout.Total, &rollout.Succeeded, &rollout.Failed, &rollout.Results, &rollout.Created, &rollout.Updated, &rollout.Finished)
+	return rollout, err
+}
+
+func (store sqlStore) ListRollouts(ctx context.Context) ([]models.RolloutCampaign, error) {
+	rows, err := store.query(ctx, "SELECT "+rolloutColumns+" FROM rolloutCampaigns ORDER BY id")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list rollout campaigns")
+	}
+	defer rows.Close()
+	rollouts := []models.RolloutCampaign{}
+	for rows.Next() {
+		rollout, err := scanRollout(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read rollout campaign")
+		}
+		rollouts = append(rollouts, rollout)
+	}
+	return rollouts, errors.Wrap(rows.Err(), "failed to list rollout campaigns")
+}
+
+func (store sqlStore) GetRollout(ctx context.Context, id int) (models.RolloutCampaign, error) {
+	rollout, err := scanRollout(store.queryRow(ctx, "SELECT "+rolloutColumns+" FROM rolloutCampaigns WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return models.RolloutCampaign{}, ErrNotFound
+	}
+	return rollout, errors.Wrap(err, "failed to get rollout campaign")
+}
+
+func (store sqlStore) CreateRollout(ctx context.Context, rollout models.RolloutCampaign) (models.RolloutCampaign, error) {
+	var id int
+	err := store.queryRow(ctx, "INSERT INTO rolloutCampaigns (imageName, imageTag, batchSize, pauseSeconds, readinessTimeoutSeconds, maxFailureRatio, status, total, results) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id",
+		rollout.ImageName, rollout.ImageTag, rollout.BatchSize, rollout.PauseSeconds, rollout.ReadinessTimeoutSeconds, rollout.MaxFailureRatio, rollout.Status, rollout.Total, rollout.Results).Scan(&id)
+	if err != nil {
+		return models.RolloutCampaign{}, errors.Wrap(err, "failed to insert rollout campaign")
+	}
+	return store.GetRollout(ctx, id)
+}
+
+func (store sqlStore) UpdateRollout(ctx context.Context, rollout models.RolloutCampaign) error {
+	query := "UPDATE rolloutCampaigns SET status = ?, batch = ?, succeeded = ?, failed = ?, results = ?"
+	if rollout.Status != StatusRunning {
+		query += ", finished = CURRENT_TIMESTAMP"
+	}
+	// Finished campaigns are left alone, so that progress does not overwrite a cancellation.
+	// MySQL does not count rows updated to the values they already have, so affected rows are not checked.
+	_, err := store.exec(ctx, query+" WHERE id = ? AND status = ?", rollout.Status, rollout.Batch, rollout.Succeeded, rollout.Failed, rollout.Results, rollout.ID, StatusRunning)
+	return errors.Wrap(err, "failed to update rollout campaign")
+}
+
+func (store sqlStore) CancelRollout(ctx context.Context, id int) error {
+	result, err := store.exec(ctx, "UPDATE rolloutCampaigns SET status = 'cancelled', finished = CURRENT_TIMESTAMP WHERE id = ? AND status = ?", id, StatusRunning)
+	if err != nil {
+		return errors.Wrap(err, "failed to cancel rollout campaign")
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 1 {
+		return nil
+	}
+	// Either the campaign does not exist or it has already finished
+	if _, err := store.GetRollout(ctx, id); err != nil {
+		return err
+	}
+	return ErrConflict
+}
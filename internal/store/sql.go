@@ -0,0 +1,367 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/pkg/errors"
+)
+
+// dialect holds what differs between the SQL databases supported by sqlStore
+type dialect struct {
+	// insertIgnore is the start of an INSERT, up to INTO, which skips rows that violate a constraint
+	insertIgnore string
+	// onConflictIgnore ends an INSERT, before RETURNING, for databases which skip conflicting rows that way
+	onConflictIgnore string
+	// isConstraintViolation recognizes constraint violations that the INSERT does not skip
+	isConstraintViolation func(err error) bool
+	// numberedPlaceholders replaces ? placeholders with $1, $2 and so on
+	numberedPlaceholders bool
+	// forUpdate ends a SELECT which locks the selected rows until the end of the transaction
+	forUpdate string
+}
+
+// rebind rewrites a query written with ? placeholders for the dialect
+func (d dialect) rebind(query string) string {
+	if !d.numberedPlaceholders {
+		return query
+	}
+	return NumberPlaceholders(query)
+}
+
+// NumberPlaceholders rewrites the ? placeholders of a query to $1, $2 and so on, as used by PostgreSQL
+func NumberPlaceholders(query string) string {
+	rebound := strings.Builder{}
+	number := 0
+	for _, r := range query {
+		if r == '?' {
+			number++
+			rebound.WriteString("$" + strconv.Itoa(number))
+			continue
+		}
+		rebound.WriteRune(r)
+	}
+	return rebound.String()
+}
+
+// sqlStore implements AdapterStore on top of database/sql
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// adapterColumns are the columns read by scanAdapter, in order
+const adapterColumns = "adapters.id, name, imageName, adapters.imageTag, adapters.imageDigest, syncedDigest, updatePolicy, cpuRequest, cpuLimit, memoryRequest, memoryLimit, probes, containerPort, servicePort, scheme, appProtocol, security, pullCredentialId, created, updated, synced, availableUpdates.imageTag, availableUpdates.imageDigest, availableUpdates.checked"
+
+// adapterTables are the tables adapterColumns are selected from
+const adapterTables = "adapters LEFT JOIN availableUpdates ON availableUpdates.adapterId = adapters.id"
+
+// configurationColumns are the columns read by scanConfiguration, in order
+const configurationColumns = "id, adapterId, configKey, configValue, created, updated"
+
+// scanAdapter reads a row selected using adapterColumns
+func scanAdapter(row interface{ Scan(...any) error }) (models.Adapter, error) {
+	var adapter models.Adapter
+	var availableTag, availableDigest sql.NullString
+	var checked sql.NullTime
+	var pullCredentialID sql.NullInt64
+	err := row.Scan(&adapter.ID, &adapter.Name, &adapter.ImageName, &adapter.ImageTag, &adapter.ImageDigest, &adapter.SyncedDigest, &adapter.UpdatePolicy, &adapter.Resources.CPURequest, &adapter.Resources.CPULimit, &adapter.Resources.MemoryRequest, &adapter.Resources.MemoryLimit, &adapter.Probes, &adapter.Network.ContainerPort, &adapter.Network.ServicePort, &adapter.Network.Scheme, &adapter.Network.AppProtocol, &adapter.Security, &pullCredentialID, &adapter.Created, &adapter.Updated, &adapter.Synced, &availableTag, &availableDigest, &checked)
+	if pullCredentialID.Valid {
+		id := int(pullCredentialID.Int64)
+		adapter.PullCredentialID = &id
+	}
+	if availableTag.Valid {
+		adapter.AvailableUpdate = &models.AvailableUpdate{ImageTag: availableTag.String, ImageDigest: availableDigest.String, Checked: checked.Time}
+	}
+	return adapter, err
+}
+
+// scanConfiguration reads a row selected using configurationColumns
+func scanConfiguration(row interface{ Scan(...any) error }) (models.AdapterConfiguration, error) {
+	var configuration models.AdapterConfiguration
+	err := row.Scan(&configuration.ID, &configuration.AdapterID, &configuration.ConfigKey, &configuration.ConfigValue, &configuration.Created, &configuration.Updated)
+	return configuration, err
+}
+
+func (store sqlStore) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return store.db.QueryContext(ctx, store.dialect.rebind(query), args...)
+}
+
+func (store sqlStore) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return store.db.QueryRowContext(ctx, store.dialect.rebind(query), args...)
+}
+
+func (store sqlStore) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return store.db.ExecContext(ctx, store.dialect.rebind(query), args...)
+}
+
+// transaction runs statements written with ? placeholders in a database transaction
+type transaction struct {
+	tx      *sql.Tx
+	dialect dialect
+}
+
+func (transaction transaction) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return transaction.tx.ExecContext(ctx, transaction.dialect.rebind(query), args...)
+}
+
+func (transaction transaction) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return transaction.tx.QueryRowContext(ctx, transaction.dialect.rebind(query), args...)
+}
+
+// inTransaction runs fn in a transaction, which is committed if fn returns nil and rolled back otherwise
+func (store sqlStore) inTransaction(ctx context.Context, fn func(transaction transaction) error) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+	if err := fn(transaction{tx: tx, dialect: store.dialect}); err != nil {
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "failed to commit transaction")
+}
+
+// insertIgnore runs an insert which skips conflicting rows and returns the Id of the new row
+func (store sqlStore) insertIgnore(ctx context.Context, query string, args ...interface{}) (int, error) {
+	var id int
+	statement := store.dialect.insertIgnore + " " + query
+	if store.dialect.onConflictIgnore != "" {
+		statement += " " + store.dialect.onConflictIgnore
+	}
+	err := store.queryRow(ctx, statement+" RETURNING id", args...).Scan(&id)
+	if err == sql.ErrNoRows || (err != nil && store.dialect.isConstraintViolation != nil && store.dialect.isConstraintViolation(err)) {
+		return 0, ErrConflict
+	}
+	return id, err
+}
+
+// nullableId stores an Id of 0 as NULL, for optional references
+func nullableId(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// affectedOne translates an exec result into ErrNotFound if no rows were affected
+func affectedOne(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to check affected rows")
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (store sqlStore) ListAdapters(ctx context.Context) ([]models.Adapter, error) {
+	rows, err := store.query(ctx, "SELECT "+adapterColumns+" FROM "+adapterTables)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list adapters")
+	}
+	defer rows.Close()
+	adapters := []models.Adapter{}
+	for rows.Next() {
+		adapter, err := scanAdapter(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read adapter")
+		}
+		adapters = append(adapters, adapter)
+	}
+	return adapters, errors.Wrap(rows.Err(), "failed to list adapters")
+}
+
+func (store sqlStore) GetAdapter(ctx context.Context, id int) (models.Adapter, error) {
+	adapter, err := scanAdapter(store.queryRow(ctx, "SELECT "+adapterColumns+" FROM "+adapterTables+" WHERE adapters.id = ?", id))
+	if err == sql.ErrNoRows {
+		return models.Adapter{}, ErrNotFound
+	}
+	return adapter, errors.Wrap(err, "failed to get adapter")
+}
+
+func (store sqlStore) CreateAdapter(ctx context.Context, adapter models.Adapter) (models.Adapter, error) {
+	resources := adapter.Resources
+	network := adapter.Network
+	id, err := store.insertIgnore(ctx, "INTO adapters (name, imageName, imageTag, imageDigest, updatePolicy, cpuRequest, cpuLimit, memoryRequest, memoryLimit, probes, containerPort, servicePort, scheme, appProtocol, security, pullCredentialId) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		adapter.Name, adapter.ImageName, adapter.ImageTag, adapter.ImageDigest, adapter.UpdatePolicy, resources.CPURequest, resources.CPULimit, resources.MemoryRequest, resources.MemoryLimit, adapter.Probes, network.ContainerPort, network.ServicePort, network.Scheme, network.AppProtocol, adapter.Security, adapter.PullCredentialID)
+	if err != nil {
+		return models.Adapter{}, errors.Wrap(err, "failed to insert adapter")
+	}
+	return store.GetAdapter(ctx, id)
+}
+
+func (store sqlStore) UpdateAdapter(ctx context.Context, id int, update AdapterUpdate) (models.Adapter, error) {
+	assignments := []string{}
+	arguments := []interface{}{}
+	if update.ImageTag != nil {
+		assignments = append(assignments, "imageTag = ?")
+		arguments = append(arguments, *update.ImageTag)
+		if update.ImageDigest == nil {
+			assignments = append(assignments, "imageDigest = ''")
+		}
+	}
+	if update.ImageDigest != nil {
+		assignments = append(assignments, "imageDigest = ?")
+		arguments = append(arguments, *update.ImageDigest)
+	}
+	if update.UpdatePolicy != nil {
+		assignments = append(assignments, "updatePolicy = ?")
+		arguments = append(arguments, *update.UpdatePolicy)
+	}
+	if update.Resources != nil {
+		assignments = append(assignments, "cpuRequest = ?", "cpuLimit = ?", "memoryRequest = ?", "memoryLimit = ?")
+		arguments = append(arguments, update.Resources.CPURequest, update.Resources.CPULimit, update.Resources.MemoryRequest, update.Resources.MemoryLimit)
+	}
+	if update.Probes != nil {
+		assignments = append(assignments, "probes = ?")
+		arguments = append(arguments, *update.Probes)
+	}
+	if update.Security != nil {
+		assignments = append(assignments, "security = ?")
+		arguments = append(arguments, *update.Security)
+	}
+	if update.PullCredentialID != nil {
+		assignments = append(assignments, "pullCredentialId = ?")
+		arguments = append(arguments, nullableId(*update.PullCredentialID))
+	}
+	if update.Network != nil {
+		assignments = append(assignments, "containerPort = ?", "servicePort = ?", "scheme = ?", "appProtocol = ?")
+		arguments = append(arguments, update.Network.ContainerPort, update.Network.ServicePort, update.Network.Scheme, update.Network.AppProtocol)
+	}
+	getAdapter := "SELECT " + adapterColumns + " FROM " + adapterTables + " WHERE adapters.id = ?"
+	var updated models.Adapter
+	err := store.inTransaction(ctx, func(transaction transaction) error {
+		// Locking the row keeps concurrent updates from changing the adapter between the check and the update.
+		// SQLite needs no lock since its single connection runs one transaction at a time.
+		var locked int
+		err := transaction.queryRow(ctx, strings.TrimSpace("SELECT id FROM adapters WHERE id = ? "+store.dialect.forUpdate), id).Scan(&locked)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to lock adapter")
+		}
+		if update.Check != nil {
+			current, err := scanAdapter(transaction.queryRow(ctx, getAdapter, id))
+			if err != nil {
+				return errors.Wrap(err, "failed to get adapter")
+			}
+			if err := update.Check(current); err != nil {
+				return err
+			}
+		}
+		if len(assignments) > 0 {
+			_, err := transaction.exec(ctx, "UPDATE adapters SET "+strings.Join(assignments, ", ")+" WHERE id = ?", append(arguments, id)...)
+			if err != nil {
+				return errors.Wrap(err, "failed to update adapter")
+			}
+		}
+		if update.ImageTag != nil || update.ImageDigest != nil || update.UpdatePolicy != nil {
+			// A found update is only valid for the image and policy it was found with
+			if _, err := transaction.exec(ctx, "DELETE FROM availableUpdates WHERE adapterId = ?", id); err != nil {
+				return errors.Wrap(err, "failed to clear available update")
+			}
+		}
+		updated, err = scanAdapter(transaction.queryRow(ctx, getAdapter, id))
+		return errors.Wrap(err, "failed to get adapter")
+	})
+	if err != nil {
+		return models.Adapter{}, err
+	}
+	return updated, nil
+}
+
+func (store sqlStore) DeleteAdapter(ctx context.Context, id int) error {
+	return affectedOne(store.exec(ctx, "DELETE FROM adapters WHERE id = ?", id))
+}
+
+func (store sqlStore) MarkAdapterSynced(ctx context.Context, id int, digest string) error {
+	// FIXME allow passing in sync time in order to avoid time skew issues
+	return affectedOne(store.exec(ctx, "UPDATE adapters SET synced = CURRENT_TIMESTAMP, syncedDigest = ? WHERE id = ?", digest, id))
+}
+
+func (store sqlStore) SetAvailableUpdate(ctx context.Context, id int, update *models.AvailableUpdate) error {
+	if _, err := store.exec(ctx, "DELETE FROM availableUpdates WHERE adapterId = ?", id); err != nil {
+		return errors.Wrap(err, "failed to clear available update")
+	}
+	if update == nil {
+		return nil
+	}
+	_, err := store.exec(ctx, "INSERT INTO availableUpdates (adapterId, imageTag, imageDigest) VALUES (?, ?, ?)", id, update.ImageTag, update.ImageDigest)
+	if err != nil && store.dialect.isConstraintViolation != nil && store.dialect.isConstraintViolation(err) {
+		return ErrNotFound
+	}
+	return errors.Wrap(err, "failed to record available update")
+}
+
+func (store sqlStore) Unsynced(ctx context.Context) (int, *time.Time, error) {
+	const unsynced = "FROM adapters WHERE synced IS NULL OR updated > synced"
+	var count int
+	if err := store.queryRow(ctx, "SELECT COUNT(*) "+unsynced).Scan(&count); err != nil {
+		return 0, nil, errors.Wrap(err, "failed to count unsynced adapters")
+	}
+	if count == 0 {
+		return 0, nil, nil
+	}
+	// Selecting the column rather than MIN() keeps its type, which SQLite only knows for columns
+	var oldest time.Time
+	if err := store.queryRow(ctx, "SELECT updated "+unsynced+" ORDER BY updated LIMIT 1").Scan(&oldest); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil, nil
+		}
+		return 0, nil, errors.Wrap(err, "failed to find oldest unsynced adapter")
+	}
+	return count, &oldest, nil
+}
+
+func (store sqlStore) ListAdapterConfiguration(ctx context.Context, adapterId int) ([]models.AdapterConfiguration, error) {
+	rows, err := store.query(ctx, "SELECT "+configurationColumns+" FROM adapterConfiguration WHERE adapterId = ?", adapterId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list adapter configuration")
+	}
+	defer rows.Close()
+	configurations := []models.AdapterConfiguration{}
+	for rows.Next() {
+		configuration, err := scanConfiguration(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read adapter configuration")
+		}
+		configurations = append(configurations, configuration)
+	}
+	return configurations, errors.Wrap(rows.Err(), "failed to list adapter configuration")
+}
+
+// getAdapterConfiguration returns a single configuration entry of an adapter
+func (store sqlStore) getAdapterConfiguration(ctx context.Context, adapterId int, id int) (models.AdapterConfiguration, error) {
+	configuration, err := scanConfiguration(store.queryRow(ctx, "SELECT "+configurationColumns+" FROM adapterConfiguration WHERE adapterId = ? AND id = ?", adapterId, id))
+	if err == sql.ErrNoRows {
+		return models.AdapterConfiguration{}, ErrNotFound
+	}
+	return configuration, errors.Wrap(err, "failed to get adapter configuration")
+}
+
+func (store sqlStore) CreateAdapterConfiguration(ctx context.Context, adapterId int, configuration models.AdapterConfiguration) (models.AdapterConfiguration, error) {
+	id, err := store.insertIgnore(ctx, "INTO adapterConfiguration (adapterId, configKey, configValue) VALUES (?, ?, ?)", adapterId, configuration.ConfigKey, configuration.ConfigValue)
+	if err != nil {
+		return models.AdapterConfiguration{}, errors.Wrap(err, "failed to insert adapter configuration")
+	}
+	return store.getAdapterConfiguration(ctx, adapterId, id)
+}
+
+func (store sqlStore) UpdateAdapterConfiguration(ctx context.Context, adapterId int, id int, configuration models.AdapterConfiguration) (models.AdapterConfiguration, error) {
+	err := affectedOne(store.exec(ctx, "UPDATE adapterConfiguration SET configKey = ?, configValue = ? WHERE adapterId = ? AND id = ?", configuration.ConfigKey, configuration.ConfigValue, adapterId, id))
+	if err != nil {
+		return models.AdapterConfiguration{}, errors.Wrap(err, "failed to update adapter configuration")
+	}
+	return store.getAdapterConfiguration(ctx, adapterId, id)
+}
+
+func (store sqlStore) DeleteAdapterConfiguration(ctx context.Context, adapterId int, id int) error {
+	return affectedOne(store.exec(ctx, "DELETE FROM adapterConfiguration WHERE id = ? AND adapterId = ?", id, adapterId))
+}
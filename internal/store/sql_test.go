@@ -0,0 +1,24 @@
+package store
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect dialect
+		query   string
+		want    string
+	}{
+		{name: "question marks kept", dialect: dialect{}, query: "UPDATE adapters SET imageTag = ? WHERE id = ?", want: "UPDATE adapters SET imageTag = ? WHERE id = ?"},
+		{name: "numbered", dialect: dialect{numberedPlaceholders: true}, query: "UPDATE adapters SET imageTag = ? WHERE id = ?", want: "UPDATE adapters SET imageTag = $1 WHERE id = $2"},
+		{name: "without placeholders", dialect: dialect{numberedPlaceholders: true}, query: "SELECT COUNT(*) FROM adapters", want: "SELECT COUNT(*) FROM adapters"},
+		{name: "ten or more", dialect: dialect{numberedPlaceholders: true}, query: "VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", want: "VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.dialect.rebind(test.query); got != test.want {
+				t.Errorf("rebind() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
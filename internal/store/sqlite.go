@@ -0,0 +1,36 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// NewSQLite returns a Store backed by a SQLite database, meant for local use and tests.
+// Foreign keys have to be enabled on the connection, see OpenSQLite.
+func NewSQLite(db *sql.DB) Store {
+	return sqlStore{
+		db: db,
+		dialect: dialect{
+			insertIgnore: "INSERT OR IGNORE",
+			// Unlike MySQL, SQLite does not skip rows referring to missing adapters
+			isConstraintViolation: func(err error) bool {
+				var sqliteErr *sqlite.Error
+				return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+			},
+		},
+	}
+}
+
+// OpenSQLite opens the SQLite database file at path, creating it if it does not exist
+func OpenSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open SQLite database")
+	}
+	// SQLite allows a single writer, queueing writers in the pool beats lock errors
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
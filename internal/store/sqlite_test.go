@@ -0,0 +1,495 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/internal/store"
+	"github.com/Kaese72/adapter-attendant/migrations"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+)
+
+// fixture is a migrated SQLite store holding an adapter with a configuration entry,
+// pulling its image with a registry credential
+type fixture struct {
+	db           *sql.DB
+	store        store.Store
+	adapterID    int
+	configID     int
+	credentialID int
+}
+
+func newFixture(t *testing.T) fixture {
+	t.Helper()
+	ctx := context.Background()
+	db, err := store.OpenSQLite(filepath.Join(t.TempDir(), "attendant.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Migrate(ctx, db, "sqlite", "test"); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	sqlite := store.NewSQLite(db)
+	credential, err := sqlite.CreateRegistryCredential(ctx, models.RegistryCredential{Registry: "ghcr.io", Username: "kaese72"}, func(id int) (string, error) {
+		return "sealed", nil
+	})
+	if err != nil {
+		t.Fatalf("CreateRegistryCredential() error = %v", err)
+	}
+	adapter, err := sqlite.CreateAdapter(ctx, models.Adapter{Name: "hue", ImageName: "ghcr.io/kaese72/hue-adapter", ImageTag: "1.0.0", PullCredentialID: &credential.ID})
+	if err != nil {
+		t.Fatalf("CreateAdapter() error = %v", err)
+	}
+	configuration, err := sqlite.CreateAdapterConfiguration(ctx, adapter.ID, models.AdapterConfiguration{ConfigKey: "BRIDGE", ConfigValue: "10.0.0.2"})
+	if err != nil {
+		t.Fatalf("CreateAdapterConfiguration() error = %v", err)
+	}
+	return fixture{db: db, store: sqlite, adapterID: adapter.ID, configID: configuration.ID, credentialID: credential.ID}
+}
+
+func TestUpdatedTouched(t *testing.T) {
+	// CURRENT_TIMESTAMP has a resolution of seconds, so the adapter is changed long ago first
+	longAgo := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	imageTag := "1.1.0"
+	tests := []struct {
+		name    string
+		change  func(ctx context.Context, f fixture) error
+		touched bool
+	}{
+		{
+			name: "adapter updated",
+			change: func(ctx context.Context, f fixture) error {
+				_, err := f.store.UpdateAdapter(ctx, f.adapterID, store.AdapterUpdate{ImageTag: &imageTag})
+				return err
+			},
+			touched: true,
+		},
+		{
+			name: "configuration updated",
+			change: func(ctx context.Context, f fixture) error {
+				_, err := f.store.UpdateAdapterConfiguration(ctx, f.adapterID, f.configID, models.AdapterConfiguration{ConfigKey: "BRIDGE", ConfigValue: "10.0.0.3"})
+				return err
+			},
+			touched: true,
+		},
+		{
+			name: "registry credential updated",
+			change: func(ctx context.Context, f fixture) error {
+				_, err := f.store.UpdateRegistryCredential(ctx, f.credentialID, models.RegistryCredential{Registry: "ghcr.io", Username: "other"})
+				return err
+			},
+			touched: true,
+		},
+		{
+			name: "available update found",
+			change: func(ctx context.Context, f fixture) error {
+				return f.store.SetAvailableUpdate(ctx, f.adapterID, &models.AvailableUpdate{ImageTag: "1.1.0"})
+			},
+			touched: false,
+		},
+		{
+			name: "configuration of another adapter updated",
+			change: func(ctx context.Context, f fixture) error {
+				other, err := f.store.CreateAdapter(ctx, models.Adapter{Name: "zigbee", ImageName: "ghcr.io/kaese72/zigbee-adapter", ImageTag: "1.0.0"})
+				if err != nil {
+					return err
+				}
+				configuration, err := f.store.CreateAdapterConfiguration(ctx, other.ID, models.AdapterConfiguration{ConfigKey: "PORT", ConfigValue: "/dev/ttyUSB0"})
+				if err != nil {
+					return err
+				}
+				_, err = f.store.UpdateAdapterConfiguration(ctx, other.ID, configuration.ID, models.AdapterConfiguration{ConfigKey: "PORT", ConfigValue: "/dev/ttyUSB1"})
+				return err
+			},
+			touched: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			if _, err := f.db.Exec("UPDATE adapters SET updated = ? WHERE id = ?", longAgo.Format("2006-01-02 15:04:05"), f.adapterID); err != nil {
+				t.Fatalf("failed to backdate adapter: %v", err)
+			}
+			if err := test.change(ctx, f); err != nil {
+				t.Fatalf("change error = %v", err)
+			}
+			adapter, err := f.store.GetAdapter(ctx, f.adapterID)
+			if err != nil {
+				t.Fatalf("GetAdapter() error = %v", err)
+			}
+			if touched := adapter.Updated.After(longAgo); touched != test.touched {
+				t.Errorf("updated = %v, want touched %v", adapter.Updated, test.touched)
+			}
+		})
+	}
+}
+
+func TestUnsynced(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	if count, _, err := f.store.Unsynced(ctx); err != nil || count != 1 {
+		t.Fatalf("Unsynced() before sync = %d, %v, want 1", count, err)
+	}
+	if err := f.store.MarkAdapterSynced(ctx, f.adapterID, "sha256:abc"); err != nil {
+		t.Fatalf("MarkAdapterSynced() error = %v", err)
+	}
+	if count, oldest, err := f.store.Unsynced(ctx); err != nil || count != 0 || oldest != nil {
+		t.Fatalf("Unsynced() after sync = %d, %v, %v, want 0", count, oldest, err)
+	}
+	adapter, err := f.store.GetAdapter(ctx, f.adapterID)
+	if err != nil {
+		t.Fatalf("GetAdapter() error = %v", err)
+	}
+	if adapter.SyncedDigest != "sha256:abc" {
+		t.Errorf("SyncedDigest = %q, want sha256:abc", adapter.SyncedDigest)
+	}
+}
+
+func TestUpdateAdapterCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		checkErr error
+		want     string
+	}{
+		{name: "passes", want: "1.1.0"},
+		{name: "fails", checkErr: errors.New("invalid"), want: "1.0.0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			imageTag := "1.1.0"
+			var checked models.Adapter
+			_, err := f.store.UpdateAdapter(ctx, f.adapterID, store.AdapterUpdate{ImageTag: &imageTag, Check: func(current models.Adapter) error {
+				checked = current
+				return test.checkErr
+			}})
+			if err != test.checkErr {
+				t.Fatalf("UpdateAdapter() error = %v, want %v", err, test.checkErr)
+			}
+			if checked.ImageTag != "1.0.0" {
+				t.Errorf("checked ImageTag = %q, want the tag before the update", checked.ImageTag)
+			}
+			adapter, err := f.store.GetAdapter(ctx, f.adapterID)
+			if err != nil {
+				t.Fatalf("GetAdapter() error = %v", err)
+			}
+			if adapter.ImageTag != test.want {
+				t.Errorf("ImageTag = %q, want %q", adapter.ImageTag, test.want)
+			}
+		})
+	}
+}
+
+func TestCreateRegistryCredential(t *testing.T) {
+	tests := []struct {
+		name    string
+		seal    func(id int) (string, error)
+		want    string
+		wantErr bool
+	}{
+		{name: "sealed with its Id", seal: func(id int) (string, error) { return fmt.Sprintf("sealed-%d", id), nil }, want: "sealed-2"},
+		{name: "sealing fails", seal: func(id int) (string, error) { return "", errors.New("no key") }, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			credential, err := f.store.CreateRegistryCredential(ctx, models.RegistryCredential{Registry: "docker.io", Username: "kaese72"}, test.seal)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("CreateRegistryCredential() error = %v, wantErr %v", err, test.wantErr)
+			}
+			credentials, err := f.store.ListRegistryCredentials(ctx)
+			if err != nil {
+				t.Fatalf("ListRegistryCredentials() error = %v", err)
+			}
+			if test.wantErr {
+				// The credential is not stored without its password
+				if len(credentials) != 1 {
+					t.Errorf("ListRegistryCredentials() = %v, want only the fixture credential", credentials)
+				}
+				return
+			}
+			password, err := f.store.GetRegistryCredentialPassword(ctx, credential.ID)
+			if err != nil || password != test.want {
+				t.Errorf("GetRegistryCredentialPassword() = %q, %v, want %q", password, err, test.want)
+			}
+		})
+	}
+}
+
+func TestWebhookOutbox(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	subscription, err := f.store.CreateWebhookSubscription(ctx, models.WebhookSubscription{TargetURL: "https://hooks.example.com", Secret: "secret"})
+	if err != nil {
+		t.Fatalf("CreateWebhookSubscription() error = %v", err)
+	}
+	if err := f.store.EnqueueWebhookEvent(ctx, models.WebhookPayload{Event: "created", AdapterID: f.adapterID}); err != nil {
+		t.Fatalf("EnqueueWebhookEvent() error = %v", err)
+	}
+	events, err := f.store.ListWebhookEvents(ctx, 10)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("ListWebhookEvents() = %v, %v, want one event", events, err)
+	}
+	if err := f.store.ScheduleWebhookDeliveries(ctx, events[0], []int{subscription.ID}); err != nil {
+		t.Fatalf("ScheduleWebhookDeliveries() error = %v", err)
+	}
+	// Another replica scheduling the same event finds it gone
+	if err := f.store.ScheduleWebhookDeliveries(ctx, events[0], []int{subscription.ID}); err != store.ErrNotFound {
+		t.Fatalf("ScheduleWebhookDeliveries() again error = %v, want ErrNotFound", err)
+	}
+
+	now := time.Now()
+	delivery, err := f.store.ClaimWebhookDelivery(ctx, now, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("ClaimWebhookDelivery() error = %v", err)
+	}
+	if delivery.Subscription.Secret != "secret" || delivery.Payload.Event != "created" {
+		t.Errorf("ClaimWebhookDelivery() = %+v, want the created event with the subscription secret", delivery)
+	}
+	// A claimed delivery is locked from other workers
+	if _, err := f.store.ClaimWebhookDelivery(ctx, now, now.Add(time.Minute)); err != store.ErrNotFound {
+		t.Fatalf("ClaimWebhookDelivery() while locked error = %v, want ErrNotFound", err)
+	}
+	if err := f.store.RetryWebhookDelivery(ctx, delivery.ID, 1, now.Add(time.Hour), "503 Service Unavailable"); err != nil {
+		t.Fatalf("RetryWebhookDelivery() error = %v", err)
+	}
+	if _, err := f.store.ClaimWebhookDelivery(ctx, now, now.Add(time.Minute)); err != store.ErrNotFound {
+		t.Fatalf("ClaimWebhookDelivery() before the retry error = %v, want ErrNotFound", err)
+	}
+	later := now.Add(2 * time.Hour)
+	delivery, err = f.store.ClaimWebhookDelivery(ctx, later, later.Add(time.Minute))
+	if err != nil || delivery.Attempts != 1 {
+		t.Fatalf("ClaimWebhookDelivery() at the retry = %+v, %v, want 1 attempt", delivery, err)
+	}
+	if err := f.store.DeleteWebhookDelivery(ctx, delivery.ID); err != nil {
+		t.Fatalf("DeleteWebhookDelivery() error = %v", err)
+	}
+}
+
+func TestCancelInterruptedOperations(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		status      string
+		lockedUntil time.Time
+		want        string
+	}{
+		{name: "lease ran out", status: store.StatusRunning, lockedUntil: now.Add(-time.Minute), want: "cancelled"},
+		{name: "lease held", status: store.StatusRunning, lockedUntil: now.Add(time.Minute), want: store.StatusRunning},
+		{name: "finished", status: "succeeded", lockedUntil: now.Add(-time.Minute), want: "succeeded"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			operation, err := f.store.CreateOperation(ctx, models.Operation{Kind: "sync", Status: test.status, Results: models.OperationResults{}}, test.lockedUntil)
+			if err != nil {
+				t.Fatalf("CreateOperation() error = %v", err)
+			}
+			if _, err := f.store.CancelInterruptedOperations(ctx, now); err != nil {
+				t.Fatalf("CancelInterruptedOperations() error = %v", err)
+			}
+			operation, err = f.store.GetOperation(ctx, operation.ID)
+			if err != nil {
+				t.Fatalf("GetOperation() error = %v", err)
+			}
+			if operation.Status != test.want {
+				t.Errorf("Status = %q, want %q", operation.Status, test.want)
+			}
+		})
+	}
+}
+
+func TestAcquireLease(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		holder  string
+		now     time.Time
+		release bool
+		want    error
+	}{
+		{name: "renewed by its holder", holder: "replica-a", now: now},
+		{name: "held by another", holder: "replica-b", now: now, want: store.ErrConflict},
+		{name: "expired", holder: "replica-b", now: now.Add(2 * time.Minute)},
+		{name: "released", holder: "replica-b", now: now, release: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			if err := f.store.AcquireLease(ctx, "rollout-1", "replica-a", now, now.Add(time.Minute)); err != nil {
+				t.Fatalf("AcquireLease() error = %v", err)
+			}
+			if test.release {
+				if err := f.store.ReleaseLease(ctx, "rollout-1", "replica-a"); err != nil {
+					t.Fatalf("ReleaseLease() error = %v", err)
+				}
+			}
+			err := f.store.AcquireLease(ctx, "rollout-1", test.holder, test.now, test.now.Add(time.Minute))
+			if err != test.want {
+				t.Errorf("AcquireLease() error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	const missing = 1000
+	tests := []struct {
+		name string
+		call func(ctx context.Context, f fixture) error
+		want error
+	}{
+		{
+			name: "get missing adapter",
+			call: func(ctx context.Context, f fixture) error {
+				_, err := f.store.GetAdapter(ctx, missing)
+				return err
+			},
+			want: store.ErrNotFound,
+		},
+		{
+			name: "create adapter with taken name",
+			call: func(ctx context.Context, f fixture) error {
+				_, err := f.store.CreateAdapter(ctx, models.Adapter{Name: "hue", ImageName: "ghcr.io/kaese72/hue-adapter", ImageTag: "1.0.0"})
+				return err
+			},
+			want: store.ErrConflict,
+		},
+		{
+			name: "update missing adapter",
+			call: func(ctx context.Context, f fixture) error {
+				imageTag := "1.1.0"
+				_, err := f.store.UpdateAdapter(ctx, missing, store.AdapterUpdate{ImageTag: &imageTag})
+				return err
+			},
+			want: store.ErrNotFound,
+		},
+		{
+			name: "delete missing adapter",
+			call: func(ctx context.Context, f fixture) error {
+				return f.store.DeleteAdapter(ctx, missing)
+			},
+			want: store.ErrNotFound,
+		},
+		{
+			name: "mark missing adapter synced",
+			call: func(ctx context.Context, f fixture) error {
+				return f.store.MarkAdapterSynced(ctx, missing, "")
+			},
+			want: store.ErrNotFound,
+		},
+		{
+			name: "record update of missing adapter",
+			call: func(ctx context.Context, f fixture) error {
+				return f.store.SetAvailableUpdate(ctx, missing, &models.AvailableUpdate{ImageTag: "1.1.0"})
+			},
+			want: store.ErrNotFound,
+		},
+		{
+			name: "create configuration with taken key",
+			call: func(ctx context.Context, f fixture) error {
+				_, err := f.store.CreateAdapterConfiguration(ctx, f.adapterID, models.AdapterConfiguration{ConfigKey: "BRIDGE", ConfigValue: "10.0.0.3"})
+				return err
+			},
+			want: store.ErrConflict,
+		},
+		{
+			name: "create configuration of missing adapter",
+			call: func(ctx context.Context, f fixture) error {
+				_, err := f.store.CreateAdapterConfiguration(ctx, missing, models.AdapterConfiguration{ConfigKey: "BRIDGE", ConfigValue: "10.0.0.3"})
+				return err
+			},
+			want: store.ErrConflict,
+		},
+		{
+			name: "update configuration through another adapter",
+			call: func(ctx context.Context, f fixture) error {
+				_, err := f.store.UpdateAdapterConfiguration(ctx, missing, f.configID, models.AdapterConfiguration{ConfigKey: "BRIDGE", ConfigValue: "10.0.0.3"})
+				return err
+			},
+			want: store.ErrNotFound,
+		},
+		{
+			name: "delete missing configuration",
+			call: func(ctx context.Context, f fixture) error {
+				return f.store.DeleteAdapterConfiguration(ctx, f.adapterID, missing)
+			},
+			want: store.ErrNotFound,
+		},
+		{
+			name: "get missing operation",
+			call: func(ctx context.Context, f fixture) error {
+				_, err := f.store.GetOperation(ctx, missing)
+				return err
+			},
+			want: store.ErrNotFound,
+		},
+		{
+			name: "update finished operation",
+			call: func(ctx context.Context, f fixture) error {
+				operation, err := f.store.CreateOperation(ctx, models.Operation{Kind: "sync", Status: "cancelled", Results: models.OperationResults{}}, time.Now())
+				if err != nil {
+					return err
+				}
+				operation.Status = "succeeded"
+				return f.store.UpdateOperation(ctx, operation)
+			},
+			want: store.ErrNotFound,
+		},
+		{
+			name: "delete registry credential in use",
+			call: func(ctx context.Context, f fixture) error {
+				return f.store.DeleteRegistryCredential(ctx, f.credentialID)
+			},
+			want: store.ErrConflict,
+		},
+		{
+			name: "update missing registry credential",
+			call: func(ctx context.Context, f fixture) error {
+				_, err := f.store.UpdateRegistryCredential(ctx, missing, models.RegistryCredential{Registry: "ghcr.io", Username: "other"})
+				return err
+			},
+			want: store.ErrNotFound,
+		},
+		{
+			name: "cancel missing rollout campaign",
+			call: func(ctx context.Context, f fixture) error {
+				return f.store.CancelRollout(ctx, missing)
+			},
+			want: store.ErrNotFound,
+		},
+		{
+			name: "cancel finished rollout campaign",
+			call: func(ctx context.Context, f fixture) error {
+				rollout, err := f.store.CreateRollout(ctx, models.RolloutCampaign{ImageName: "ghcr.io/kaese72/hue-adapter", ImageTag: "1.1.0", BatchSize: 1, Status: store.StatusRunning, Results: models.OperationResults{}})
+				if err != nil {
+					return err
+				}
+				if err := f.store.CancelRollout(ctx, rollout.ID); err != nil {
+					return err
+				}
+				return f.store.CancelRollout(ctx, rollout.ID)
+			},
+			want: store.ErrConflict,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFixture(t)
+			if err := test.call(context.Background(), f); !errors.Is(err, test.want) {
+				t.Errorf("error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Package store persists adapters, their configuration, webhook subscriptions, operations, rollout campaigns and leases.
+// Handlers depend on the store interfaces rather than on SQL, so that the attendant is
+// able to run on more than one database.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested adapter or configuration entry does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write violates a constraint, eg. a duplicate name
+	ErrConflict = errors.New("conflict")
+)
+
+// AdapterUpdate lists the adapter settings to change, nil values are left as they are.
+// Changing the image or update policy clears the available update of the adapter.
+type AdapterUpdate struct {
+	ImageTag *string
+	// ImageDigest pins the image to a digest, changing only the tag clears the digest
+	ImageDigest  *string
+	UpdatePolicy *models.AdapterUpdatePolicy
+	// PullCredentialID changes the registry credential the image is pulled with, 0 removing it
+	PullCredentialID *int
+	Resources        *models.AdapterResources
+	Probes           *models.AdapterProbes
+	Network          *models.AdapterNetwork
+	Security         *models.AdapterSecurity
+	// Check is called with the adapter as it is before the update, in the same transaction as the update,
+	// and cancels the update by returning an error. It must not use the store.
+	Check func(current models.Adapter) error
+}
+
+// AdapterStore persists adapters and their configuration entries.
+// Changing an adapter or one of its configuration entries updates the adapter's updated time.
+type AdapterStore interface {
+	ListAdapters(ctx context.Context) ([]models.Adapter, error)
+	GetAdapter(ctx context.Context, id int) (models.Adapter, error)
+	CreateAdapter(ctx context.Context, adapter models.Adapter) (models.Adapter, error)
+	UpdateAdapter(ctx context.Context, id int, update AdapterUpdate) (models.Adapter, error)
+	DeleteAdapter(ctx context.Context, id int) error
+	// MarkAdapterSynced records that the adapter has been applied to Kubernetes,
+	// with the image digest applied or an empty string if only the tag was
+	MarkAdapterSynced(ctx context.Context, id int, digest string) error
+	// SetAvailableUpdate records a newer image found in the registry, nil clears it.
+	// Unlike other changes it does not update the adapter's updated time.
+	SetAvailableUpdate(ctx context.Context, id int, update *models.AvailableUpdate) error
+	// Unsynced returns the number of adapters changed since they were last synced and
+	// when the oldest of those changes was made
+	Unsynced(ctx context.Context) (int, *time.Time, error)
+
+	ListAdapterConfiguration(ctx context.Context, adapterId int) ([]models.AdapterConfiguration, error)
+	CreateAdapterConfiguration(ctx context.Context, adapterId int, configuration models.AdapterConfiguration) (models.AdapterConfiguration, error)
+	UpdateAdapterConfiguration(ctx context.Context, adapterId int, id int, configuration models.AdapterConfiguration) (models.AdapterConfiguration, error)
+	DeleteAdapterConfiguration(ctx context.Context, adapterId int, id int) error
+}
+
+// WebhookEvent is an event in the webhook outbox, not yet scheduled for delivery to subscriptions
+type WebhookEvent struct {
+	ID      int
+	Payload models.WebhookPayload
+}
+
+// WebhookDelivery is an event scheduled for delivery to a subscription
+type WebhookDelivery struct {
+	ID int
+	// Subscription includes the secret deliveries are signed with
+	Subscription models.WebhookSubscription
+	Payload      models.WebhookPayload
+	// Attempts is the number of failed delivery attempts so far
+	Attempts int
+}
+
+// WebhookStore persists webhook subscriptions, the events waiting to be delivered to them and the
+// events that could not be delivered to them. Secrets of subscriptions are only read back by
+// ListWebhookTargets and ClaimWebhookDelivery.
+type WebhookStore interface {
+	ListWebhookSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	GetWebhookSubscription(ctx context.Context, id int) (models.WebhookSubscription, error)
+	CreateWebhookSubscription(ctx context.Context, subscription models.WebhookSubscription) (models.WebhookSubscription, error)
+	DeleteWebhookSubscription(ctx context.Context, id int) error
+	// ListWebhookTargets returns every subscription including its secret, for delivering events
+	ListWebhookTargets(ctx context.Context) ([]models.WebhookSubscription, error)
+
+	// EnqueueWebhookEvent adds an event to the outbox
+	EnqueueWebhookEvent(ctx context.Context, payload models.WebhookPayload) error
+	// ListWebhookEvents returns the oldest events in the outbox
+	ListWebhookEvents(ctx context.Context, limit int) ([]WebhookEvent, error)
+	// ScheduleWebhookDeliveries moves an event from the outbox to the deliveries of subscriptions,
+	// returning ErrNotFound if it has already been moved, eg. by another replica
+	ScheduleWebhookDeliveries(ctx context.Context, event WebhookEvent, subscriptionIds []int) error
+	// ClaimWebhookDelivery locks the oldest delivery that is due until lockedUntil, so that no other
+	// worker attempts it meanwhile. ErrNotFound is returned if no delivery is due.
+	ClaimWebhookDelivery(ctx context.Context, now time.Time, lockedUntil time.Time) (WebhookDelivery, error)
+	// RetryWebhookDelivery unlocks a delivery and schedules its next attempt
+	RetryWebhookDelivery(ctx context.Context, id int, attempts int, nextAttempt time.Time, lastError string) error
+	// DeleteWebhookDelivery removes a delivery that succeeded
+	DeleteWebhookDelivery(ctx context.Context, id int) error
+	// DeadLetterWebhookDelivery replaces a delivery that failed for good with a dead letter
+	DeadLetterWebhookDelivery(ctx context.Context, id int, deadLetter models.WebhookDeadLetter) error
+
+	ListWebhookDeadLetters(ctx context.Context, subscriptionId int) ([]models.WebhookDeadLetter, error)
+	DeleteWebhookDeadLetter(ctx context.Context, subscriptionId int, id int) error
+}
+
+// StatusRunning is the status of operations and rollout campaigns that have not finished
+const StatusRunning = "running"
+
+// OperationStore persists the progress of operations on many adapters
+type OperationStore interface {
+	GetOperation(ctx context.Context, id int) (models.Operation, error)
+	// CreateOperation creates an operation leased by the caller until lockedUntil
+	CreateOperation(ctx context.Context, operation models.Operation, lockedUntil time.Time) (models.Operation, error)
+	// UpdateOperation records the status and results of an operation, and when it finished
+	// once its status is no longer StatusRunning. ErrNotFound is returned if the operation is
+	// not running anymore, eg. as it was cancelled for having been interrupted.
+	UpdateOperation(ctx context.Context, operation models.Operation) error
+	// RenewOperation extends the lease of a running operation until lockedUntil
+	RenewOperation(ctx context.Context, id int, lockedUntil time.Time) error
+	// CancelInterruptedOperations cancels running operations whose lease ran out before now,
+	// as the replica running them is gone, and returns how many were cancelled
+	CancelInterruptedOperations(ctx context.Context, now time.Time) (int, error)
+}
+
+// RolloutStore persists rollout campaigns
+type RolloutStore interface {
+	ListRollouts(ctx context.Context) ([]models.RolloutCampaign, error)
+	GetRollout(ctx context.Context, id int) (models.RolloutCampaign, error)
+	CreateRollout(ctx context.Context, rollout models.RolloutCampaign) (models.RolloutCampaign, error)
+	// UpdateRollout records the progress of a running campaign, and when it finished once its
+	// status is no longer StatusRunning. Campaigns that are no longer running are left as they are.
+	UpdateRollout(ctx context.Context, rollout models.RolloutCampaign) error
+	// CancelRollout marks a running campaign as cancelled, returning ErrConflict if it has already finished
+	CancelRollout(ctx context.Context, id int) error
+}
+
+// RegistryCredentialStore persists registry credentials. Passwords are stored as given,
+// callers seal them before storing.
+type RegistryCredentialStore interface {
+	ListRegistryCredentials(ctx context.Context) ([]models.RegistryCredential, error)
+	GetRegistryCredential(ctx context.Context, id int) (models.RegistryCredential, error)
+	// GetRegistryCredentialPassword returns the stored password, which is left out of the credential
+	GetRegistryCredentialPassword(ctx context.Context, id int) (string, error)
+	// CreateRegistryCredential stores the password returned by seal, which is given the Id of the
+	// new credential so that the sealed password can be bound to it
+	CreateRegistryCredential(ctx context.Context, credential models.RegistryCredential, seal func(id int) (string, error)) (models.RegistryCredential, error)
+	// UpdateRegistryCredential keeps the password if the new one is empty. Adapters using
+	// the credential have their updated time changed, as they need a sync to use it.
+	UpdateRegistryCredential(ctx context.Context, id int, credential models.RegistryCredential) (models.RegistryCredential, error)
+	// DeleteRegistryCredential returns ErrConflict if an adapter uses the credential
+	DeleteRegistryCredential(ctx context.Context, id int) error
+}
+
+// LeaseStore persists named leases, which let one replica at a time do work shared by all replicas
+type LeaseStore interface {
+	// AcquireLease takes or renews a lease for holder until lockedUntil, returning ErrConflict
+	// if another holder has it beyond now
+	AcquireLease(ctx context.Context, name string, holder string, now time.Time, lockedUntil time.Time) error
+	// ReleaseLease lets others acquire a lease right away, if holder still has it
+	ReleaseLease(ctx context.Context, name string, holder string) error
+}
+
+// Store persists everything the attendant keeps in its database
+type Store interface {
+	AdapterStore
+	WebhookStore
+	OperationStore
+	RolloutStore
+	RegistryCredentialStore
+	LeaseStore
+}
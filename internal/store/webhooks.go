@@ -0,0 +1,233 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/pkg/errors"
+)
+
+// webhookSubscriptionColumns are the columns read by scanWebhookSubscription, in order
+const webhookSubscriptionColumns = "id, targetUrl, events, created, updated"
+
+// scanWebhookSubscription reads a row selected using webhookSubscriptionColumns, optionally followed by the secret
+func scanWebhookSubscription(row interface{ Scan(...any) error }, withSecret bool) (models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	var subscribedEvents string
+	destinations := []any{&subscription.ID, &subscription.TargetURL, &subscribedEvents, &subscription.Created, &subscription.Updated}
+	if withSecret {
+		destinations = append(destinations, &subscription.Secret)
+	}
+	err := row.Scan(destinations...)
+	subscription.Events = []string{}
+	if subscribedEvents != "" {
+		subscription.Events = strings.Split(subscribedEvents, ",")
+	}
+	return subscription, err
+}
+
+// listWebhookSubscriptions reads all subscriptions, optionally including their secrets
+func (store sqlStore) listWebhookSubscriptions(ctx context.Context, withSecret bool) ([]models.WebhookSubscription, error) {
+	columns := webhookSubscriptionColumns
+	if withSecret {
+		columns += ", secret"
+	}
+	rows, err := store.query(ctx, "SELECT "+columns+" FROM webhookSubscriptions")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list webhook subscriptions")
+	}
+	defer rows.Close()
+	subscriptions := []models.WebhookSubscription{}
+	for rows.Next() {
+		subscription, err := scanWebhookSubscription(rows, withSecret)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read webhook subscription")
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, errors.Wrap(rows.Err(), "failed to list webhook subscriptions")
+}
+
+func (store sqlStore) ListWebhookSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	return store.listWebhookSubscriptions(ctx, false)
+}
+
+func (store sqlStore) ListWebhookTargets(ctx context.Context) ([]models.WebhookSubscription, error) {
+	return store.listWebhookSubscriptions(ctx, true)
+}
+
+func (store sqlStore) GetWebhookSubscription(ctx context.Context, id int) (models.WebhookSubscription, error) {
+	subscription, err := scanWebhookSubscription(store.queryRow(ctx, "SELECT "+webhookSubscriptionColumns+" FROM webhookSubscriptions WHERE id = ?", id), false)
+	if err == sql.ErrNoRows {
+		return models.WebhookSubscription{}, ErrNotFound
+	}
+	return subscription, errors.Wrap(err, "failed to get webhook subscription")
+}
+
+func (store sqlStore) CreateWebhookSubscription(ctx context.Context, subscription models.WebhookSubscription) (models.WebhookSubscription, error) {
+	var id int
+	err := store.queryRow(ctx, "INSERT INTO webhookSubscriptions (targetUrl, events, secret) VALUES (?, ?, ?) RETURNING id", subscription.TargetURL, strings.Join(subscription.Events, ","), subscription.Secret).Scan(&id)
+	if err != nil {
+		return models.WebhookSubscription{}, errors.Wrap(err, "failed to insert webhook subscription")
+	}
+	return store.GetWebhookSubscription(ctx, id)
+}
+
+func (store sqlStore) DeleteWebhookSubscription(ctx context.Context, id int) error {
+	return affectedOne(store.exec(ctx, "DELETE FROM webhookSubscriptions WHERE id = ?", id))
+}
+
+func (store sqlStore) EnqueueWebhookEvent(ctx context.Context, payload models.WebhookPayload) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode webhook event")
+	}
+	_, err = store.exec(ctx, "INSERT INTO webhookEvents (eventType, payload) VALUES (?, ?)", payload.Event, string(encoded))
+	return errors.Wrap(err, "failed to enqueue webhook event")
+}
+
+func (store sqlStore) ListWebhookEvents(ctx context.Context, limit int) ([]WebhookEvent, error) {
+	rows, err := store.query(ctx, "SELECT id, payload FROM webhookEvents ORDER BY id LIMIT ?", limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list webhook events")
+	}
+	defer rows.Close()
+	events := []WebhookEvent{}
+	for rows.Next() {
+		var event WebhookEvent
+		var payload string
+		if err := rows.Scan(&event.ID, &payload); err != nil {
+			return nil, errors.Wrap(err, "failed to read webhook event")
+		}
+		if err := json.Unmarshal([]byte(payload), &event.Payload); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode webhook event %d", event.ID)
+		}
+		events = append(events, event)
+	}
+	return events, errors.Wrap(rows.Err(), "failed to list webhook events")
+}
+
+func (store sqlStore) ScheduleWebhookDeliveries(ctx context.Context, event WebhookEvent, subscriptionIds []int) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode webhook event")
+	}
+	return store.inTransaction(ctx, func(transaction transaction) error {
+		// Removing the event first makes sure that only one replica schedules it
+		if err := affectedOne(transaction.exec(ctx, "DELETE FROM webhookEvents WHERE id = ?", event.ID)); err != nil {
+			return err
+		}
+		for _, subscriptionId := range subscriptionIds {
+			_, err := transaction.exec(ctx, "INSERT INTO webhookDeliveries (subscriptionId, eventType, payload) VALUES (?, ?, ?)", subscriptionId, event.Payload.Event, string(payload))
+			if err != nil {
+				return errors.Wrap(err, "failed to schedule webhook delivery")
+			}
+		}
+		return nil
+	})
+}
+
+func (store sqlStore) ClaimWebhookDelivery(ctx context.Context, now time.Time, lockedUntil time.Time) (WebhookDelivery, error) {
+	// Times are stored as Unix seconds, which compare the same way in every database
+	rows, err := store.query(ctx, "SELECT id FROM webhookDeliveries WHERE nextAttempt <= ? AND lockedUntil <= ? ORDER BY id LIMIT 8", now.Unix(), now.Unix())
+	if err != nil {
+		return WebhookDelivery{}, errors.Wrap(err, "failed to list due webhook deliveries")
+	}
+	candidates := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return WebhookDelivery{}, errors.Wrap(err, "failed to read webhook delivery")
+		}
+		candidates = append(candidates, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return WebhookDelivery{}, errors.Wrap(err, "failed to list due webhook deliveries")
+	}
+	for _, id := range candidates {
+		// Other workers may have claimed the delivery since it was listed
+		err := affectedOne(store.exec(ctx, "UPDATE webhookDeliveries SET lockedUntil = ? WHERE id = ? AND lockedUntil <= ?", lockedUntil.Unix(), id, now.Unix()))
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return WebhookDelivery{}, errors.Wrap(err, "failed to claim webhook delivery")
+		}
+		return store.getWebhookDelivery(ctx, id)
+	}
+	return WebhookDelivery{}, ErrNotFound
+}
+
+// getWebhookDelivery reads a delivery along with its subscription
+func (store sqlStore) getWebhookDelivery(ctx context.Context, id int) (WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var payload string
+	var subscribedEvents string
+	subscription := &delivery.Subscription
+	err := store.queryRow(ctx, "SELECT webhookDeliveries.id, webhookDeliveries.payload, webhookDeliveries.attempts, webhookSubscriptions.id, targetUrl, events, secret, webhookSubscriptions.created, updated FROM webhookDeliveries JOIN webhookSubscriptions ON webhookSubscriptions.id = webhookDeliveries.subscriptionId WHERE webhookDeliveries.id = ?", id).
+		Scan(&delivery.ID, &payload, &delivery.Attempts, &subscription.ID, &subscription.TargetURL, &subscribedEvents, &subscription.Secret, &subscription.Created, &subscription.Updated)
+	if err == sql.ErrNoRows {
+		return WebhookDelivery{}, ErrNotFound
+	}
+	if err != nil {
+		return WebhookDelivery{}, errors.Wrap(err, "failed to get webhook delivery")
+	}
+	subscription.Events = []string{}
+	if subscribedEvents != "" {
+		subscription.Events = strings.Split(subscribedEvents, ",")
+	}
+	return delivery, errors.Wrapf(json.Unmarshal([]byte(payload), &delivery.Payload), "failed to decode webhook delivery %d", id)
+}
+
+func (store sqlStore) RetryWebhookDelivery(ctx context.Context, id int, attempts int, nextAttempt time.Time, lastError string) error {
+	return affectedOne(store.exec(ctx, "UPDATE webhookDeliveries SET attempts = ?, nextAttempt = ?, lockedUntil = 0, lastError = ? WHERE id = ?", attempts, nextAttempt.Unix(), lastError, id))
+}
+
+func (store sqlStore) DeleteWebhookDelivery(ctx context.Context, id int) error {
+	return affectedOne(store.exec(ctx, "DELETE FROM webhookDeliveries WHERE id = ?", id))
+}
+
+func (store sqlStore) DeadLetterWebhookDelivery(ctx context.Context, id int, deadLetter models.WebhookDeadLetter) error {
+	payload, err := json.Marshal(deadLetter.Payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode webhook dead letter payload")
+	}
+	return store.inTransaction(ctx, func(transaction transaction) error {
+		if err := affectedOne(transaction.exec(ctx, "DELETE FROM webhookDeliveries WHERE id = ?", id)); err != nil {
+			return err
+		}
+		_, err := transaction.exec(ctx, "INSERT INTO webhookDeadLetters (subscriptionId, eventType, payload, attempts, lastError) VALUES (?, ?, ?, ?, ?)",
+			deadLetter.SubscriptionID, deadLetter.EventType, string(payload), deadLetter.Attempts, deadLetter.LastError)
+		return errors.Wrap(err, "failed to insert webhook dead letter")
+	})
+}
+
+func (store sqlStore) ListWebhookDeadLetters(ctx context.Context, subscriptionId int) ([]models.WebhookDeadLetter, error) {
+	rows, err := store.query(ctx, "SELECT id, subscriptionId, eventType, payload, attempts, lastError, created FROM webhookDeadLetters WHERE subscriptionId = ? ORDER BY id", subscriptionId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list webhook dead letters")
+	}
+	defer rows.Close()
+	deadLetters := []models.WebhookDeadLetter{}
+	for rows.Next() {
+		var deadLetter models.WebhookDeadLetter
+		var payload string
+		if err := rows.Scan(&deadLetter.ID, &deadLetter.SubscriptionID, &deadLetter.EventType, &payload, &deadLetter.Attempts, &deadLetter.LastError, &deadLetter.Created); err != nil {
+			return nil, errors.Wrap(err, "failed to read webhook dead letter")
+		}
+		// A payload that can not be decoded is still listed, so that it can be deleted
+		json.Unmarshal([]byte(payload), &deadLetter.Payload)
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	return deadLetters, errors.Wrap(rows.Err(), "failed to list webhook dead letters")
+}
+
+func (store sqlStore) DeleteWebhookDeadLetter(ctx context.Context, subscriptionId int, id int) error {
+	return affectedOne(store.exec(ctx, "DELETE FROM webhookDeadLetters WHERE id = ? AND subscriptionId = ?", id, subscriptionId))
+}
@@ -0,0 +1,340 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/internal/config"
+	"github.com/Kaese72/adapter-attendant/internal/database"
+	"github.com/Kaese72/adapter-attendant/internal/events"
+	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/internal/store"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/pkg/errors"
+)
+
+// RolloutFailed is delivered in addition to health-changed when an adapter rollout fails
+const RolloutFailed = "rollout-failed"
+
+// Headers set on every delivery
+const (
+	EventHeader     = "X-Huemie-Event"
+	SignatureHeader = "X-Huemie-Signature"
+	TimestampHeader = "X-Huemie-Timestamp"
+)
+
+// Sign computes the signature of a delivery, as sent in SignatureHeader. The timestamp sent in
+// TimestampHeader is signed along with the body, "<timestamp>.<body>", so that subscribers can
+// reject old deliveries replayed with their signature.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookEventTypes returns the webhook event names a hub event is delivered as
+func webhookEventTypes(event events.Event) []string {
+	eventTypes := []string{event.Type}
+	if event.Type == events.HealthChanged && event.Payload.Health == database.HealthFailed {
+		eventTypes = append(eventTypes, RolloutFailed)
+	}
+	return eventTypes
+}
+
+const (
+	// pollInterval is how often the outbox and due retries are looked for when not woken up,
+	// which picks up events published by other replicas
+	pollInterval = 5 * time.Second
+	// scheduleBatch is how many outbox events are scheduled at a time
+	scheduleBatch = 100
+	// claimMargin is added to the delivery timeout to lock deliveries while they are attempted
+	claimMargin = 30 * time.Second
+	// maxErrorLength is the length of the lastError columns
+	maxErrorLength = 1024
+	// outboxBuffer is how many published events may wait to be written to the outbox before
+	// further events are dropped, as publishers are never held up by the database
+	outboxBuffer = 1024
+)
+
+// Dispatcher delivers hub events to webhook subscriptions stored in the database.
+// Published events are buffered and written to an outbox in the background, so that none
+// are lost to slow deliveries, database errors or restarts, and are delivered by a fixed
+// number of workers which may run on any replica.
+type Dispatcher struct {
+	webhooks store.WebhookStore
+	client   *http.Client
+	// published receives the events published on the hub, until unsubscribe is called
+	published   <-chan events.Event
+	unsubscribe func()
+	// scheduled wakes up idle workers when deliveries have been scheduled
+	scheduled chan struct{}
+	// enqueued wakes up scheduling when events have been added to the outbox
+	enqueued chan struct{}
+	running  sync.WaitGroup
+}
+
+// NewDispatcher creates a dispatcher which adds every event published on hub from now on to
+// the outbox once started
+func NewDispatcher(webhooks store.WebhookStore, hub *events.Hub) *Dispatcher {
+	published, unsubscribe := hub.SubscribeBuffered(outboxBuffer)
+	return &Dispatcher{
+		webhooks:    webhooks,
+		client:      newClient(),
+		published:   published,
+		unsubscribe: unsubscribe,
+		scheduled:   make(chan struct{}, config.Loaded().Webhooks.Workers),
+		enqueued:    make(chan struct{}, 1),
+	}
+}
+
+// drain writes published events to the outbox until ctx is cancelled, after which the events
+// already published are written before unsubscribing
+func (dispatcher *Dispatcher) drain(ctx context.Context) {
+	defer dispatcher.unsubscribe()
+	for {
+		select {
+		case event := <-dispatcher.published:
+			dispatcher.enqueue(ctx, event)
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-dispatcher.published:
+					dispatcher.enqueue(ctx, event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// enqueue adds the webhook events a hub event is delivered as to the outbox
+func (dispatcher *Dispatcher) enqueue(ctx context.Context, event events.Event) {
+	// Events already published are written while shutting down as well
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	for _, eventType := range webhookEventTypes(event) {
+		payload := models.WebhookPayload{
+			Event:     eventType,
+			AdapterID: event.Payload.AdapterID,
+			Time:      event.Payload.Time,
+			Adapter:   event.Payload.Adapter,
+			Health:    event.Payload.Health,
+			Reason:    event.Payload.Reason,
+		}
+		if err := dispatcher.webhooks.EnqueueWebhookEvent(ctx, payload); err != nil {
+			logging.Error("Database error when enqueueing webhook event", ctx, map[string]any{"ERROR": err.Error(), "EVENT_TYPE": eventType, "ADAPTER_ID": payload.AdapterID})
+		}
+	}
+	wake(dispatcher.enqueued)
+}
+
+// wake signals a channel without waiting for anyone to receive it
+func wake(signal chan struct{}) {
+	select {
+	case signal <- struct{}{}:
+	default:
+	}
+}
+
+// Start writes published events to the outbox, and schedules and delivers them, in the
+// background until ctx is cancelled
+func (dispatcher *Dispatcher) Start(ctx context.Context) {
+	dispatcher.running.Add(1)
+	go func() {
+		defer dispatcher.running.Done()
+		dispatcher.drain(ctx)
+	}()
+	for i := 0; i < config.Loaded().Webhooks.Workers; i++ {
+		dispatcher.running.Add(1)
+		go func() {
+			defer dispatcher.running.Done()
+			dispatcher.work(ctx)
+		}()
+	}
+	dispatcher.running.Add(1)
+	go func() {
+		defer dispatcher.running.Done()
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			dispatcher.schedule(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-dispatcher.enqueued:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Wait blocks until the workers have stopped after the context passed to Start was cancelled.
+// Deliveries cut short are attempted again on the next start.
+func (dispatcher *Dispatcher) Wait() {
+	dispatcher.running.Wait()
+}
+
+// subscriptionIdsFor returns the Ids of the subscriptions that want an event type
+func subscriptionIdsFor(subscriptions []models.WebhookSubscription, eventType string) []int {
+	ids := []int{}
+	for _, sub := range subscriptions {
+		if len(sub.Events) == 0 || slices.Contains(sub.Events, eventType) {
+			ids = append(ids, sub.ID)
+		}
+	}
+	return ids
+}
+
+// schedule moves events from the outbox to the deliveries of the subscriptions that want them.
+// Events stay in the outbox until the subscriptions have been looked up, so that a database
+// error delays them rather than losing them.
+func (dispatcher *Dispatcher) schedule(ctx context.Context) {
+	for {
+		outbox, err := dispatcher.webhooks.ListWebhookEvents(ctx, scheduleBatch)
+		if err != nil {
+			logging.Error("Database error when reading webhook outbox", ctx, map[string]any{"ERROR": err.Error()})
+			return
+		}
+		if len(outbox) == 0 {
+			return
+		}
+		subscriptions, err := dispatcher.webhooks.ListWebhookTargets(ctx)
+		if err != nil {
+			logging.Error("Database error when fetching webhook subscriptions", ctx, map[string]any{"ERROR": err.Error()})
+			return
+		}
+		for _, event := range outbox {
+			err := dispatcher.webhooks.ScheduleWebhookDeliveries(ctx, event, subscriptionIdsFor(subscriptions, event.Payload.Event))
+			if errors.Is(err, store.ErrNotFound) {
+				// Scheduled by another replica
+				continue
+			}
+			if err != nil {
+				logging.Error("Database error when scheduling webhook deliveries", ctx, map[string]any{"ERROR": err.Error()})
+				return
+			}
+		}
+		for i := 0; i < cap(dispatcher.scheduled); i++ {
+			wake(dispatcher.scheduled)
+		}
+		if len(outbox) < scheduleBatch {
+			return
+		}
+	}
+}
+
+// work attempts due deliveries one at a time until ctx is cancelled
+func (dispatcher *Dispatcher) work(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		delivery, err := dispatcher.webhooks.ClaimWebhookDelivery(ctx, now, now.Add(config.Loaded().Webhooks.Timeout+claimMargin))
+		if err == nil {
+			dispatcher.attempt(ctx, delivery)
+			continue
+		}
+		if !errors.Is(err, store.ErrNotFound) && ctx.Err() == nil {
+			logging.Error("Database error when claiming webhook delivery", ctx, map[string]any{"ERROR": err.Error()})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-dispatcher.scheduled:
+		case <-ticker.C:
+		}
+	}
+}
+
+// retryBackoff is how long to wait before the next attempt after a number of failed attempts
+func retryBackoff(attempts int) time.Duration {
+	backoff := config.Loaded().Webhooks.InitialBackoff
+	for i := 1; i < attempts && backoff < config.Loaded().Webhooks.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, config.Loaded().Webhooks.MaxBackoff)
+}
+
+// truncateError shortens an error to fit the lastError columns
+func truncateError(err error) string {
+	message := err.Error()
+	if len(message) > maxErrorLength {
+		message = message[:maxErrorLength]
+	}
+	return message
+}
+
+// attempt makes a delivery attempt and records its outcome. A delivery that has failed
+// every attempt is dead lettered, so that it can be inspected through the API.
+func (dispatcher *Dispatcher) attempt(ctx context.Context, delivery store.WebhookDelivery) {
+	// Outcomes are also recorded while shutting down
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	var recordErr error
+	deliverErr := dispatcher.deliver(ctx, delivery.Subscription, delivery.Payload)
+	switch {
+	case deliverErr == nil:
+		recordErr = dispatcher.webhooks.DeleteWebhookDelivery(recordCtx, delivery.ID)
+	case ctx.Err() != nil:
+		// Cut short by shutdown, which does not count as an attempt
+		recordErr = dispatcher.webhooks.RetryWebhookDelivery(recordCtx, delivery.ID, delivery.Attempts, time.Now(), truncateError(deliverErr))
+	default:
+		attempts := delivery.Attempts + 1
+		logging.Info("Webhook delivery failed", ctx, map[string]any{"ERROR": deliverErr.Error(), "SUBSCRIPTION_ID": delivery.Subscription.ID, "ATTEMPT": attempts})
+		if attempts < config.Loaded().Webhooks.MaxAttempts {
+			recordErr = dispatcher.webhooks.RetryWebhookDelivery(recordCtx, delivery.ID, attempts, time.Now().Add(retryBackoff(attempts)), truncateError(deliverErr))
+			break
+		}
+		recordErr = dispatcher.webhooks.DeadLetterWebhookDelivery(recordCtx, delivery.ID, models.WebhookDeadLetter{
+			SubscriptionID: delivery.Subscription.ID,
+			EventType:      delivery.Payload.Event,
+			Payload:        delivery.Payload,
+			Attempts:       attempts,
+			LastError:      truncateError(deliverErr),
+		})
+	}
+	// Deliveries of subscriptions deleted meanwhile are gone along with them
+	if recordErr != nil && !errors.Is(recordErr, store.ErrNotFound) {
+		logging.Error("Database error when recording webhook delivery", ctx, map[string]any{"ERROR": recordErr.Error(), "SUBSCRIPTION_ID": delivery.Subscription.ID})
+	}
+}
+
+// deliver makes a single delivery attempt
+func (dispatcher *Dispatcher) deliver(ctx context.Context, sub models.WebhookSubscription, payload models.WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "could not encode payload")
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.TargetURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not create request")
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, payload.Event)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(SignatureHeader, Sign(sub.Secret, timestamp, body))
+	response, err := dispatcher.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("subscriber responded with %s", response.Status)
+	}
+	return nil
+}
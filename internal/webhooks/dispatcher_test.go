@@ -0,0 +1,100 @@
+package webhooks
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/Kaese72/adapter-attendant/internal/database"
+	"github.com/Kaese72/adapter-attendant/internal/events"
+	"github.com/Kaese72/adapter-attendant/internal/store"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{name: "known signature", secret: "secret", timestamp: "1700000000", body: `{"event":"created"}`, want: "sha256=cf8d8143cebb3ff74cc79ef6786186d41807bfb4c5a8c5161e9a26da35369b87"},
+		{name: "other secret", secret: "other", timestamp: "1700000000", body: `{"event":"created"}`},
+		{name: "other timestamp", secret: "secret", timestamp: "1700000001", body: `{"event":"created"}`},
+		{name: "other body", secret: "secret", timestamp: "1700000000", body: `{"event":"deleted"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Sign(test.secret, test.timestamp, []byte(test.body))
+			if test.want != "" && got != test.want {
+				t.Errorf("Sign() = %q, want %q", got, test.want)
+			}
+			if test.want == "" && got == tests[0].want {
+				t.Errorf("Sign() = %q, want a different signature", got)
+			}
+		})
+	}
+}
+
+func TestWebhookEventTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		event events.Event
+		want  []string
+	}{
+		{name: "created", event: events.Event{Type: events.Created}, want: []string{events.Created}},
+		{name: "degraded", event: events.Event{Type: events.HealthChanged, Payload: models.AdapterEvent{Health: database.HealthDegraded}}, want: []string{events.HealthChanged}},
+		{name: "failed", event: events.Event{Type: events.HealthChanged, Payload: models.AdapterEvent{Health: database.HealthFailed}}, want: []string{events.HealthChanged, RolloutFailed}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := webhookEventTypes(test.event); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("webhookEventTypes() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// outboxStore records the events added to the outbox, after release is closed
+type outboxStore struct {
+	store.WebhookStore
+	release  chan struct{}
+	mu       sync.Mutex
+	enqueued []string
+}
+
+func (outbox *outboxStore) EnqueueWebhookEvent(ctx context.Context, payload models.WebhookPayload) error {
+	<-outbox.release
+	outbox.mu.Lock()
+	defer outbox.mu.Unlock()
+	outbox.enqueued = append(outbox.enqueued, payload.Event)
+	return nil
+}
+
+func TestDrain(t *testing.T) {
+	hub := events.NewHub()
+	outbox := &outboxStore{release: make(chan struct{})}
+	dispatcher := NewDispatcher(outbox, hub)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatcher.drain(ctx)
+	}()
+
+	// Publishing is not held up by an outbox that is slow to write
+	hub.Publish(ctx, events.Created, models.AdapterEvent{AdapterID: 1})
+	hub.Publish(ctx, events.HealthChanged, models.AdapterEvent{AdapterID: 1, Health: database.HealthFailed})
+	hub.Publish(ctx, events.Deleted, models.AdapterEvent{AdapterID: 1})
+
+	// Events published before shutting down are written all the same
+	cancel()
+	close(outbox.release)
+	<-done
+	want := []string{events.Created, events.HealthChanged, RolloutFailed, events.Deleted}
+	if !reflect.DeepEqual(outbox.enqueued, want) {
+		t.Errorf("enqueued %v, want %v", outbox.enqueued, want)
+	}
+}
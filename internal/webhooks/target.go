@@ -0,0 +1,73 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/internal/config"
+)
+
+var (
+	// sharedAddressSpace is the carrier-grade NAT range, which some clusters use for pods and services
+	sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+	// metadataAddresses are the cloud instance metadata endpoints outside the link-local range
+	metadataAddresses = []net.IP{net.ParseIP("fd00:ec2::254"), net.ParseIP("100.100.100.200")}
+)
+
+// allowedAddress reports whether webhooks may be delivered to an address. Addresses of the
+// host itself, link-local addresses and cloud metadata endpoints are never allowed, cluster
+// and other private addresses only when allowPrivate is set.
+func allowedAddress(ip net.IP, allowPrivate bool) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || slices.ContainsFunc(metadataAddresses, ip.Equal) {
+		return false
+	}
+	return allowPrivate || (!ip.IsPrivate() && !sharedAddressSpace.Contains(ip))
+}
+
+// ValidateTarget checks that a subscription URL is an absolute http(s) URL whose host
+// resolves to allowed addresses only. The returned error is suitable for showing to the user.
+func ValidateTarget(ctx context.Context, target string) error {
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("targetUrl must be an absolute http(s) URL")
+	}
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil {
+		return fmt.Errorf("targetUrl host %s can not be resolved", parsed.Hostname())
+	}
+	allowPrivate := config.Loaded().Webhooks.AllowPrivateTargets
+	for _, address := range addresses {
+		if !allowedAddress(address.IP, allowPrivate) {
+			return fmt.Errorf("targetUrl host %s resolves to %s, which webhooks may not be delivered to", parsed.Hostname(), address.IP)
+		}
+	}
+	return nil
+}
+
+// newClient returns the client deliveries are made with. It refuses to connect to addresses
+// that are not allowed, whatever a host resolved to when the subscription was created and
+// wherever a redirect points.
+func newClient() *http.Client {
+	allowPrivate := config.Loaded().Webhooks.AllowPrivateTargets
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || !allowedAddress(ip, allowPrivate) {
+			return fmt.Errorf("connecting to %s is not allowed, webhooks may not be delivered to it", host)
+		}
+		return nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: config.Loaded().Webhooks.Timeout, Transport: transport}
+}
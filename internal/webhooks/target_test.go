@@ -0,0 +1,36 @@
+package webhooks
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAllowedAddress(t *testing.T) {
+	tests := []struct {
+		name         string
+		address      string
+		allowPrivate bool
+		want         bool
+	}{
+		{name: "public IPv4", address: "93.184.216.34", want: true},
+		{name: "public IPv6", address: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{name: "private", address: "10.96.0.10"},
+		{name: "allowed private", address: "10.96.0.10", allowPrivate: true, want: true},
+		{name: "allowed unique local IPv6", address: "fd00::1", allowPrivate: true, want: true},
+		{name: "shared address space", address: "100.64.0.1"},
+		{name: "allowed shared address space", address: "100.64.0.1", allowPrivate: true, want: true},
+		{name: "loopback", address: "127.0.0.1", allowPrivate: true},
+		{name: "IPv6 loopback", address: "::1", allowPrivate: true},
+		{name: "unspecified", address: "0.0.0.0", allowPrivate: true},
+		{name: "link-local", address: "169.254.10.1", allowPrivate: true},
+		{name: "metadata endpoint", address: "169.254.169.254", allowPrivate: true},
+		{name: "IPv6 metadata endpoint", address: "fd00:ec2::254", allowPrivate: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := allowedAddress(net.ParseIP(test.address), test.allowPrivate); got != test.want {
+				t.Errorf("allowedAddress(%s, %v) = %v, want %v", test.address, test.allowPrivate, got, test.want)
+			}
+		})
+	}
+}
@@ -2,41 +2,284 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/Kaese72/huemie-lib/middleware"
+	"github.com/Kaese72/adapter-attendant/internal/auth"
 	"github.com/Kaese72/adapter-attendant/internal/config"
 	"github.com/Kaese72/adapter-attendant/internal/database"
+	"github.com/Kaese72/adapter-attendant/internal/events"
+	"github.com/Kaese72/adapter-attendant/internal/health"
 	"github.com/Kaese72/adapter-attendant/internal/logging"
+	"github.com/Kaese72/adapter-attendant/internal/metrics"
 	"github.com/Kaese72/adapter-attendant/internal/restwebapp"
+	"github.com/Kaese72/adapter-attendant/internal/store"
+	"github.com/Kaese72/adapter-attendant/internal/webhooks"
+	"github.com/Kaese72/adapter-attendant/migrations"
+	"github.com/Kaese72/adapter-attendant/rest/models"
+	"github.com/Kaese72/huemie-lib/middleware"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humamux"
+	"github.com/danielgtaylor/huma/v2/sse"
 	"github.com/gorilla/mux"
 	"go.elastic.co/apm/module/apmsql"
 	_ "go.elastic.co/apm/module/apmsql/mysql"
+	_ "go.elastic.co/apm/module/apmsql/pq"
 )
 
 func init() {
 
 }
 
+// openDatabase opens the configured database and the store on top of it
+func openDatabase() (*sql.DB, store.Store, error) {
+	conf := config.Loaded().Database
+	switch conf.Driver {
+	case "sqlite":
+		db, err := store.OpenSQLite(conf.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, store.NewSQLite(db), nil
+	case "postgres":
+		dsn := conf.DSN
+		if dsn == "" {
+			port := conf.Port
+			if port == 0 {
+				port = 5432
+			}
+			dsn = (&url.URL{
+				Scheme: "postgres",
+				User:   url.UserPassword(conf.User, conf.Password),
+				Host:   net.JoinHostPort(conf.Host, strconv.Itoa(port)),
+				Path:   "/" + conf.Database,
+			}).String()
+		}
+		db, err := apmsql.Open("postgres", dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, store.NewPostgres(db), nil
+	default:
+		dsn := conf.DSN
+		if dsn == "" {
+			port := conf.Port
+			if port == 0 {
+				port = 3306
+			}
+			dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&loc=UTC", conf.User, conf.Password, conf.Host, port, conf.Database)
+		}
+		db, err := apmsql.Open("mysql", dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, store.NewMySQL(db), nil
+	}
+}
+
+// migrate applies pending schema migrations and exits if that fails
+func migrate(db *sql.DB) {
+	applied, err := migrations.Migrate(context.Background(), db, config.Loaded().Database.Driver, config.Loaded().Database.User)
+	if err != nil {
+		logging.Error(err.Error(), context.Background(), map[string]any{"APPLIED": applied})
+		os.Exit(1)
+	}
+	logging.Info("Database schema is up to date", context.Background(), map[string]any{"APPLIED": applied})
+}
+
+// newServer builds an HTTP server with the configured timeouts
+func newServer(port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf("0.0.0.0:%d", port),
+		Handler:           handler,
+		ReadTimeout:       config.Loaded().Server.ReadTimeout,
+		ReadHeaderTimeout: config.Loaded().Server.ReadHeaderTimeout,
+		WriteTimeout:      config.Loaded().Server.WriteTimeout,
+		IdleTimeout:       config.Loaded().Server.IdleTimeout,
+	}
+}
+
+// withoutWriteTimeout lifts the server write timeout for an operation which responds for longer,
+// like event streams and syncs, which are bounded by timeouts of their own
+func withoutWriteTimeout(operation *huma.Operation) {
+	operation.Middlewares = append(operation.Middlewares, func(ctx huma.Context, next func(huma.Context)) {
+		_, writer := humamux.Unwrap(ctx)
+		if err := http.NewResponseController(writer).SetWriteDeadline(time.Time{}); err != nil {
+			logging.Error("Could not lift write timeout", ctx.Context(), map[string]any{"ERROR": err.Error(), "OPERATION": operation.OperationID})
+		}
+		next(ctx)
+	})
+}
+
+// swappableHandler serves requests with the handler last set, which lets a server start
+// before everything it serves exists
+type swappableHandler struct {
+	handler atomic.Pointer[http.Handler]
+}
+
+func (swappable *swappableHandler) set(handler http.Handler) {
+	swappable.handler.Store(&handler)
+}
+
+func (swappable *swappableHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	(*swappable.handler.Load()).ServeHTTP(writer, request)
+}
+
+// newInternalRouter serves metrics along with the liveness and readiness reported by checker
+func newInternalRouter(checker *health.Checker) (*mux.Router, huma.API) {
+	internalRouter := mux.NewRouter()
+	internalAPI := humamux.New(internalRouter, huma.DefaultConfig("adapter-attendant-internal", "1.0.0"))
+	internalAPI.UseMiddleware(metrics.Middleware)
+	internalRouter.Handle("/metrics", metrics.Handler())
+	huma.Get(internalAPI, "/healthz", checker.LivenessV1)
+	huma.Get(internalAPI, "/readyz", checker.ReadinessV1)
+	return internalRouter, internalAPI
+}
+
 func main() {
-	kubernetesHandle, err := database.NewPureK8sBackend(config.Loaded.ClusterConfig)
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file, defaults to $CONFIG_FILE")
+	checkConfig := flag.Bool("check-config", false, "validate the configuration and exit")
+	dumpConfig := flag.Bool("dump-config", false, "print the effective configuration, with secrets masked, and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [migrate]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := config.Load(*configFile); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if *dumpConfig {
+		if err := config.Dump(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	logging.SetDebug(config.Loaded().Logging.Debug)
+	switch flag.Arg(0) {
+	case "":
+	case "migrate":
+		db, _, err := openDatabase()
+		if err != nil {
+			logging.Error(err.Error(), context.Background())
+			os.Exit(1)
+		}
+		migrate(db)
+		db.Close()
+		os.Exit(0)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := config.Loaded().Validate(); err != nil {
+		if *checkConfig {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		logging.Error(err.Error(), context.Background())
+		os.Exit(1)
+	}
+	if *checkConfig {
+		fmt.Println("configuration is valid")
+		os.Exit(0)
+	}
+
+	// SIGTERM starts a graceful shutdown, a second signal kills the process
+	shutdownCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stopSignals()
+	// Background workers outlive the servers, so they have a context of their own. Until startup
+	// completes there is nothing to drain, so a signal stops them right away.
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	stopWorkersOnSignal := context.AfterFunc(shutdownCtx, stopWorkers)
+
+	serverErrors := make(chan error, 2)
+	serve := func(server *http.Server) {
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				serverErrors <- err
+			}
+		}()
+	}
+	// The internal server reports the attendant alive but not ready while it starts up, so that
+	// a slow start is not mistaken for a hung process
+	startupChecker := health.NewChecker()
+	startupChecker.Add("startup", func(ctx context.Context) error {
+		return fmt.Errorf("starting up")
+	})
+	startupRouter, _ := newInternalRouter(startupChecker)
+	internalHandler := &swappableHandler{}
+	internalHandler.set(startupRouter)
+	internalServer := newServer(config.Loaded().InternalPort, internalHandler)
+	serve(internalServer)
+
+	kubernetesHandle, err := database.NewPureK8sBackend(config.Loaded().ClusterConfig)
 	if err != nil {
 		logging.Error(err.Error(), context.Background())
 		os.Exit(1)
 	}
+	eventHub := events.NewHub()
+	kubernetesHandle.OnHealthChanged(func(adapterId int, health string, reason string) {
+		eventHub.Publish(context.Background(), events.HealthChanged, models.AdapterEvent{AdapterID: adapterId, Health: health, Reason: reason})
+	})
+	if err := kubernetesHandle.Start(workerCtx, config.Loaded().Server.StartupTimeout); err != nil {
+		if shutdownCtx.Err() != nil {
+			logging.Info("Shut down while starting up", context.Background())
+			os.Exit(0)
+		}
+		logging.Error(err.Error(), context.Background())
+		os.Exit(1)
+	}
 
-	db, err := apmsql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&loc=UTC", config.Loaded.Database.User, config.Loaded.Database.Password, config.Loaded.Database.Host, config.Loaded.Database.Port, config.Loaded.Database.Database))
+	db, dbStore, err := openDatabase()
 	if err != nil {
 		logging.Error(err.Error(), context.Background())
 		os.Exit(1)
 	}
-	restWebapp := restwebapp.NewWebApp(kubernetesHandle, db)
+	if config.Loaded().Database.MigrateOnStartup {
+		migrate(db)
+	} else {
+		// A schema newer than this binary may have dropped or changed what it relies on
+		pending, err := migrations.Check(context.Background(), db, config.Loaded().Database.Driver)
+		if err != nil {
+			logging.Error(err.Error(), context.Background())
+			os.Exit(1)
+		}
+		if pending > 0 {
+			logging.Info("Database schema has pending migrations", context.Background(), map[string]any{"PENDING": pending})
+		}
+	}
+	metrics.RegisterDatabase(db, dbStore)
+	metrics.RegisterHealthSource(kubernetesHandle.HealthCounts)
+	restWebapp := restwebapp.NewWebApp(kubernetesHandle, dbStore, eventHub)
+	webhookDispatcher := webhooks.NewDispatcher(dbStore, eventHub)
+	webhookDispatcher.Start(workerCtx)
+	go restWebapp.CancelInterruptedOperations(workerCtx)
+	go restWebapp.ResumeRollouts(workerCtx)
+	go restWebapp.PollImageUpdates(workerCtx)
+	go func() {
+		err := config.Watch(workerCtx, *configFile, func(previous config.Config, current config.Config) {
+			if current.Adapters.ResyncOnChange && config.AdapterSettingsChanged(previous, current) {
+				go restWebapp.ResyncAdapters(workerCtx)
+			}
+		})
+		if err != nil {
+			logging.Error(err.Error(), context.Background())
+		}
+	}()
 
-	pubKey, err := middleware.LoadPublicKeyFromFile(config.Loaded.Auth.RSAPublicKeyPath)
+	pubKey, err := middleware.LoadPublicKeyFromFile(config.Loaded().Auth.RSAPublicKeyPath)
 	if err != nil {
 		logging.Error(err.Error(), context.Background())
 		os.Exit(1)
@@ -49,34 +292,95 @@ func main() {
 	publicHumaConfig.OpenAPIPath = "/adapter-attendant/openapi"
 	publicHumaConfig.DocsPath = "/adapter-attendant/docs"
 	publicAPI := humamux.New(publicRouter, publicHumaConfig)
+	publicAPI.UseMiddleware(metrics.Middleware, auth.Middleware(pubKey))
 
 	huma.Get(publicAPI, "/adapter-attendant/v1/adapters", restWebapp.GetAdaptersV1)
 	huma.Post(publicAPI, "/adapter-attendant/v1/adapters", restWebapp.PostAdapterV1)
+	huma.Post(publicAPI, "/adapter-attendant/v1/adapters/sync", restWebapp.SyncAdaptersV1, func(operation *huma.Operation) {
+		operation.DefaultStatus = http.StatusAccepted
+	})
 	huma.Get(publicAPI, "/adapter-attendant/v1/adapters/{id}", restWebapp.GetAdapterV1)
 	huma.Delete(publicAPI, "/adapter-attendant/v1/adapters/{id}", restWebapp.DeleteAdapterV1)
-	huma.Post(publicAPI, "/adapter-attendant/v1/adapters/{id}/sync", restWebapp.SyncAdapterV1)
+	huma.Post(publicAPI, "/adapter-attendant/v1/adapters/{id}/sync", restWebapp.SyncAdapterV1, withoutWriteTimeout)
 	huma.Post(publicAPI, "/adapter-attendant/v1/adapters/{id}/update", restWebapp.UpdateAdapterV1)
 	huma.Get(publicAPI, "/adapter-attendant/v1/adapters/{id}/address", restWebapp.GetAdapterAddressV1)
 	huma.Get(publicAPI, "/adapter-attendant/v1/adapters/{id}/arguments", restWebapp.GetAdapterArgumentsForAdapterV1)
 	huma.Post(publicAPI, "/adapter-attendant/v1/adapters/{id}/arguments", restWebapp.PostAdapterArgumentsForAdapterV1)
 	huma.Delete(publicAPI, "/adapter-attendant/v1/adapters/{id}/arguments/{argumentId}", restWebapp.DeleteAdapterArgumentsForAdapterV1)
 	huma.Patch(publicAPI, "/adapter-attendant/v1/adapters/{adapterId}/arguments/{argumentId}", restWebapp.PatchAdapterArgumentsForAdapterV1)
+	huma.Get(publicAPI, "/adapter-attendant/v1/drift", restWebapp.GetDriftV1)
+	huma.Get(publicAPI, "/adapter-attendant/v1/operations/{id}", restWebapp.GetOperationV1)
+	huma.Get(publicAPI, "/adapter-attendant/v1/rollouts", restWebapp.GetRolloutsV1)
+	huma.Post(publicAPI, "/adapter-attendant/v1/rollouts", restWebapp.PostRolloutV1, func(operation *huma.Operation) {
+		operation.DefaultStatus = http.StatusAccepted
+	})
+	huma.Get(publicAPI, "/adapter-attendant/v1/rollouts/{id}", restWebapp.GetRolloutV1)
+	huma.Post(publicAPI, "/adapter-attendant/v1/rollouts/{id}/cancel", restWebapp.CancelRolloutV1)
+	huma.Get(publicAPI, "/adapter-attendant/v1/registry-credentials", restWebapp.GetRegistryCredentialsV1)
+	huma.Post(publicAPI, "/adapter-attendant/v1/registry-credentials", restWebapp.PostRegistryCredentialV1)
+	huma.Get(publicAPI, "/adapter-attendant/v1/registry-credentials/{id}", restWebapp.GetRegistryCredentialV1)
+	huma.Put(publicAPI, "/adapter-attendant/v1/registry-credentials/{id}", restWebapp.UpdateRegistryCredentialV1)
+	huma.Delete(publicAPI, "/adapter-attendant/v1/registry-credentials/{id}", restWebapp.DeleteRegistryCredentialV1)
+	huma.Get(publicAPI, "/adapter-attendant/v1/webhooks", restWebapp.GetWebhooksV1)
+	huma.Post(publicAPI, "/adapter-attendant/v1/webhooks", restWebapp.PostWebhookV1)
+	huma.Get(publicAPI, "/adapter-attendant/v1/webhooks/{id}", restWebapp.GetWebhookV1)
+	huma.Delete(publicAPI, "/adapter-attendant/v1/webhooks/{id}", restWebapp.DeleteWebhookV1)
+	huma.Get(publicAPI, "/adapter-attendant/v1/webhooks/{id}/dead-letters", restWebapp.GetWebhookDeadLettersV1)
+	huma.Delete(publicAPI, "/adapter-attendant/v1/webhooks/{id}/dead-letters/{deadLetterId}", restWebapp.DeleteWebhookDeadLetterV1)
+	eventsOperation := huma.Operation{
+		OperationID: "get-adapter-events-v1",
+		Method:      http.MethodGet,
+		Path:        "/adapter-attendant/v1/events",
+		Summary:     "Stream adapter events",
+	}
+	withoutWriteTimeout(&eventsOperation)
+	sse.Register(publicAPI, eventsOperation, restwebapp.AdapterEventTypesV1, restWebapp.GetAdapterEventsV1)
 
-	// Internal router (adapter-attendant-internal) — no auth, restrict via NetworkPolicy
-	internalRouter := mux.NewRouter()
-	internalAPI := humamux.New(internalRouter, huma.DefaultConfig("adapter-attendant-internal", "1.0.0"))
+	healthChecker := health.NewChecker()
+	healthChecker.Add("database", health.DatabaseCheck(db))
+	healthChecker.Add("kubernetes", kubernetesHandle.Ping)
+	healthChecker.Add("rsa-public-key", health.PublicKeyCheck(pubKey))
+	healthChecker.Add("schema-version", health.SchemaVersionCheck(db, config.Loaded().Database.Driver))
 
+	// Internal router (adapter-attendant-internal) — no auth, restrict via NetworkPolicy
+	internalRouter, internalAPI := newInternalRouter(healthChecker)
 	huma.Get(internalAPI, "/adapter-attendant-internal/v1/adapters/{id}/address", restWebapp.GetAdapterAddressV1)
+	internalHandler.set(internalRouter)
 
-	go func() {
-		if err := http.ListenAndServe(fmt.Sprintf("0.0.0.0:%d", config.Loaded.InternalPort), internalRouter); err != nil {
-			logging.Error(err.Error(), context.Background())
-			os.Exit(1)
-		}
-	}()
+	publicServer := newServer(config.Loaded().PublicPort, publicRouter)
+	// Event streams never end by themselves and would hold up shutdown
+	publicServer.RegisterOnShutdown(restWebapp.CloseStreams)
+	serve(publicServer)
+	servers := []*http.Server{publicServer, internalServer}
+	// From here on a signal drains the servers before the workers are stopped
+	stopWorkersOnSignal()
 
-	if err := http.ListenAndServe(fmt.Sprintf("0.0.0.0:%d", config.Loaded.PublicPort), publicRouter); err != nil {
+	exitCode := 0
+	select {
+	case <-shutdownCtx.Done():
+		logging.Info("Shutting down", context.Background())
+	case err := <-serverErrors:
 		logging.Error(err.Error(), context.Background())
-		os.Exit(1)
+		exitCode = 1
+	}
+	stopSignals()
+	shutdownStart := time.Now()
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), config.Loaded().Server.ShutdownTimeout)
+	defer cancelDrain()
+	for _, server := range servers {
+		if err := server.Shutdown(drainCtx); err != nil {
+			logging.Error("Error shutting down server", context.Background(), map[string]any{"ERROR": err.Error(), "ADDRESS": server.Addr})
+		}
+	}
+	// Syncs that did not finish in time are cancelled here
+	restWebapp.Drain(drainCtx)
+	// Aborted webhook deliveries are put back in the database to be attempted on the next start
+	stopWorkers()
+	webhookDispatcher.Wait()
+	if err := db.Close(); err != nil {
+		logging.Error("Error closing database", context.Background(), map[string]any{"ERROR": err.Error()})
 	}
+	logging.Info("Shutdown complete", context.Background(), map[string]any{"TOOK": time.Since(shutdownStart).String()})
+	os.Exit(exitCode)
 }
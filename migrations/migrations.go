@@ -0,0 +1,59 @@
+// Package migrations embeds the SQL migrations of the adapter-attendant database.
+// Every supported database driver has its own directory of migrations, which use the
+// same versions for equivalent changes. Files follow the Flyway naming convention, V<version>.sql.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// driverFiles returns the migrations of a database driver
+func driverFiles(driver string) (fs.FS, error) {
+	if _, err := fs.Stat(files, driver); err != nil {
+		return nil, fmt.Errorf("no migrations for database driver %q", driver)
+	}
+	return fs.Sub(files, driver)
+}
+
+// ParseVersion extracts the version out of a migration file name, eg. "V003.sql" -> 3
+func ParseVersion(fileName string) (int, error) {
+	versionString, found := strings.CutPrefix(strings.TrimSuffix(fileName, ".sql"), "V")
+	if !found {
+		return 0, fmt.Errorf("migration %q does not follow the V<version>.sql naming", fileName)
+	}
+	version, err := strconv.Atoi(versionString)
+	if err != nil {
+		return 0, fmt.Errorf("migration %q has an invalid version: %w", fileName, err)
+	}
+	return version, nil
+}
+
+// LatestVersion returns the highest migration version known to this binary for a database driver
+func LatestVersion(driver string) (int, error) {
+	driverFS, err := driverFiles(driver)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := fs.ReadDir(driverFS, ".")
+	if err != nil {
+		return 0, err
+	}
+	latest := 0
+	for _, entry := range entries {
+		version, err := ParseVersion(entry.Name())
+		if err != nil {
+			return 0, err
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
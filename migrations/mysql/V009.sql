@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS webhookSubscriptions (
+    id SERIAL PRIMARY KEY,
+    targetUrl VARCHAR(2048) NOT NULL,
+    events VARCHAR(255) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhookDeadLetters (
+    id SERIAL PRIMARY KEY,
+    subscriptionId BIGINT UNSIGNED NOT NULL,
+    eventType VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INT NOT NULL,
+    lastError VARCHAR(1024) NOT NULL,
+    FOREIGN KEY (subscriptionId) REFERENCES webhookSubscriptions(id) ON DELETE CASCADE,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
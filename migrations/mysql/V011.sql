@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS rolloutCampaigns (
+    id SERIAL PRIMARY KEY,
+    imageName VARCHAR(255) NOT NULL,
+    imageTag VARCHAR(64) NOT NULL,
+    batchSize INT NOT NULL,
+    pauseSeconds INT NOT NULL,
+    readinessTimeoutSeconds INT NOT NULL,
+    maxFailureRatio DOUBLE NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    batch INT NOT NULL DEFAULT 0,
+    total INT NOT NULL DEFAULT 0,
+    succeeded INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    results MEDIUMTEXT,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    finished TIMESTAMP NULL
+);
@@ -0,0 +1,10 @@
+ALTER TABLE adapters ADD COLUMN updatePolicy TEXT;
+ALTER TABLE adapters ADD COLUMN imageDigest VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS availableUpdates (
+    adapterId BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+    imageTag VARCHAR(64) NOT NULL,
+    imageDigest VARCHAR(100) NOT NULL DEFAULT '',
+    checked TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (adapterId) REFERENCES adapters(id) ON DELETE CASCADE
+);
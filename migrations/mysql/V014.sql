@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS registryCredentials (
+    id SERIAL PRIMARY KEY,
+    registry VARCHAR(255) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    password TEXT NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+ALTER TABLE adapters ADD COLUMN pullCredentialId BIGINT UNSIGNED NULL;
+ALTER TABLE adapters ADD FOREIGN KEY (pullCredentialId) REFERENCES registryCredentials(id);
@@ -0,0 +1,42 @@
+-- updated columns are maintained by BEFORE UPDATE triggers, PostgreSQL has no
+-- equivalent of ON UPDATE CURRENT_TIMESTAMP. Like MySQL, explicitly setting updated
+-- keeps the given value.
+-- Identifiers are not quoted, so columns like imageName are folded to lower case.
+CREATE OR REPLACE FUNCTION touch_updated() RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.updated IS NOT DISTINCT FROM OLD.updated THEN
+        NEW.updated = CURRENT_TIMESTAMP;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TABLE IF NOT EXISTS adapters (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    adapterKey VARCHAR(128) NOT NULL,
+    updated TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    synced TIMESTAMPTZ,
+    CONSTRAINT unique_adapter_key UNIQUE (adapterKey),
+    CONSTRAINT unique_adapter_name UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS adapterConfiguration (
+    id BIGSERIAL PRIMARY KEY,
+    adapterId BIGINT NOT NULL,
+    configKey VARCHAR(255) NOT NULL,
+    configValue VARCHAR(255) NOT NULL,
+    created TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_config_per_adapter UNIQUE (adapterId, configKey),
+    FOREIGN KEY (adapterId) REFERENCES adapters(id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER adapters_touch_updated
+BEFORE UPDATE ON adapters
+FOR EACH ROW EXECUTE FUNCTION touch_updated();
+
+CREATE TRIGGER adapterConfiguration_touch_updated
+BEFORE UPDATE ON adapterConfiguration
+FOR EACH ROW EXECUTE FUNCTION touch_updated();
@@ -0,0 +1,2 @@
+-- Dropping the column drops unique_adapter_key along with it
+ALTER TABLE adapters DROP COLUMN adapterKey;
@@ -0,0 +1,10 @@
+CREATE OR REPLACE FUNCTION touch_adapter() RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE adapters SET updated = CURRENT_TIMESTAMP WHERE id = NEW.adapterId;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER adapterConfiguration_touch_adapter
+AFTER UPDATE ON adapterConfiguration
+FOR EACH ROW EXECUTE FUNCTION touch_adapter();
@@ -0,0 +1,2 @@
+ALTER TABLE adapterConfiguration
+    ALTER COLUMN configValue TYPE VARCHAR(4096);
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS webhookSubscriptions (
+    id BIGSERIAL PRIMARY KEY,
+    targetUrl VARCHAR(2048) NOT NULL,
+    events VARCHAR(255) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    created TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER webhookSubscriptions_touch_updated
+BEFORE UPDATE ON webhookSubscriptions
+FOR EACH ROW EXECUTE FUNCTION touch_updated();
+
+CREATE TABLE IF NOT EXISTS webhookDeadLetters (
+    id BIGSERIAL PRIMARY KEY,
+    subscriptionId BIGINT NOT NULL,
+    eventType VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INT NOT NULL,
+    lastError VARCHAR(1024) NOT NULL,
+    created TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (subscriptionId) REFERENCES webhookSubscriptions(id) ON DELETE CASCADE
+);
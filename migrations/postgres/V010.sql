@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS operations (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(32) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    total INT NOT NULL DEFAULT 0,
+    succeeded INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    results TEXT,
+    created TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished TIMESTAMPTZ
+);
+
+CREATE TRIGGER operations_touch_updated
+BEFORE UPDATE ON operations
+FOR EACH ROW EXECUTE FUNCTION touch_updated();
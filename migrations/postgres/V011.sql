@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS rolloutCampaigns (
+    id BIGSERIAL PRIMARY KEY,
+    imageName VARCHAR(255) NOT NULL,
+    imageTag VARCHAR(64) NOT NULL,
+    batchSize INT NOT NULL,
+    pauseSeconds INT NOT NULL,
+    readinessTimeoutSeconds INT NOT NULL,
+    maxFailureRatio DOUBLE PRECISION NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    batch INT NOT NULL DEFAULT 0,
+    total INT NOT NULL DEFAULT 0,
+    succeeded INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    results TEXT,
+    created TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished TIMESTAMPTZ
+);
+
+CREATE TRIGGER rolloutCampaigns_touch_updated
+BEFORE UPDATE ON rolloutCampaigns
+FOR EACH ROW EXECUTE FUNCTION touch_updated();
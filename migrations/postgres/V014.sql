@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS registryCredentials (
+    id BIGSERIAL PRIMARY KEY,
+    registry VARCHAR(255) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    password TEXT NOT NULL,
+    created TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER registryCredentials_touch_updated
+BEFORE UPDATE ON registryCredentials
+FOR EACH ROW EXECUTE FUNCTION touch_updated();
+
+ALTER TABLE adapters ADD COLUMN pullCredentialId BIGINT REFERENCES registryCredentials(id);
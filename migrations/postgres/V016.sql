@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS webhookEvents (
+    id BIGSERIAL PRIMARY KEY,
+    eventType VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    created TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhookDeliveries (
+    id BIGSERIAL PRIMARY KEY,
+    subscriptionId BIGINT NOT NULL,
+    eventType VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    nextAttempt BIGINT NOT NULL DEFAULT 0,
+    lockedUntil BIGINT NOT NULL DEFAULT 0,
+    lastError VARCHAR(1024) NOT NULL DEFAULT '',
+    created TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (subscriptionId) REFERENCES webhookSubscriptions(id) ON DELETE CASCADE
+);
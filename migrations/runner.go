@@ -0,0 +1,353 @@
+package migrations
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Kaese72/adapter-attendant/internal/store"
+	"github.com/pkg/errors"
+)
+
+// historyTable is shared with Flyway, so that databases migrated by either are understood by both
+const historyTable = "flyway_schema_history"
+
+// lockName serializes migrations of replicas starting at the same time.
+// SQLite databases are not shared between replicas and are not locked.
+const lockName = "adapter-attendant-migrations"
+
+// ErrSchemaNewer is returned when the database has migrations applied that this binary does not know of
+var ErrSchemaNewer = errors.New("database schema is newer than this binary supports")
+
+// Migration is a single embedded migration file
+type Migration struct {
+	Version  int
+	Script   string
+	Checksum int32
+	content  []byte
+}
+
+// appliedMigration is a row of the schema history table
+type appliedMigration struct {
+	version  int
+	checksum sql.NullInt32
+	success  bool
+}
+
+// Migrations returns the embedded migrations of a database driver ordered by version
+func Migrations(driver string) ([]Migration, error) {
+	driverFS, err := driverFiles(driver)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(driverFS, ".")
+	if err != nil {
+		return nil, err
+	}
+	result := []Migration{}
+	for _, entry := range entries {
+		version, err := ParseVersion(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		content, err := fs.ReadFile(driverFS, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, Migration{Version: version, Script: entry.Name(), Checksum: checksum(content), content: content})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// checksum calculates the checksum of a migration the way Flyway does, a CRC32 of
+// every line without its line terminator
+func checksum(content []byte) int32 {
+	hash := crc32.NewIEEE()
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	first := true
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if first {
+			line = bytes.TrimPrefix(line, []byte("\xef\xbb\xbf"))
+			first = false
+		}
+		hash.Write(bytes.TrimSuffix(line, []byte("\r")))
+	}
+	return int32(hash.Sum32())
+}
+
+// triggerBody reports whether a statement is a trigger whose BEGIN ... END body is not complete yet
+func triggerBody(statement string) bool {
+	words := strings.Fields(strings.ToUpper(statement))
+	if len(words) < 2 || words[0] != "CREATE" || words[1] != "TRIGGER" {
+		return false
+	}
+	return slices.Contains(words, "BEGIN") && words[len(words)-1] != "END"
+}
+
+// statements splits a migration into its statements, which are separated by semicolons
+// outside of quotes, $$ quoted function bodies, comments and trigger bodies. Comments are left out.
+func statements(content string) []string {
+	result := []string{}
+	current := strings.Builder{}
+	var quote rune
+	lineComment := false
+	dollarQuoted := false
+	runes := []rune(content)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case lineComment:
+			if r != '\n' {
+				continue
+			}
+			lineComment = false
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '$' && quote == 0:
+			dollarQuoted = !dollarQuoted
+			current.WriteRune(r)
+			i++
+		case dollarQuoted:
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			lineComment = true
+			continue
+		case r == ';':
+			if triggerBody(current.String()) {
+				break
+			}
+			if statement := strings.TrimSpace(current.String()); statement != "" {
+				result = append(result, statement)
+			}
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		result = append(result, statement)
+	}
+	return result
+}
+
+// bind rewrites a query written with ? placeholders for the database driver
+func bind(driver string, query string) string {
+	if driver != "postgres" {
+		return query
+	}
+	return store.NumberPlaceholders(query)
+}
+
+// lock serializes migrations of replicas sharing a database, the returned function releases the lock
+func lock(ctx context.Context, conn *sql.Conn, driver string) (func(), error) {
+	switch driver {
+	case "mysql":
+		var locked sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 60)", lockName).Scan(&locked); err != nil {
+			return nil, errors.Wrap(err, "failed to lock migrations")
+		}
+		if locked.Int64 != 1 {
+			return nil, errors.New("timed out waiting for another instance to finish migrating")
+		}
+		return func() { conn.ExecContext(context.WithoutCancel(ctx), "SELECT RELEASE_LOCK(?)", lockName) }, nil
+	case "postgres":
+		// Waits for as long as ctx allows, advisory locks have no timeout of their own
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", lockName); err != nil {
+			return nil, errors.Wrap(err, "failed to lock migrations")
+		}
+		return func() {
+			conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock(hashtext($1))", lockName)
+		}, nil
+	default:
+		return func() {}, nil
+	}
+}
+
+// execer is implemented by both connections and transactions
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// apply runs the statements of a migration and records it in the schema history table.
+// Databases with transactional schema changes apply each migration in a transaction, so that
+// a failed migration leaves nothing behind. MySQL can not roll back schema changes, so
+// failures are recorded like Flyway does instead.
+func apply(ctx context.Context, conn *sql.Conn, driver string, migration Migration, rank int, installedBy string) error {
+	var target execer = conn
+	var tx *sql.Tx
+	if driver != "mysql" {
+		var err error
+		if tx, err = conn.BeginTx(ctx, nil); err != nil {
+			return errors.Wrapf(err, "failed to begin %s", migration.Script)
+		}
+		defer tx.Rollback()
+		target = tx
+	}
+	start := time.Now()
+	var migrateErr error
+	for _, statement := range statements(string(migration.content)) {
+		if _, migrateErr = target.ExecContext(ctx, statement); migrateErr != nil {
+			break
+		}
+	}
+	if migrateErr != nil && tx != nil {
+		return errors.Wrapf(migrateErr, "failed to apply %s", migration.Script)
+	}
+	_, err := target.ExecContext(ctx, bind(driver, "INSERT INTO "+historyTable+" (installed_rank, version, description, type, script, checksum, installed_by, execution_time, success) VALUES (?, ?, ?, 'SQL', ?, ?, ?, ?, ?)"),
+		rank, strings.TrimSuffix(strings.TrimPrefix(migration.Script, "V"), ".sql"), "", migration.Script, migration.Checksum, installedBy, time.Since(start).Milliseconds(), migrateErr == nil)
+	if migrateErr != nil {
+		return errors.Wrapf(migrateErr, "failed to apply %s", migration.Script)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to record %s", migration.Script)
+	}
+	if tx != nil {
+		return errors.Wrapf(tx.Commit(), "failed to commit %s", migration.Script)
+	}
+	return nil
+}
+
+// createHistoryTable creates the schema history table with the layout Flyway uses
+func createHistoryTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+historyTable+` (
+    installed_rank INT NOT NULL PRIMARY KEY,
+    version VARCHAR(50),
+    description VARCHAR(200) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    script VARCHAR(1000) NOT NULL,
+    checksum INT,
+    installed_by VARCHAR(100) NOT NULL,
+    installed_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    execution_time INT NOT NULL,
+    success BOOL NOT NULL
+)`)
+	return errors.Wrap(err, "failed to create schema history table")
+}
+
+// appliedMigrations reads the versioned migrations recorded in the schema history table
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]appliedMigration, int, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT installed_rank, version, checksum, success FROM "+historyTable+" WHERE version IS NOT NULL")
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to read schema history")
+	}
+	defer rows.Close()
+	applied := map[int]appliedMigration{}
+	lastRank := 0
+	for rows.Next() {
+		var rank int
+		var versionString string
+		migration := appliedMigration{}
+		if err := rows.Scan(&rank, &versionString, &migration.checksum, &migration.success); err != nil {
+			return nil, 0, errors.Wrap(err, "failed to read schema history")
+		}
+		version, err := ParseVersion("V" + versionString + ".sql")
+		if err != nil {
+			return nil, 0, err
+		}
+		migration.version = version
+		applied[version] = migration
+		if rank > lastRank {
+			lastRank = rank
+		}
+	}
+	return applied, lastRank, errors.Wrap(rows.Err(), "failed to read schema history")
+}
+
+// verify checks that the applied migrations are compatible with the embedded ones
+func verify(known []Migration, applied map[int]appliedMigration) error {
+	byVersion := map[int]Migration{}
+	for _, migration := range known {
+		byVersion[migration.Version] = migration
+	}
+	for version, migration := range applied {
+		if !migration.success {
+			return fmt.Errorf("migration %d failed previously, repair the schema and remove it from %s", version, historyTable)
+		}
+		embedded, ok := byVersion[version]
+		if !ok {
+			return errors.Wrapf(ErrSchemaNewer, "migration %d is applied but unknown", version)
+		}
+		if migration.checksum.Valid && migration.checksum.Int32 != embedded.Checksum {
+			return fmt.Errorf("checksum of applied migration %d does not match %s", version, embedded.Script)
+		}
+	}
+	return nil
+}
+
+// Migrate applies pending migrations in order and records them in the schema history table.
+// It refuses to touch a database with migrations applied that this binary does not know of.
+// installedBy is recorded as the user applying the migrations.
+func Migrate(ctx context.Context, db *sql.DB, driver string, installedBy string) (int, error) {
+	known, err := Migrations(driver)
+	if err != nil {
+		return 0, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to connect to database")
+	}
+	defer conn.Close()
+	unlock, err := lock(ctx, conn, driver)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if err := createHistoryTable(ctx, conn); err != nil {
+		return 0, err
+	}
+	applied, lastRank, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if err := verify(known, applied); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, migration := range known {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		lastRank++
+		if err := apply(ctx, conn, driver, migration, lastRank, installedBy); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Check verifies, without changing anything, that the database schema is not newer
+// than this binary and returns the number of pending migrations
+func Check(ctx context.Context, db *sql.DB, driver string) (int, error) {
+	known, err := Migrations(driver)
+	if err != nil {
+		return 0, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to connect to database")
+	}
+	defer conn.Close()
+	applied, _, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if err := verify(known, applied); err != nil {
+		return 0, err
+	}
+	return len(known) - len(applied), nil
+}
@@ -0,0 +1,129 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "separated by semicolons",
+			content: "CREATE TABLE a (id INT);\n\nCREATE TABLE b (id INT);\n",
+			want:    []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			name:    "without a final semicolon",
+			content: "ALTER TABLE a ADD COLUMN b INT",
+			want:    []string{"ALTER TABLE a ADD COLUMN b INT"},
+		},
+		{
+			name:    "comments left out",
+			content: "-- create a; or not\nCREATE TABLE a (id INT); -- trailing;\n",
+			want:    []string{"CREATE TABLE a (id INT)"},
+		},
+		{
+			name:    "semicolons in quotes",
+			content: "INSERT INTO a VALUES ('x;y', \"z;\", `w;`);",
+			want:    []string{"INSERT INTO a VALUES ('x;y', \"z;\", `w;`)"},
+		},
+		{
+			name:    "dollar quoted function body",
+			content: "CREATE FUNCTION f() RETURNS trigger AS $$ BEGIN NEW.updated = now(); RETURN NEW; END; $$ LANGUAGE plpgsql;\nSELECT 1;",
+			want:    []string{"CREATE FUNCTION f() RETURNS trigger AS $$ BEGIN NEW.updated = now(); RETURN NEW; END; $$ LANGUAGE plpgsql", "SELECT 1"},
+		},
+		{
+			name:    "trigger body",
+			content: "CREATE TRIGGER t AFTER UPDATE ON a\nBEGIN\n    UPDATE a SET updated = CURRENT_TIMESTAMP WHERE id = NEW.id;\nEND;\nSELECT 1;",
+			want:    []string{"CREATE TRIGGER t AFTER UPDATE ON a\nBEGIN\n    UPDATE a SET updated = CURRENT_TIMESTAMP WHERE id = NEW.id;\nEND", "SELECT 1"},
+		},
+		{
+			name:    "empty",
+			content: "\n-- nothing\n;\n",
+			want:    []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := statements(test.content); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("statements() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	lf := checksum([]byte("CREATE TABLE a (id INT);\nSELECT 1;\n"))
+	tests := []struct {
+		name    string
+		content string
+		same    bool
+	}{
+		{name: "identical", content: "CREATE TABLE a (id INT);\nSELECT 1;\n", same: true},
+		{name: "CRLF line endings", content: "CREATE TABLE a (id INT);\r\nSELECT 1;\r\n", same: true},
+		{name: "byte order mark", content: "\xef\xbb\xbfCREATE TABLE a (id INT);\nSELECT 1;\n", same: true},
+		{name: "without a final newline", content: "CREATE TABLE a (id INT);\nSELECT 1;", same: true},
+		{name: "changed statement", content: "CREATE TABLE a (id BIGINT);\nSELECT 1;\n", same: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := checksum([]byte(test.content)); (got == lf) != test.same {
+				t.Errorf("checksum(%q) = %d, checksum of the LF content is %d, want same %v", test.content, got, lf, test.same)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	known, err := Migrations("mysql")
+	if err != nil {
+		t.Fatalf("Migrations() error = %v", err)
+	}
+	first := known[0]
+	tests := []struct {
+		name    string
+		applied map[int]appliedMigration
+		wantErr error
+		fails   bool
+	}{
+		{name: "nothing applied", applied: map[int]appliedMigration{}},
+		{name: "applied by us", applied: map[int]appliedMigration{first.Version: {version: first.Version, checksum: sql.NullInt32{Int32: first.Checksum, Valid: true}, success: true}}},
+		{name: "applied without checksum", applied: map[int]appliedMigration{first.Version: {version: first.Version, success: true}}},
+		{name: "failed previously", applied: map[int]appliedMigration{first.Version: {version: first.Version, success: false}}, fails: true},
+		{name: "changed since applied", applied: map[int]appliedMigration{first.Version: {version: first.Version, checksum: sql.NullInt32{Int32: first.Checksum + 1, Valid: true}, success: true}}, fails: true},
+		{name: "unknown version", applied: map[int]appliedMigration{999: {version: 999, success: true}}, wantErr: ErrSchemaNewer, fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verify(known, test.applied)
+			if (err != nil) != test.fails {
+				t.Fatalf("verify() error = %v, want failure %v", err, test.fails)
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Errorf("verify() error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestDialectsAligned(t *testing.T) {
+	versions := map[string][]int{}
+	for _, driver := range []string{"mysql", "postgres", "sqlite"} {
+		migrations, err := Migrations(driver)
+		if err != nil {
+			t.Fatalf("Migrations(%q) error = %v", driver, err)
+		}
+		for _, migration := range migrations {
+			versions[driver] = append(versions[driver], migration.Version)
+		}
+	}
+	if !reflect.DeepEqual(versions["mysql"], versions["postgres"]) || !reflect.DeepEqual(versions["mysql"], versions["sqlite"]) {
+		t.Errorf("migration versions differ between drivers: %v", versions)
+	}
+}
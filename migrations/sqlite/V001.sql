@@ -0,0 +1,37 @@
+-- adapters.updated and adapterConfiguration.updated are maintained by triggers,
+-- SQLite has no equivalent of ON UPDATE CURRENT_TIMESTAMP.
+-- The adapterKey column of the MySQL schema was dropped in V003 and is left out here,
+-- SQLite can not drop columns that are part of a UNIQUE constraint.
+CREATE TABLE IF NOT EXISTS adapters (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(255) NOT NULL,
+    updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    synced TIMESTAMP,
+    CONSTRAINT unique_adapter_name UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS adapterConfiguration (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    adapterId INTEGER NOT NULL,
+    configKey VARCHAR(255) NOT NULL,
+    configValue VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_config_per_adapter UNIQUE (adapterId, configKey),
+    FOREIGN KEY (adapterId) REFERENCES adapters(id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER adapters_touch_updated
+AFTER UPDATE ON adapters
+FOR EACH ROW WHEN NEW.updated = OLD.updated
+BEGIN
+    UPDATE adapters SET updated = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER adapterConfiguration_touch_updated
+AFTER UPDATE ON adapterConfiguration
+FOR EACH ROW WHEN NEW.updated = OLD.updated
+BEGIN
+    UPDATE adapterConfiguration SET updated = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
@@ -0,0 +1,2 @@
+ALTER TABLE adapters ADD COLUMN imageName VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE adapters ADD COLUMN imageTag VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+-- adapterKey was never created for SQLite, see V001, so there is nothing to drop
@@ -0,0 +1,6 @@
+CREATE TRIGGER adapterConfiguration_touch_adapter
+AFTER UPDATE ON adapterConfiguration
+FOR EACH ROW
+BEGIN
+    UPDATE adapters SET updated = CURRENT_TIMESTAMP WHERE id = NEW.adapterId;
+END;
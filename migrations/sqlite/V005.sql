@@ -0,0 +1 @@
+-- SQLite does not enforce VARCHAR lengths, so widening configValue needs no change
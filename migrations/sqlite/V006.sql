@@ -0,0 +1,4 @@
+ALTER TABLE adapters ADD COLUMN cpuRequest VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE adapters ADD COLUMN cpuLimit VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE adapters ADD COLUMN memoryRequest VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE adapters ADD COLUMN memoryLimit VARCHAR(32) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE adapters ADD COLUMN containerPort INT NOT NULL DEFAULT 8080;
+ALTER TABLE adapters ADD COLUMN servicePort INT NOT NULL DEFAULT 8080;
+ALTER TABLE adapters ADD COLUMN scheme VARCHAR(16) NOT NULL DEFAULT 'http';
+ALTER TABLE adapters ADD COLUMN appProtocol VARCHAR(64) NOT NULL DEFAULT '';
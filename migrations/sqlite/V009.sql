@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS webhookSubscriptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    targetUrl VARCHAR(2048) NOT NULL,
+    events VARCHAR(255) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER webhookSubscriptions_touch_updated
+AFTER UPDATE ON webhookSubscriptions
+FOR EACH ROW WHEN NEW.updated = OLD.updated
+BEGIN
+    UPDATE webhookSubscriptions SET updated = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+CREATE TABLE IF NOT EXISTS webhookDeadLetters (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscriptionId INTEGER NOT NULL,
+    eventType VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INT NOT NULL,
+    lastError VARCHAR(1024) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (subscriptionId) REFERENCES webhookSubscriptions(id) ON DELETE CASCADE
+);
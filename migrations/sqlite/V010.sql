@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS operations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind VARCHAR(32) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    total INT NOT NULL DEFAULT 0,
+    succeeded INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    results TEXT,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished TIMESTAMP
+);
+
+CREATE TRIGGER operations_touch_updated
+AFTER UPDATE ON operations
+FOR EACH ROW WHEN NEW.updated = OLD.updated
+BEGIN
+    UPDATE operations SET updated = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
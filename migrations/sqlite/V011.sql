@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS rolloutCampaigns (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    imageName VARCHAR(255) NOT NULL,
+    imageTag VARCHAR(64) NOT NULL,
+    batchSize INT NOT NULL,
+    pauseSeconds INT NOT NULL,
+    readinessTimeoutSeconds INT NOT NULL,
+    maxFailureRatio REAL NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    batch INT NOT NULL DEFAULT 0,
+    total INT NOT NULL DEFAULT 0,
+    succeeded INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    results TEXT,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished TIMESTAMP
+);
+
+CREATE TRIGGER rolloutCampaigns_touch_updated
+AFTER UPDATE ON rolloutCampaigns
+FOR EACH ROW WHEN NEW.updated = OLD.updated
+BEGIN
+    UPDATE rolloutCampaigns SET updated = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
@@ -0,0 +1 @@
+ALTER TABLE adapters ADD COLUMN syncedDigest VARCHAR(100) NOT NULL DEFAULT '';
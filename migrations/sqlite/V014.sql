@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS registryCredentials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    registry VARCHAR(255) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    password TEXT NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER registryCredentials_touch_updated
+AFTER UPDATE ON registryCredentials
+FOR EACH ROW WHEN NEW.updated = OLD.updated
+BEGIN
+    UPDATE registryCredentials SET updated = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+ALTER TABLE adapters ADD COLUMN pullCredentialId INTEGER REFERENCES registryCredentials(id);
@@ -0,0 +1 @@
+ALTER TABLE adapters ADD COLUMN security TEXT;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS webhookEvents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    eventType VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhookDeliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscriptionId INTEGER NOT NULL,
+    eventType VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    nextAttempt BIGINT NOT NULL DEFAULT 0,
+    lockedUntil BIGINT NOT NULL DEFAULT 0,
+    lastError VARCHAR(1024) NOT NULL DEFAULT '',
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (subscriptionId) REFERENCES webhookSubscriptions(id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE operations ADD COLUMN lockedUntil BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS leases (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(128) NOT NULL UNIQUE,
+    holder VARCHAR(128) NOT NULL,
+    lockedUntil BIGINT NOT NULL DEFAULT 0
+);
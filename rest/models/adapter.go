@@ -1,21 +1,219 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
 type Adapter struct {
-	ID        int        `json:"id" readOnly:"true"`
-	Name      string     `json:"name" maxLength:"255"`
-	ImageName string     `json:"imageName" maxLength:"255"`
-	ImageTag  string     `json:"imageTag" maxLength:"64"`
-	Created   time.Time  `json:"created" readOnly:"true"`
-	Updated   time.Time  `json:"updated" readOnly:"true"`
-	Synced    *time.Time `json:"synced,omitempty" readOnly:"true"`
+	ID        int    `json:"id" readOnly:"true"`
+	Name      string `json:"name" maxLength:"255"`
+	ImageName string `json:"imageName" maxLength:"255"`
+	ImageTag  string `json:"imageTag,omitempty" maxLength:"64" doc:"the image tag, may be left out when imageDigest is set"`
+	// ImageDigest pins the image to a manifest, whatever the tag points to
+	ImageDigest      string              `json:"imageDigest,omitempty" maxLength:"100" doc:"the digest the image is pinned to, eg. sha256:<hex>, also set by digest update policies"`
+	SyncedDigest     string              `json:"syncedDigest,omitempty" readOnly:"true" doc:"the digest applied by the last sync, when it was pinned or resolved from the tag"`
+	UpdatePolicy     AdapterUpdatePolicy `json:"updatePolicy,omitempty" doc:"how newer images are looked for in the registry"`
+	AvailableUpdate  *AvailableUpdate    `json:"availableUpdate,omitempty" readOnly:"true" doc:"a newer image found in the registry and not yet applied"`
+	PullCredentialID *int                `json:"pullCredentialId,omitempty" doc:"the Id of the registry credential the image is pulled with"`
+	Resources        AdapterResources    `json:"resources,omitempty" doc:"compute resources for the adapter container, unset values use the cluster defaults"`
+	Probes           AdapterProbes       `json:"probes,omitempty" doc:"health probes for the adapter container, unset probes use the cluster default"`
+	Security         AdapterSecurity     `json:"security,omitempty" doc:"relaxations of the hardened security settings of the adapter workload, changing them requires the admin role"`
+	Network          AdapterNetwork      `json:"network,omitempty" doc:"how the adapter is exposed inside the cluster"`
+	Created          time.Time           `json:"created" readOnly:"true"`
+	Updated          time.Time           `json:"updated" readOnly:"true"`
+	Synced           *time.Time          `json:"synced,omitempty" readOnly:"true"`
 	// Address    string     `json:"address"`
 	// AdapterKey string     `json:"adapterKey"`
 }
 
+// Image is the image reference of the adapter container, pinned to the digest when there is one
+func (adapter Adapter) Image() string {
+	image := adapter.ImageName
+	if adapter.ImageTag != "" {
+		image += ":" + adapter.ImageTag
+	}
+	if adapter.ImageDigest != "" {
+		image += "@" + adapter.ImageDigest
+	}
+	return image
+}
+
+// SyncedImage is the image reference applied by the last sync, which includes the
+// digest the tag was resolved to when the adapter is not pinned to one
+func (adapter Adapter) SyncedImage() string {
+	if adapter.ImageDigest == "" && adapter.SyncedDigest != "" {
+		adapter.ImageDigest = adapter.SyncedDigest
+	}
+	return adapter.Image()
+}
+
+// AdapterResources are Kubernetes resource quantities, eg. "100m" or "128Mi".
+// Empty values fall back to the cluster-wide defaults.
+type AdapterResources struct {
+	CPURequest    string `json:"cpuRequest,omitempty" maxLength:"32"`
+	CPULimit      string `json:"cpuLimit,omitempty" maxLength:"32"`
+	MemoryRequest string `json:"memoryRequest,omitempty" maxLength:"32"`
+	MemoryLimit   string `json:"memoryLimit,omitempty" maxLength:"32"`
+}
+
+// AdapterProbe describes a single Kubernetes probe against the adapter container.
+// Zero valued numbers use the Kubernetes defaults.
+type AdapterProbe struct {
+	Type                string `json:"type" enum:"http,tcp,none" doc:"the kind of probe, none disables the probe"`
+	Path                string `json:"path,omitempty" maxLength:"255" doc:"the HTTP path to probe, only used by http probes"`
+	Port                int    `json:"port,omitempty" minimum:"0" maximum:"65535" doc:"the container port to probe, defaults to the adapter container port"`
+	InitialDelaySeconds int32  `json:"initialDelaySeconds,omitempty" minimum:"0"`
+	PeriodSeconds       int32  `json:"periodSeconds,omitempty" minimum:"0"`
+	TimeoutSeconds      int32  `json:"timeoutSeconds,omitempty" minimum:"0"`
+	FailureThreshold    int32  `json:"failureThreshold,omitempty" minimum:"0"`
+}
+
+type AdapterProbes struct {
+	Liveness  *AdapterProbe `json:"liveness,omitempty"`
+	Readiness *AdapterProbe `json:"readiness,omitempty"`
+	Startup   *AdapterProbe `json:"startup,omitempty"`
+}
+
+// Value stores probes as a JSON document
+func (probes AdapterProbes) Value() (driver.Value, error) {
+	encoded, err := json.Marshal(probes)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// Scan reads probes from a JSON document, NULL meaning no probes have been set
+func (probes *AdapterProbes) Scan(src interface{}) error {
+	*probes = AdapterProbes{}
+	switch value := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(value, probes)
+	case string:
+		return json.Unmarshal([]byte(value), probes)
+	default:
+		return fmt.Errorf("can not scan %T into AdapterProbes", src)
+	}
+}
+
+// AdapterUpdatePolicy decides which newer images of an adapter are looked for in its registry
+type AdapterUpdatePolicy struct {
+	Mode  string `json:"mode,omitempty" enum:"pinned,patch,minor,digest" doc:"pinned never looks for updates, patch and minor look for newer semantic version tags within the current minor or major version, digest looks for a new image behind the current tag. Defaults to pinned"`
+	Apply bool   `json:"apply,omitempty" doc:"apply found updates instead of only proposing them"`
+}
+
+const (
+	UpdatePolicyPinned = "pinned"
+	UpdatePolicyPatch  = "patch"
+	UpdatePolicyMinor  = "minor"
+	UpdatePolicyDigest = "digest"
+)
+
+// Tracking reports whether the registry should be polled for updates
+func (policy AdapterUpdatePolicy) Tracking() bool {
+	return policy.Mode != "" && policy.Mode != UpdatePolicyPinned
+}
+
+// Value stores the update policy as a JSON document
+func (policy AdapterUpdatePolicy) Value() (driver.Value, error) {
+	encoded, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// Scan reads the update policy from a JSON document, NULL meaning the adapter is pinned
+func (policy *AdapterUpdatePolicy) Scan(src interface{}) error {
+	*policy = AdapterUpdatePolicy{}
+	switch value := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(value, policy)
+	case string:
+		return json.Unmarshal([]byte(value), policy)
+	default:
+		return fmt.Errorf("can not scan %T into AdapterUpdatePolicy", src)
+	}
+}
+
+// AvailableUpdate is a newer image of an adapter found by polling its registry
+type AvailableUpdate struct {
+	ImageTag    string    `json:"imageTag"`
+	ImageDigest string    `json:"imageDigest,omitempty"`
+	Checked     time.Time `json:"checked" doc:"when the registry was polled"`
+}
+
+// AdapterSecurity relaxes the hardened security settings of an adapter workload, which runs as
+// a non-root user on a read-only root filesystem without capabilities or a service account token.
+// The zero value keeps the workload hardened.
+type AdapterSecurity struct {
+	RunAsRoot                bool     `json:"runAsRoot,omitempty" doc:"allow the container to run as root"`
+	WritableRootFilesystem   bool     `json:"writableRootFilesystem,omitempty" doc:"mount the root filesystem of the container writable, /tmp is writable either way"`
+	AddCapabilities          []string `json:"addCapabilities,omitempty" maxItems:"16" doc:"Linux capabilities to add, eg. NET_BIND_SERVICE"`
+	MountServiceAccountToken bool     `json:"mountServiceAccountToken,omitempty" doc:"mount the token of the adapter service account"`
+}
+
+// Hardened reports whether no security setting is relaxed
+func (security AdapterSecurity) Hardened() bool {
+	return !security.RunAsRoot && !security.WritableRootFilesystem && len(security.AddCapabilities) == 0 && !security.MountServiceAccountToken
+}
+
+// Value stores security settings as a JSON document
+func (security AdapterSecurity) Value() (driver.Value, error) {
+	encoded, err := json.Marshal(security)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// Scan reads security settings from a JSON document, NULL meaning the workload is hardened
+func (security *AdapterSecurity) Scan(src interface{}) error {
+	*security = AdapterSecurity{}
+	switch value := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(value, security)
+	case string:
+		return json.Unmarshal([]byte(value), security)
+	default:
+		return fmt.Errorf("can not scan %T into AdapterSecurity", src)
+	}
+}
+
+// AdapterNetwork describes the port the adapter listens on and how it is exposed through its Service
+type AdapterNetwork struct {
+	ContainerPort int    `json:"containerPort,omitempty" minimum:"0" maximum:"65535" doc:"the port the adapter listens on, defaults to 8080"`
+	ServicePort   int    `json:"servicePort,omitempty" minimum:"0" maximum:"65535" doc:"the port exposed by the adapter Service, defaults to 8080"`
+	Scheme        string `json:"scheme,omitempty" enum:"http,https,grpc,grpcs" doc:"the scheme used in the adapter address, defaults to http"`
+	AppProtocol   string `json:"appProtocol,omitempty" maxLength:"64" doc:"the application protocol of the Service port, eg. kubernetes.io/h2c"`
+}
+
+// AdapterAddress describes how to reach an adapter, as seen by the cluster
+type AdapterAddress struct {
+	Address        string               `json:"address"`
+	ClusterIP      string               `json:"clusterIP"`
+	Ports          []AdapterServicePort `json:"ports"`
+	ReadyEndpoints int                  `json:"readyEndpoints" doc:"the number of endpoints ready to receive traffic"`
+	TotalEndpoints int                  `json:"totalEndpoints" doc:"the number of endpoints, ready or not"`
+}
+
+type AdapterServicePort struct {
+	Name        string `json:"name"`
+	Port        int32  `json:"port"`
+	TargetPort  string `json:"targetPort"`
+	Protocol    string `json:"protocol"`
+	AppProtocol string `json:"appProtocol,omitempty"`
+}
+
 type AdapterConfiguration struct {
 	ID          int       `json:"id" readOnly:"true"`
 	AdapterID   int       `json:"adapterId" readOnly:"true"`
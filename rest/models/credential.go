@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// RegistryCredential authenticates with a private registry, both adapters pulling their image
+// and the attendant looking for image updates
+type RegistryCredential struct {
+	ID       int       `json:"id" readOnly:"true"`
+	Registry string    `json:"registry" minLength:"1" maxLength:"255" doc:"the registry host, eg. ghcr.io or registry.example.com:5000"`
+	Username string    `json:"username" minLength:"1" maxLength:"255"`
+	Password string    `json:"password,omitempty" writeOnly:"true" maxLength:"4096" doc:"the password or access token, stored encrypted and never returned. Required on creation, left as it is on update when empty"`
+	Created  time.Time `json:"created" readOnly:"true"`
+	Updated  time.Time `json:"updated" readOnly:"true"`
+}
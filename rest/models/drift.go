@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// DriftReport compares the adapters in the database with what is running in Kubernetes
+type DriftReport struct {
+	Adapters []AdapterDrift `json:"adapters"`
+	Orphans  []DriftObject  `json:"orphans" doc:"adapter objects in Kubernetes that belong to no adapter"`
+}
+
+// AdapterDrift lists how the live objects of an adapter differ from the adapter
+type AdapterDrift struct {
+	AdapterID int    `json:"adapterId"`
+	Name      string `json:"name"`
+	Drifted   bool   `json:"drifted" doc:"whether anything below differs"`
+	// Missing objects are expected for adapters that were never synced
+	Missing    []string            `json:"missing,omitempty" doc:"kinds of objects that do not exist" enum:"ConfigMap,Deployment,Service"`
+	Image      *ImageDrift         `json:"image,omitempty" doc:"set when the Deployment runs another image"`
+	EnvKeys    *EnvKeyDrift        `json:"envKeys,omitempty" doc:"set when the environment of the adapter differs"`
+	ModifiedBy []FieldManagerDrift `json:"modifiedBy,omitempty" doc:"changes to the objects made by others than the attendant, eg. kubectl edit"`
+	Unsynced   *UnsyncedDrift      `json:"unsynced,omitempty" doc:"set when the adapter changed after it was last synced"`
+}
+
+// ImageDrift is an image that differs from the image of the adapter
+type ImageDrift struct {
+	Desired string `json:"desired"`
+	Live    string `json:"live"`
+}
+
+// EnvKeyDrift lists the environment keys that differ, without their values
+type EnvKeyDrift struct {
+	Added   []string `json:"added,omitempty" doc:"keys of the adapter that are not live"`
+	Removed []string `json:"removed,omitempty" doc:"live keys that the adapter no longer has"`
+	Changed []string `json:"changed,omitempty" doc:"keys whose live value differs"`
+}
+
+// FieldManagerDrift is a change to an adapter object made by another field manager
+type FieldManagerDrift struct {
+	Kind      string     `json:"kind"`
+	Name      string     `json:"name"`
+	Manager   string     `json:"manager" doc:"the field manager, eg. kubectl-edit"`
+	Operation string     `json:"operation"`
+	Time      *time.Time `json:"time,omitempty"`
+}
+
+// UnsyncedDrift describes adapter changes that have not been synced
+type UnsyncedDrift struct {
+	Updated time.Time  `json:"updated"`
+	Synced  *time.Time `json:"synced,omitempty" doc:"unset if the adapter was never synced"`
+}
+
+// DriftObject identifies a Kubernetes object
+type DriftObject struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// AdapterEvent is sent on the event stream whenever something happens to an adapter
+type AdapterEvent struct {
+	AdapterID int       `json:"adapterId"`
+	Time      time.Time `json:"time"`
+	Adapter   *Adapter  `json:"adapter,omitempty" doc:"the adapter after the change, when known"`
+	Health    string    `json:"health,omitempty" enum:"healthy,progressing,degraded,failed,missing" doc:"the health of the adapter workload, only set on health-changed"`
+	Reason    string    `json:"reason,omitempty" doc:"a human readable explanation of the health, only set on health-changed"`
+}
+
+// The event stream distinguishes events by their type, so each event name gets its own type
+
+type AdapterCreatedEvent AdapterEvent
+type AdapterUpdatedEvent AdapterEvent
+type AdapterDeletedEvent AdapterEvent
+type AdapterSyncedEvent AdapterEvent
+type AdapterHealthChangedEvent AdapterEvent
+
+// HeartbeatEvent is sent on an idle event stream, so that proxies do not close it
+type HeartbeatEvent struct {
+	Time time.Time `json:"time"`
+}
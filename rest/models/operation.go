@@ -0,0 +1,66 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Operation records the progress of a long running action on many adapters
+type Operation struct {
+	ID        int              `json:"id"`
+	Kind      string           `json:"kind" enum:"sync"`
+	Status    string           `json:"status" enum:"running,succeeded,failed,cancelled"`
+	Total     int              `json:"total" doc:"the number of adapters the operation covers"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   OperationResults `json:"results" doc:"the result of every adapter handled so far"`
+	Created   time.Time        `json:"created"`
+	Updated   time.Time        `json:"updated"`
+	Finished  *time.Time       `json:"finished,omitempty"`
+}
+
+// OperationResult is the outcome of an operation for a single adapter
+type OperationResult struct {
+	AdapterID int    `json:"adapterId"`
+	Name      string `json:"name"`
+	Status    string `json:"status" enum:"running,succeeded,failed" doc:"running while a rollout upgrades the adapter"`
+	Error     string `json:"error,omitempty"`
+}
+
+type OperationResults []OperationResult
+
+// Value stores results as a JSON document
+func (results OperationResults) Value() (driver.Value, error) {
+	encoded, err := json.Marshal(results)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// Scan reads results from a JSON document, NULL meaning no results yet
+func (results *OperationResults) Scan(src interface{}) error {
+	*results = OperationResults{}
+	switch value := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(value, results)
+	case string:
+		return json.Unmarshal([]byte(value), results)
+	default:
+		return fmt.Errorf("can not scan %T into OperationResults", src)
+	}
+}
+
+// FleetSyncRequest selects the adapters to sync. Selectors are combined, an adapter has
+// to match all of them.
+type FleetSyncRequest struct {
+	All         bool   `json:"all,omitempty" doc:"sync every adapter, required when no other selector is given"`
+	IDs         []int  `json:"ids,omitempty" doc:"only sync these adapters"`
+	ImageName   string `json:"imageName,omitempty" maxLength:"255" doc:"only sync adapters running this image"`
+	OutOfDate   bool   `json:"outOfDate,omitempty" doc:"only sync adapters changed since they were last synced, or never synced"`
+	Concurrency int    `json:"concurrency,omitempty" minimum:"0" maximum:"16" doc:"the number of adapters synced at the same time, defaults to 4"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// RolloutCampaign upgrades every adapter running an image to a new tag, a batch at a time.
+// Each upgraded adapter has to become ready before the next batch starts.
+type RolloutCampaign struct {
+	ID                      int              `json:"id" readOnly:"true"`
+	ImageName               string           `json:"imageName" minLength:"1" maxLength:"255" doc:"the image of the adapters to upgrade"`
+	ImageTag                string           `json:"imageTag" minLength:"1" maxLength:"64" doc:"the tag to upgrade to"`
+	BatchSize               int              `json:"batchSize,omitempty" minimum:"0" doc:"the number of adapters upgraded at a time, defaults to 1"`
+	PauseSeconds            int              `json:"pauseSeconds,omitempty" minimum:"0" doc:"how long to wait between batches"`
+	ReadinessTimeoutSeconds int              `json:"readinessTimeoutSeconds,omitempty" minimum:"0" doc:"how long an upgraded adapter has to become ready, defaults to 300"`
+	MaxFailureRatio         float64          `json:"maxFailureRatio,omitempty" minimum:"0" maximum:"1" doc:"the campaign halts once the ratio of failed upgrades exceeds this, 0 halts on the first failure"`
+	Status                  string           `json:"status" readOnly:"true" enum:"running,succeeded,halted,cancelled"`
+	Batch                   int              `json:"batch" readOnly:"true" doc:"the number of batches started"`
+	Total                   int              `json:"total" readOnly:"true" doc:"the number of adapters to upgrade when the campaign started"`
+	Succeeded               int              `json:"succeeded" readOnly:"true"`
+	Failed                  int              `json:"failed" readOnly:"true"`
+	Results                 OperationResults `json:"results" readOnly:"true"`
+	Created                 time.Time        `json:"created" readOnly:"true"`
+	Updated                 time.Time        `json:"updated" readOnly:"true"`
+	Finished                *time.Time       `json:"finished,omitempty" readOnly:"true"`
+}
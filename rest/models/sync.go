@@ -0,0 +1,21 @@
+package models
+
+// SyncDiff describes what syncing an adapter would change in Kubernetes
+type SyncDiff struct {
+	Objects []ObjectDiff `json:"objects"`
+}
+
+// ObjectDiff describes the changes to a single Kubernetes object
+type ObjectDiff struct {
+	Kind    string        `json:"kind"`
+	Name    string        `json:"name"`
+	Action  string        `json:"action" enum:"create,update,unchanged"`
+	Changes []FieldChange `json:"changes,omitempty" doc:"the changed fields, only set on update"`
+}
+
+// FieldChange is a single changed field of a Kubernetes object
+type FieldChange struct {
+	Path   string `json:"path" doc:"the path of the field, eg. spec.template.spec.containers[0].image"`
+	Before any    `json:"before,omitempty" doc:"the live value, unset if the field is added"`
+	After  any    `json:"after,omitempty" doc:"the value after the sync, unset if the field is removed"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+type WebhookSubscription struct {
+	ID        int       `json:"id" readOnly:"true"`
+	TargetURL string    `json:"targetUrl" maxLength:"2048" format:"uri" doc:"the http(s) URL events are POSTed to"`
+	Events    []string  `json:"events,omitempty" enum:"created,updated,deleted,synced,health-changed,rollout-failed" doc:"the events to deliver, all events if empty"`
+	Secret    string    `json:"secret,omitempty" maxLength:"255" doc:"the HMAC-SHA256 signing secret, generated if not provided and only returned on creation"`
+	Created   time.Time `json:"created" readOnly:"true"`
+	Updated   time.Time `json:"updated" readOnly:"true"`
+}
+
+// WebhookDeadLetter is an event that could not be delivered to a subscription
+type WebhookDeadLetter struct {
+	ID             int            `json:"id"`
+	SubscriptionID int            `json:"subscriptionId"`
+	EventType      string         `json:"eventType"`
+	Payload        WebhookPayload `json:"payload"`
+	Attempts       int            `json:"attempts"`
+	LastError      string         `json:"lastError"`
+	Created        time.Time      `json:"created"`
+}
+
+// WebhookPayload is the body POSTed to webhook subscribers
+type WebhookPayload struct {
+	Event     string    `json:"event"`
+	AdapterID int       `json:"adapterId"`
+	Time      time.Time `json:"time"`
+	Adapter   *Adapter  `json:"adapter,omitempty"`
+	Health    string    `json:"health,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}